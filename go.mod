@@ -4,6 +4,10 @@ go 1.13
 
 require (
 	github.com/aws/aws-sdk-go v1.44.232
+	github.com/linkedin/goavro/v2 v2.12.0
 	github.com/sirupsen/logrus v1.9.0
-	github.com/stretchr/testify v1.7.0
+	github.com/stretchr/testify v1.7.5
+	github.com/xitongsys/parquet-go v1.6.2
+	golang.org/x/time v0.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -309,7 +309,7 @@ def run_ecs_tests():
             processes.append({
                 "input_logger": input_logger,
                 "test_configuration": test_configuration,
-                "process": subprocess.Popen(['go', 'run', './load_tests/validation/validate.go', input_record, log_delay], stdout=subprocess.PIPE,
+                "process": subprocess.Popen(['go', 'run', './load_tests/validation', '--total-records', input_record, '--log-delay', log_delay], stdout=subprocess.PIPE,
                     env=validator_env
                 )
             })
@@ -494,7 +494,7 @@ def run_eks_tests():
             log_delay = get_log_delay(actual_time/1000-expect_time/1000)
             os.environ['LOG_PREFIX'] = log_stream['logStreamName']
             os.environ['DESTINATION'] = 'cloudwatch'
-            processes.add(subprocess.Popen(['go', 'run', './load_tests/validation/validate.go', input_record, log_delay]))
+            processes.add(subprocess.Popen(['go', 'run', './load_tests/validation', '--total-records', input_record, '--log-delay', log_delay]))
     
     # Wait until all subprocesses for validation completed
     for p in processes:
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Writes a line per record found in a destination with the location it was found at, to trace duplicates and losses.
+// A nil AuditLog is valid and writes nothing, so validators can add records unconditionally.
+type AuditLog struct {
+	mutex  sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	// First error writing the log, returned by close
+	err error
+}
+
+// Creates the audit log file, replacing any previous one
+func newAuditLog(path string) (*AuditLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{
+		file:   file,
+		writer: bufio.NewWriterSize(file, 1024*1024),
+	}, nil
+}
+
+// Writes the record ID and its location, formatted from the arguments, as a tab separated line.
+// Safe for concurrent use.
+func (a *AuditLog) add(recordId string, format string, args ...interface{}) {
+	if a == nil {
+		return
+	}
+	location := fmt.Sprintf(format, args...)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.err != nil {
+		return
+	}
+	_, a.err = a.writer.WriteString(recordId + "\t" + location + "\n")
+}
+
+// Flushes and closes the file, returning the first error writing it
+func (a *AuditLog) close() error {
+	if a == nil {
+		return nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.err == nil {
+		a.err = a.writer.Flush()
+	}
+	if err := a.file.Close(); a.err == nil {
+		a.err = err
+	}
+	return a.err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Test case 1: a nil audit log writes nothing
+	var audit *AuditLog
+	audit.add("10000000", "s3://%s/%s:%d", "bucket", "a", 1)
+	assert.NoError(t, audit.close())
+
+	// Test case 2: every record found in S3 with its object and position, including duplicates
+	path := filepath.Join(dir, "audit.tsv")
+	audit, err = newAuditLog(path)
+	assert.NoError(t, err)
+	client := &mockS3{
+		pages:   [][]string{{"a", "b"}},
+		objects: map[string][]string{"a": producerLogs("10000000", "10000001"), "b": producerLogs("10000001")},
+	}
+	_, _, err = validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(2), &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+		audit:        audit,
+	}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, audit.close())
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{"10000000\ts3://bucket/a:1", "10000001\ts3://bucket/a:2", "10000001\ts3://bucket/b:1"}, lines)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Minimum time between two checkpoints, a variable so that tests do not have to wait
+var checkpointPeriod = 30 * time.Second
+
+// State of a validation, persisted so that a run which failed part way can resume instead of starting over.
+// Delays and ordering are not persisted, so after resuming they only cover the records read by the resumed run.
+type Checkpoint struct {
+	Destination string `json:"destination"`
+	Found       int    `json:"found"`
+	Unparseable int    `json:"unparseable"`
+	Malformed   int    `json:"malformed"`
+	// Occurrences of each input record found so far, records which were not found may be left out
+	Records map[string]int `json:"records"`
+	// S3: index of the prefix being listed and the continuation token of its next page
+	S3Prefix            int    `json:"s3_prefix,omitempty"`
+	S3ContinuationToken string `json:"s3_continuation_token,omitempty"`
+	// S3: number and size of the objects validated
+	S3Objects      int   `json:"s3_objects,omitempty"`
+	S3Bytes        int64 `json:"s3_bytes,omitempty"`
+	S3ContentBytes int64 `json:"s3_content_bytes,omitempty"`
+	S3GzipObjects  int   `json:"s3_gzip_objects,omitempty"`
+	S3PlainObjects int   `json:"s3_plain_objects,omitempty"`
+	// S3: locations of the corrupt objects skipped
+	S3CorruptObjects []string `json:"s3_corrupt_objects,omitempty"`
+	// CloudWatch: forward token of the next page of every log stream read so far
+	CWForwardTokens map[string]string `json:"cw_forward_tokens,omitempty"`
+}
+
+// Writes the checkpoints of a validation to a file, at most once per checkpointPeriod.
+// The validators update and save the state under the same lock as the records, so that both stay consistent.
+type Checkpointer struct {
+	path     string
+	lastSave time.Time
+	// Checkpoint the run resumed from, without records when starting over
+	resumed Checkpoint
+	state   Checkpoint
+}
+
+// Creates a checkpointer for the given file, resuming from the checkpoint in it if there is one
+func newCheckpointer(path string, destination string) (*Checkpointer, error) {
+	c := &Checkpointer{
+		path:     path,
+		lastSave: time.Now(),
+		resumed:  Checkpoint{Destination: destination},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &c.resumed); err != nil {
+			return nil, fmt.Errorf("checkpoint file %q is not valid JSON: %w", path, err)
+		}
+		if c.resumed.Destination != destination {
+			return nil, fmt.Errorf("checkpoint file %q is a checkpoint of destination %q, not %q", path, c.resumed.Destination, destination)
+		}
+	}
+
+	c.state = c.resumed
+	c.state.CWForwardTokens = make(map[string]string)
+	for logStream, token := range c.resumed.CWForwardTokens {
+		c.state.CWForwardTokens[logStream] = token
+	}
+	return c, nil
+}
+
+// Returns true if the run resumed from a checkpoint
+func (c *Checkpointer) resuming() bool {
+	return c != nil && c.resumed.Records != nil
+}
+
+// Restores the occurrences of the input records and the parser counts of the checkpoint the run resumed from
+func (c *Checkpointer) restore(inputMap *RecordMap, parser *RecordIdParser) {
+	if !c.resuming() {
+		return
+	}
+	for recordId, occurrences := range c.resumed.Records {
+		if _, ok := inputMap.get(recordId); ok {
+			inputMap.set(recordId, occurrences)
+		}
+	}
+	parser.countUnparseable(c.resumed.Unparseable)
+	atomic.AddInt64(&parser.malformed, int64(c.resumed.Malformed))
+}
+
+// Returns the number of records found before the run resumed
+func (c *Checkpointer) resumedFound() int {
+	if c == nil {
+		return 0
+	}
+	return c.resumed.Found
+}
+
+// Returns the index of the prefix and the continuation token to resume the S3 listing from
+func (c *Checkpointer) s3Start() (int, *string) {
+	if !c.resuming() {
+		return 0, nil
+	}
+	var continuationToken *string
+	if c.resumed.S3ContinuationToken != "" {
+		continuationToken = aws.String(c.resumed.S3ContinuationToken)
+	}
+	return c.resumed.S3Prefix, continuationToken
+}
+
+// Returns the forward token to resume a log stream from, or nil to read it from the start
+func (c *Checkpointer) forwardToken(logStream string) *string {
+	if !c.resuming() {
+		return nil
+	}
+	if token, ok := c.resumed.CWForwardTokens[logStream]; ok {
+		return aws.String(token)
+	}
+	return nil
+}
+
+// Returns the number and size of the S3 objects validated before the run resumed
+func (c *Checkpointer) resumedObjects() s3Totals {
+	if c == nil {
+		return s3Totals{}
+	}
+	return s3Totals{
+		objects:        c.resumed.S3Objects,
+		bytes:          c.resumed.S3Bytes,
+		contentBytes:   c.resumed.S3ContentBytes,
+		gzipObjects:    c.resumed.S3GzipObjects,
+		plainObjects:   c.resumed.S3PlainObjects,
+		corruptObjects: c.resumed.S3CorruptObjects,
+	}
+}
+
+// Adds S3 objects validated since the last update
+func (c *Checkpointer) addObjects(totals s3Totals) {
+	if c != nil {
+		c.state.S3Objects += totals.objects
+		c.state.S3Bytes += totals.bytes
+		c.state.S3ContentBytes += totals.contentBytes
+		c.state.S3GzipObjects += totals.gzipObjects
+		c.state.S3PlainObjects += totals.plainObjects
+		c.state.S3CorruptObjects = append(c.state.S3CorruptObjects, totals.corruptObjects...)
+	}
+}
+
+// Adds records found since the last update
+func (c *Checkpointer) add(found int) {
+	if c != nil {
+		c.state.Found += found
+	}
+}
+
+// Records that every object listed before the given page of a prefix was validated
+func (c *Checkpointer) s3Page(prefix int, continuationToken *string) {
+	if c != nil {
+		c.state.S3Prefix = prefix
+		c.state.S3ContinuationToken = aws.StringValue(continuationToken)
+	}
+}
+
+// Records that every event before the given page of a log stream was validated
+func (c *Checkpointer) cwPage(logStream string, forwardToken *string) {
+	if c != nil {
+		c.state.CWForwardTokens[logStream] = aws.StringValue(forwardToken)
+	}
+}
+
+// Returns true if the last checkpoint is older than checkpointPeriod
+func (c *Checkpointer) due() bool {
+	return c != nil && time.Since(c.lastSave) >= checkpointPeriod
+}
+
+// Writes the state along with the given records and parser counts.
+// The file is replaced atomically, so that a run killed while saving still leaves the previous checkpoint.
+func (c *Checkpointer) save(inputMap *RecordMap, parser *RecordIdParser) error {
+	c.state.Records = make(map[string]int)
+	inputMap.each(func(recordId string, occurrences int) {
+		if occurrences > 0 {
+			c.state.Records[recordId] = occurrences
+		}
+	})
+	c.state.Unparseable = parser.unparseableCount()
+	c.state.Malformed = parser.malformedCount()
+	data, err := json.Marshal(c.state)
+	c.state.Records = nil
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(c.path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(c.path+".tmp", c.path); err != nil {
+		return err
+	}
+	c.lastSave = time.Now()
+	return nil
+}
+
+// Deletes the checkpoint once the validation completed, so that the next run starts over
+func (c *Checkpointer) remove() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
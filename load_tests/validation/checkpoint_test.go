@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	// Test case 1: no checkpoint to resume from
+	checkpoint, err := newCheckpointer(path, "s3")
+	assert.NoError(t, err)
+	assert.False(t, checkpoint.resuming())
+	prefix, token := checkpoint.s3Start()
+	assert.Equal(t, 0, prefix)
+	assert.Nil(t, token)
+
+	// Test case 2: saved state is restored
+	parser := newRecordIdParser(8)
+	parser.countUnparseable(2)
+	checkpoint.add(3)
+	checkpoint.s3Page(1, aws.String("token"))
+	assert.NoError(t, checkpoint.save(recordMapOf(map[string]int{"10000000": 2, "10000001": 0}), parser))
+
+	checkpoint, err = newCheckpointer(path, "s3")
+	assert.NoError(t, err)
+	assert.True(t, checkpoint.resuming())
+	assert.Equal(t, 3, checkpoint.resumedFound())
+	prefix, token = checkpoint.s3Start()
+	assert.Equal(t, 1, prefix)
+	assert.Equal(t, "token", aws.StringValue(token))
+
+	inputMap := newInputMap(2)
+	parser = newRecordIdParser(8)
+	checkpoint.restore(inputMap, parser)
+	assert.Equal(t, map[string]int{"10000000": 2, "10000001": 0}, inputMap.toMap())
+	assert.Equal(t, 2, parser.unparseableCount())
+
+	// Test case 3: checkpoint of another destination
+	_, err = newCheckpointer(path, "cloudwatch")
+	assert.Error(t, err)
+
+	// Test case 4: removed once the validation completed
+	assert.NoError(t, checkpoint.remove())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, checkpoint.remove())
+}
+
+func TestValidateS3Resume(t *testing.T) {
+	checkpointPeriod = 0
+	defer func() { checkpointPeriod = 30 * time.Second }()
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	client := &mockS3{
+		pages:   [][]string{{"a"}, {"b"}, {"c"}},
+		objects: map[string][]string{"a": producerLogs("10000000"), "b": producerLogs("10000001"), "c": producerLogs("10000002")},
+		errors:  map[string][]error{"c": {awserr.New("ExpiredToken", "The provided token has expired.", nil)}},
+	}
+
+	// The first run fails on the last page, after checkpointing the first two
+	checkpoint, err := newCheckpointer(path, "s3")
+	assert.NoError(t, err)
+	_, _, err = validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(3), &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+		checkpoint:   checkpoint,
+	}, nil)
+	assert.Error(t, err)
+
+	// The second run only validates the last page
+	checkpoint, err = newCheckpointer(path, "s3")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, checkpoint.resumedFound())
+	inputMap := newInputMap(3)
+	parser := newRecordIdParser(defaultRecordIdLength)
+	checkpoint.restore(inputMap, parser)
+
+	found, _, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, inputMap, &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		parser:       parser,
+		delays:       &DelayStats{},
+		checkpoint:   checkpoint,
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, found)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1, "10000002": 1}, inputMap.toMap())
+}
+
+func TestValidateS3ResumeSorted(t *testing.T) {
+	checkpointPeriod = 0
+	defer func() { checkpointPeriod = 30 * time.Second }()
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	client := &mockS3{
+		pages:   [][]string{{"a"}, {"b"}, {"c"}},
+		objects: map[string][]string{"a": producerLogs("10000000"), "b": producerLogs("10000001"), "c": producerLogs("10000002")},
+		errors:  map[string][]error{"c": {awserr.New("ExpiredToken", "The provided token has expired.", nil)}},
+	}
+
+	// The first run fails after listing every page, none of the pages is checkpointed since the objects were sorted
+	checkpoint, err := newCheckpointer(path, "s3")
+	assert.NoError(t, err)
+	_, _, err = validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(3), &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		objectOrder:  s3OrderModified,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+		checkpoint:   checkpoint,
+	}, nil)
+	assert.Error(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// The second run validates every object again, no records are lost
+	checkpoint, err = newCheckpointer(path, "s3")
+	assert.NoError(t, err)
+	inputMap := newInputMap(3)
+	parser := newRecordIdParser(defaultRecordIdLength)
+	checkpoint.restore(inputMap, parser)
+
+	found, _, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, inputMap, &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		objectOrder:  s3OrderModified,
+		parser:       parser,
+		delays:       &DelayStats{},
+		checkpoint:   checkpoint,
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1, "10000002": 1}, inputMap.toMap())
+}
+
+func TestValidateCloudWatchResume(t *testing.T) {
+	cwRequestPeriod = 0
+	defer func() { cwRequestPeriod = 1 * time.Second }()
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"destination":"cloudwatch","found":2,"records":{"10000000":1,"10000001":1},"cw_forward_tokens":{"stream":"2"}}`), 0644))
+
+	client := &mockCloudWatch{
+		streams: map[string][][]string{"stream": {producerLogs("10000000"), producerLogs("10000001"), producerLogs("10000002")}},
+	}
+	checkpoint, err := newCheckpointer(path, "cloudwatch")
+	assert.NoError(t, err)
+	inputMap := newInputMap(3)
+	parser := newRecordIdParser(defaultRecordIdLength)
+	checkpoint.restore(inputMap, parser)
+
+	found, err := validate_cloudwatch(context.Background(), client, "group", []string{"stream"}, inputMap, &validatorSettings{
+		workerCount: 2,
+		parser:      parser,
+		delays:      &DelayStats{},
+		checkpoint:  checkpoint,
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, found)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1, "10000002": 1}, inputMap.toMap())
+}
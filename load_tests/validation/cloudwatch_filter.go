@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Longest filter pattern FilterLogEvents accepts
+	filterPatternMaxLength = 1024
+	// FilterLogEvents searches at most this many log streams by name at once
+	filterMaxLogStreams = 100
+)
+
+// Returns the filter pattern matching the events holding any of the record IDs, e.g. ?"10000001" ?"10000005"
+func filterPattern(recordIds []string) string {
+	// A single term is matched as is, the ? only joins several of them
+	if len(recordIds) == 1 {
+		return fmt.Sprintf("%q", recordIds[0])
+	}
+	terms := make([]string, 0, len(recordIds))
+	for _, recordId := range recordIds {
+		terms = append(terms, fmt.Sprintf("?%q", recordId))
+	}
+	return strings.Join(terms, " ")
+}
+
+// Splits the record IDs into batches whose filter pattern is as long as FilterLogEvents allows
+func filterBatches(recordIds []string) [][]string {
+	var batches [][]string
+	var batch []string
+	length := 0
+	for _, recordId := range recordIds {
+		// Every term is quoted and prefixed with a ?, and separated from the previous one by a space
+		termLength := len(fmt.Sprintf("?%q", recordId)) + 1
+		if len(batch) > 0 && length+termLength > filterPatternMaxLength+1 {
+			batches = append(batches, batch)
+			batch = nil
+			length = 0
+		}
+		batch = append(batch, recordId)
+		length += termLength
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// Validate logs in CloudWatch with FilterLogEvents, which only returns the events holding the input records.
+// Rather than reading every event of the log streams, the record IDs are searched for with filter patterns, which is
+// much cheaper when only a few records are checked, e.g. the missing records of an earlier run read from EXPECTED_IDS_FILE,
+// but takes a call per filterPatternMaxLength characters of record IDs. Only the events holding one of the record IDs
+// of their pattern are counted, an ID found within the payload of another record is not.
+// Similar logic as GetLogEvents validation, including the delays and returning the records found so far once ctx is done.
+func validate_cloudwatch_filter(ctx context.Context, cwClient cwAPI, logGroup string, logStreams []string, inputMap *RecordMap, settings *validatorSettings) (int, error) {
+	cwRecoredCounter := 0
+
+	var recordIds []string
+	inputMap.each(func(recordId string, occurrences int) {
+		recordIds = append(recordIds, recordId)
+	})
+	batches := filterBatches(recordIds)
+	logrus.Infof("Searching %d records in log group %q with %d filter patterns", len(recordIds), logGroup, len(batches))
+
+	for start := 0; start < len(logStreams); start += filterMaxLogStreams {
+		end := start + filterMaxLogStreams
+		if end > len(logStreams) {
+			end = len(logStreams)
+		}
+		for _, batch := range batches {
+			if ctx.Err() != nil {
+				return cwRecoredCounter, nil
+			}
+			found, err := filterCloudWatchEvents(ctx, cwClient, logGroup, logStreams[start:end], batch, inputMap, settings)
+			cwRecoredCounter += found
+			if err != nil {
+				return cwRecoredCounter, err
+			}
+		}
+	}
+
+	return cwRecoredCounter, nil
+}
+
+// Counts the events of the log streams holding a batch of record IDs, page by page
+func filterCloudWatchEvents(ctx context.Context, cwClient cwAPI, logGroup string, logStreams []string, recordIds []string, inputMap *RecordMap, settings *validatorSettings) (int, error) {
+	cwRecoredCounter := 0
+
+	// Events of other records matching a pattern by chance are left out
+	searched := make(map[string]bool, len(recordIds))
+	for _, recordId := range recordIds {
+		searched[recordId] = true
+	}
+
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:   aws.String(logGroup),
+		LogStreamNames: aws.StringSlice(logStreams),
+		FilterPattern:  aws.String(filterPattern(recordIds)),
+	}
+	if !settings.window.start.IsZero() {
+		input.StartTime = aws.Int64(settings.window.start.UnixNano() / int64(time.Millisecond))
+	}
+	if !settings.window.end.IsZero() {
+		input.EndTime = aws.Int64(settings.window.end.UnixNano() / int64(time.Millisecond))
+	}
+
+	for {
+		var response *cloudwatchlogs.FilterLogEventsOutput
+		// retry for throttling exception and server side errors
+		err := retryWithBackoff(ctx, func() error {
+			// Retries count against the rate limit as well
+			if settings.cwLimiter != nil && !sleepWithContext(ctx, settings.cwLimiter.Reserve().Delay()) {
+				return ctx.Err()
+			}
+			var err error
+			response, err = cwClient.FilterLogEventsWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return cwRecoredCounter, fmt.Errorf("error occured to filter the log events of log group %q: %w", logGroup, err)
+		}
+
+		logrus.Debugf("Filtered %d events from log group %q", len(response.Events), logGroup)
+		for _, event := range response.Events {
+			log := aws.StringValue(event.Message)
+			recordId, ok := settings.parser.parse(log)
+			if !ok || !searched[recordId] {
+				// Skip logs without a record ID (count them as lost logs) and the records which were not searched for
+				continue
+			}
+			settings.audit.add(recordId, "cloudwatch://%s/%s@%d", logGroup, aws.StringValue(event.LogStreamName), aws.Int64Value(event.Timestamp))
+			cwRecoredCounter++
+			// Counting the occurrences of this record in the destination
+			countRecord(inputMap, recordId, 1, settings.parser)
+			if timestamp, ok := settings.parser.timestamp(log); ok {
+				settings.delays.addRecord(recordTiming{recordId: recordId, produced: timestamp, arrived: aws.MillisecondsTimeValue(event.IngestionTime)})
+			} else {
+				settings.delays.addArrival(aws.MillisecondsTimeValue(event.IngestionTime))
+			}
+		}
+
+		// Pages may be empty while the search goes on, only a missing token ends it
+		if response.NextToken == nil {
+			break
+		}
+		input.NextToken = response.NextToken
+	}
+
+	return cwRecoredCounter, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/stretchr/testify/assert"
+)
+
+// Quoted terms of a filter pattern
+var filterTermRegex = regexp.MustCompile(`"([^"]*)"`)
+
+// Serves the events of the log streams matching any term of the filter pattern, one event per page
+type mockCWFilter struct {
+	cwAPI
+	streams map[string][]string
+	// Filter pattern of every search, and the number of calls including the following pages
+	patterns []string
+	calls    int
+}
+
+func (m *mockCWFilter) FilterLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, opts ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	m.calls++
+	pattern := aws.StringValue(input.FilterPattern)
+	if input.NextToken == nil {
+		m.patterns = append(m.patterns, pattern)
+	}
+
+	var events []*cloudwatchlogs.FilteredLogEvent
+	for _, logStream := range aws.StringValueSlice(input.LogStreamNames) {
+		for _, log := range m.streams[logStream] {
+			for _, term := range filterTermRegex.FindAllStringSubmatch(pattern, -1) {
+				if strings.Contains(log, term[1]) {
+					events = append(events, &cloudwatchlogs.FilteredLogEvent{
+						LogStreamName: aws.String(logStream),
+						Message:       aws.String(log),
+						Timestamp:     aws.Int64(1639151837578),
+						IngestionTime: aws.Int64(1639151837578),
+					})
+					break
+				}
+			}
+		}
+	}
+
+	page := 0
+	if input.NextToken != nil {
+		page, _ = strconv.Atoi(aws.StringValue(input.NextToken))
+	}
+	output := &cloudwatchlogs.FilterLogEventsOutput{}
+	if page < len(events) {
+		output.Events = events[page : page+1]
+	}
+	if page+1 < len(events) {
+		output.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	return output, nil
+}
+
+func TestFilterBatches(t *testing.T) {
+	// Test case 1: a single record ID is matched as is
+	assert.Equal(t, `"10000000"`, filterPattern([]string{"10000000"}))
+	assert.Equal(t, `?"10000000" ?"10000001"`, filterPattern([]string{"10000000", "10000001"}))
+
+	// Test case 2: the record IDs are split into patterns as long as allowed, each ID in one of them
+	var recordIds []string
+	for i := 0; i < 200; i++ {
+		recordIds = append(recordIds, strconv.Itoa(idCounterBase+i))
+	}
+	batches := filterBatches(recordIds)
+	var batched []string
+	for _, batch := range batches {
+		assert.LessOrEqual(t, len(filterPattern(batch)), filterPatternMaxLength)
+		batched = append(batched, batch...)
+	}
+	assert.Equal(t, recordIds, batched)
+	// Every term takes 11 characters and a space, only the last one without it
+	assert.Equal(t, (filterPatternMaxLength+1)/12, len(batches[0]))
+	assert.Len(t, batches, 3)
+
+	// Test case 3: no record IDs
+	assert.Empty(t, filterBatches(nil))
+}
+
+func TestValidateCloudWatchFilter(t *testing.T) {
+	client := &mockCWFilter{streams: map[string][]string{
+		"stream-1": append(producerLogs("10000000", "10000002"), "10000005_1639151827578_10000001"),
+		"stream-2": producerLogs("10000000", "10000007"),
+	}}
+
+	// Test case 1: only the events of the input records are counted, across the streams and pages
+	inputMap := newInputMap(3)
+	found, err := validate_cloudwatch_filter(context.Background(), client, "group", []string{"stream-1", "stream-2"}, inputMap, &validatorSettings{
+		parser: newRecordIdParser(defaultRecordIdLength),
+		delays: &DelayStats{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, map[string]int{"10000000": 2, "10000001": 0, "10000002": 1}, inputMap.toMap())
+	assert.Equal(t, []string{`?"10000000" ?"10000001" ?"10000002"`}, client.patterns)
+	assert.Equal(t, 4, client.calls)
+
+	// Test case 2: the log streams are searched by at most filterMaxLogStreams at once
+	client = &mockCWFilter{streams: map[string][]string{"stream-0": producerLogs("10000000")}}
+	var logStreams []string
+	for i := 0; i <= filterMaxLogStreams; i++ {
+		logStreams = append(logStreams, fmt.Sprintf("stream-%d", i))
+	}
+	found, err = validate_cloudwatch_filter(context.Background(), client, "group", logStreams, newInputMap(1), &validatorSettings{
+		parser: newRecordIdParser(defaultRecordIdLength),
+		delays: &DelayStats{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, found)
+	assert.Len(t, client.patterns, 2)
+}
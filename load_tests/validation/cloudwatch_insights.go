@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Logs Insights returns at most this many rows per query
+	insightsMaxResults = 10000
+	insightsPollPeriod = 1 * time.Second
+)
+
+// Validate logs in CloudWatch with Logs Insights.
+// The record IDs are parsed and counted server side, so only one row per distinct record ID is transferred.
+// A query that hits the Logs Insights row limit is split into ten queries by the next digit of the (numeric) record ID.
+// Delivery delays are not measured in this mode since individual events are never retrieved.
+// The queries cover the window, or the whole retention of the log group if it is unbounded.
+func validate_cloudwatch_insights(ctx context.Context, cwClient cwAPI, logGroup string, logStreams []string, window TimeWindow, inputMap *RecordMap, parser *RecordIdParser) (int, error) {
+	cwRecoredCounter := 0
+
+	// Only the streams being validated are counted, not the whole log group
+	quoted := make([]string, 0, len(logStreams))
+	for _, logStream := range logStreams {
+		quoted = append(quoted, strconv.Quote(logStream))
+	}
+	baseQuery := fmt.Sprintf("filter @logStream in [%s] | parse @message /%s/", strings.Join(quoted, ", "), parser.insightsPattern())
+
+	prefixes := []string{""}
+	for len(prefixes) > 0 && ctx.Err() == nil {
+		prefix := prefixes[0]
+		prefixes = prefixes[1:]
+
+		query := baseQuery
+		if prefix != "" {
+			query += fmt.Sprintf(" | filter %s like /^%s/", recordIdGroup, prefix)
+		}
+		query += fmt.Sprintf(" | stats count(*) as occurrences by %s | limit %d", recordIdGroup, insightsMaxResults)
+
+		queryStart := time.Now()
+		rows, err := runInsightsQuery(ctx, cwClient, logGroup, window, query)
+		if err != nil {
+			return cwRecoredCounter, err
+		}
+		logrus.Infof("Logs Insights query for record IDs starting with %q returned %d rows in %s", prefix, len(rows), time.Since(queryStart).Round(time.Millisecond))
+		if len(rows) >= insightsMaxResults {
+			// Possibly truncated, count the same records again in smaller slices
+			for digit := 0; digit <= 9; digit++ {
+				prefixes = append(prefixes, prefix+strconv.Itoa(digit))
+			}
+			continue
+		}
+
+		for _, row := range rows {
+			var recordId string
+			occurrences := 0
+			for _, field := range row {
+				switch aws.StringValue(field.Field) {
+				case recordIdGroup:
+					recordId = aws.StringValue(field.Value)
+				case "occurrences":
+					occurrences, _ = strconv.Atoi(aws.StringValue(field.Value))
+				}
+			}
+
+			// Events without a record ID are grouped under an empty one (count them as lost logs)
+			if recordId == "" {
+				parser.countUnparseable(occurrences)
+				continue
+			}
+			cwRecoredCounter += occurrences
+			// Counting the occurrences of this record in the destination
+			countRecord(inputMap, recordId, occurrences, parser)
+		}
+	}
+
+	return cwRecoredCounter, nil
+}
+
+// Runs a Logs Insights query over the window and waits for its results.
+// No rows and no error are returned if ctx is done before the query completes.
+func runInsightsQuery(ctx context.Context, cwClient cwAPI, logGroup string, window TimeWindow, query string) ([][]*cloudwatchlogs.ResultField, error) {
+	// Queries take whole seconds, an unbounded window spans the whole retention of the log group
+	startTime, endTime := int64(0), time.Now().Unix()
+	if !window.start.IsZero() {
+		startTime = window.start.Unix()
+	}
+	if !window.end.IsZero() {
+		endTime = window.end.Unix()
+	}
+
+	var started *cloudwatchlogs.StartQueryOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		started, err = cwClient.StartQueryWithContext(ctx, &cloudwatchlogs.StartQueryInput{
+			LogGroupName: aws.String(logGroup),
+			QueryString:  aws.String(query),
+			StartTime:    aws.Int64(startTime),
+			EndTime:      aws.Int64(endTime),
+			Limit:        aws.Int64(insightsMaxResults),
+		})
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error occured to start the Logs Insights query on log group %q: %w", logGroup, err)
+	}
+
+	for sleepWithContext(ctx, insightsPollPeriod) {
+		var response *cloudwatchlogs.GetQueryResultsOutput
+		err := retryWithBackoff(ctx, func() error {
+			var err error
+			response, err = cwClient.GetQueryResultsWithContext(ctx, &cloudwatchlogs.GetQueryResultsInput{
+				QueryId: started.QueryId,
+			})
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, fmt.Errorf("error occured to get the Logs Insights query results of log group %q: %w", logGroup, err)
+		}
+
+		switch aws.StringValue(response.Status) {
+		case cloudwatchlogs.QueryStatusComplete:
+			return response.Results, nil
+		case cloudwatchlogs.QueryStatusScheduled, cloudwatchlogs.QueryStatusRunning:
+			continue
+		default:
+			return nil, fmt.Errorf("Logs Insights query on log group %q ended with status %s", logGroup, aws.StringValue(response.Status))
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Allowed increase of a metric over the baseline in the comparison mode, in percent
+const defaultRegressionTolerance = 10.0
+
+// A metric of a candidate run compared to a baseline run, lower is better for all of them
+type Comparison struct {
+	Destination string  `json:"destination,omitempty"`
+	Metric      string  `json:"metric"`
+	Baseline    float64 `json:"baseline"`
+	Candidate   float64 `json:"candidate"`
+	Delta       float64 `json:"delta"`
+	// Change in percent of the baseline, not set when the baseline is zero
+	PercentChange *float64 `json:"percent_change"`
+	Regressed     bool     `json:"regressed"`
+}
+
+// Reads the results saved from a run with the JSON output format, one object per destination
+func readResults(path string) ([]Results, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var results []Results
+	decoder := json.NewDecoder(file)
+	for {
+		var result Results
+		err := decoder.Decode(&result)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("results file %q is not the JSON output of a run: %w", path, err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("results file %q is empty", path)
+	}
+	return results, nil
+}
+
+// Compares the loss, duplicates and delay percentiles of the candidate results to the baseline results of the same destination.
+// A metric regressed if it increased by more than tolerance percent, or at all from a baseline of zero.
+func compareResults(baseline []Results, candidate []Results, tolerance float64) ([]Comparison, error) {
+	candidates := make(map[string]Results, len(candidate))
+	for _, result := range candidate {
+		candidates[result.Destination] = result
+	}
+
+	var comparisons []Comparison
+	for _, b := range baseline {
+		c, ok := candidates[b.Destination]
+		if !ok {
+			return nil, fmt.Errorf("the candidate has no results for destination %q", b.Destination)
+		}
+
+		metrics := []struct {
+			name      string
+			baseline  float64
+			candidate float64
+		}{
+			{"percent_loss", b.PercentLoss, c.PercentLoss},
+			{"duplicate", float64(b.Duplicate), float64(c.Duplicate)},
+			{"delay_p50_ms", float64(b.DelayP50Ms), float64(c.DelayP50Ms)},
+			{"delay_p90_ms", float64(b.DelayP90Ms), float64(c.DelayP90Ms)},
+			{"delay_p99_ms", float64(b.DelayP99Ms), float64(c.DelayP99Ms)},
+		}
+		for _, metric := range metrics {
+			comparison := Comparison{
+				Destination: b.Destination,
+				Metric:      metric.name,
+				Baseline:    metric.baseline,
+				Candidate:   metric.candidate,
+				Delta:       metric.candidate - metric.baseline,
+			}
+			if metric.baseline != 0 {
+				change := comparison.Delta * 100 / metric.baseline
+				comparison.PercentChange = &change
+				comparison.Regressed = change > tolerance
+			} else {
+				comparison.Regressed = comparison.Delta > 0
+			}
+			comparisons = append(comparisons, comparison)
+		}
+	}
+
+	return comparisons, nil
+}
+
+// Prints the comparisons in the same format as the results
+func print_comparisons(comparisons []Comparison, outputFormat string) {
+	if outputFormat == "json" {
+		output, err := json.Marshal(comparisons)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to marshal the comparison: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	for _, comparison := range comparisons {
+		metric := comparison.Metric
+		if comparison.Destination != "" {
+			metric = comparison.Destination + "_" + metric
+		}
+		change := "n/a"
+		if comparison.PercentChange != nil {
+			change = fmt.Sprintf("%+.1f%%", *comparison.PercentChange)
+		}
+		regressed := ""
+		if comparison.Regressed {
+			regressed = " REGRESSED"
+		}
+		fmt.Printf("%s,  %v -> %v (%+g, %s)%s\n", metric, comparison.Baseline, comparison.Candidate, comparison.Delta, change, regressed)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compare")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Test case 1: one object per destination
+	path := filepath.Join(dir, "results.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{\"destination\":\"s3\",\"percent_loss\":1}\n{\"destination\":\"cloudwatch\",\"percent_loss\":2}\n"), 0644))
+	results, err := readResults(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "cloudwatch", results[1].Destination)
+	assert.Equal(t, 2.0, results[1].PercentLoss)
+
+	// Test case 2: text output
+	path = filepath.Join(dir, "results.txt")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("total_input,  10\n"), 0644))
+	_, err = readResults(path)
+	assert.Error(t, err)
+
+	// Test case 3: empty file
+	path = filepath.Join(dir, "empty.json")
+	assert.NoError(t, ioutil.WriteFile(path, nil, 0644))
+	_, err = readResults(path)
+	assert.Error(t, err)
+}
+
+func TestCompareResults(t *testing.T) {
+	baseline := []Results{{PercentLoss: 0, Duplicate: 10, DelayP50Ms: 100, DelayP90Ms: 200, DelayP99Ms: 1000}}
+
+	// Test case 1: within the tolerance
+	comparisons, err := compareResults(baseline, []Results{{PercentLoss: 0, Duplicate: 11, DelayP50Ms: 90, DelayP90Ms: 210, DelayP99Ms: 1000}}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(comparisons))
+	for _, comparison := range comparisons {
+		assert.False(t, comparison.Regressed, comparison.Metric)
+	}
+	assert.Equal(t, "delay_p50_ms", comparisons[2].Metric)
+	assert.Equal(t, -10.0, comparisons[2].Delta)
+	assert.Equal(t, -10.0, *comparisons[2].PercentChange)
+	assert.Nil(t, comparisons[0].PercentChange)
+
+	// Test case 2: regressions beyond the tolerance, and from a baseline of zero
+	comparisons, err = compareResults(baseline, []Results{{PercentLoss: 1, Duplicate: 10, DelayP50Ms: 100, DelayP90Ms: 200, DelayP99Ms: 1200}}, 10)
+	assert.NoError(t, err)
+	assert.True(t, comparisons[0].Regressed)
+	assert.False(t, comparisons[1].Regressed)
+	assert.True(t, comparisons[4].Regressed)
+
+	// Test case 3: destination missing from the candidate
+	_, err = compareResults([]Results{{Destination: "s3"}}, []Results{{Destination: "cloudwatch"}}, 10)
+	assert.Error(t, err)
+}
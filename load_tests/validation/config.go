@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys of the config file standing in for the --total-records and --log-delay flags
+const (
+	configTotalRecords = "TOTAL_RECORDS"
+	configLogDelay     = "LOG_DELAY"
+)
+
+// Reads a YAML (or JSON) config file mapping environment variable names to their values, e.g.
+//
+//	AWS_REGION: us-west-2
+//	DESTINATION: s3
+//	WORKER_COUNT: 20
+//	LOG_PREFIX: [logs/a/, logs/b/]
+//
+// Lists are joined with commas, for the variables which accept several values.
+func loadConfig(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("config file %q is neither YAML nor JSON: %w", path, err)
+	}
+
+	config := make(map[string]string, len(values))
+	for key, value := range values {
+		switch v := value.(type) {
+		case nil:
+			config[key] = ""
+		case string:
+			config[key] = v
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			config[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("value of %q in config file %q must be a scalar or a list", key, path)
+		default:
+			config[key] = fmt.Sprint(v)
+		}
+	}
+	return config, nil
+}
+
+// Sets the environment variables of the config which are not already set, so that the environment takes precedence.
+// Returns the names of the variables which were overridden by the environment.
+func applyConfig(config map[string]string) ([]string, error) {
+	var overridden []string
+	for key, value := range config {
+		if key == configTotalRecords || key == configLogDelay {
+			continue
+		}
+		if _, ok := os.LookupEnv(key); ok {
+			overridden = append(overridden, key)
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return nil, fmt.Errorf("unable to set %q from the config file: %w", key, err)
+		}
+	}
+	sort.Strings(overridden)
+	return overridden, nil
+}
+
+// Returns the positional argument at index, or the value of key in the config if the argument is missing
+func positionalArg(args []string, index int, config map[string]string, key string) string {
+	if index < len(args) {
+		return args[index]
+	}
+	return config[key]
+}
+
+// Returns true if the named flag was given on the command line, even with its default value
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Test case 1: YAML with numbers and lists
+	path := writeConfig(t, dir, "config.yaml", "DESTINATION: s3\nWORKER_COUNT: 20\nMAX_ALLOWED_LOSS_PERCENT: 0.5\nLOG_PREFIX: [logs/a/, logs/b/]\nTOTAL_RECORDS: 1000\n")
+	config, err := loadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"DESTINATION":              "s3",
+		"WORKER_COUNT":             "20",
+		"MAX_ALLOWED_LOSS_PERCENT": "0.5",
+		"LOG_PREFIX":               "logs/a/,logs/b/",
+		"TOTAL_RECORDS":            "1000",
+	}, config)
+
+	// Test case 2: JSON
+	path = writeConfig(t, dir, "config.json", `{"DESTINATION": "cloudwatch", "CHECK_ORDERING": true}`)
+	config, err = loadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"DESTINATION": "cloudwatch", "CHECK_ORDERING": "true"}, config)
+
+	// Test case 3: nested values are rejected
+	path = writeConfig(t, dir, "nested.yaml", "DESTINATION:\n  name: s3\n")
+	_, err = loadConfig(path)
+	assert.Error(t, err)
+
+	// Test case 4: invalid file
+	path = writeConfig(t, dir, "invalid.yaml", "DESTINATION: [s3\n")
+	_, err = loadConfig(path)
+	assert.Error(t, err)
+
+	// Test case 5: missing file
+	_, err = loadConfig(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestApplyConfig(t *testing.T) {
+	os.Setenv("CONFIG_TEST_SET", "env")
+	os.Unsetenv("CONFIG_TEST_UNSET")
+	os.Unsetenv(configTotalRecords)
+	defer os.Unsetenv("CONFIG_TEST_SET")
+	defer os.Unsetenv("CONFIG_TEST_UNSET")
+
+	overridden, err := applyConfig(map[string]string{
+		"CONFIG_TEST_SET":   "file",
+		"CONFIG_TEST_UNSET": "file",
+		configTotalRecords:  "1000",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CONFIG_TEST_SET"}, overridden)
+	assert.Equal(t, "env", os.Getenv("CONFIG_TEST_SET"))
+	assert.Equal(t, "file", os.Getenv("CONFIG_TEST_UNSET"))
+
+	// The positional arguments are not environment variables
+	_, ok := os.LookupEnv(configTotalRecords)
+	assert.False(t, ok)
+}
+
+func TestPositionalArg(t *testing.T) {
+	config := map[string]string{configTotalRecords: "1000", configLogDelay: "1m"}
+
+	assert.Equal(t, "500", positionalArg([]string{"500", "2m"}, 0, config, configTotalRecords))
+	assert.Equal(t, "2m", positionalArg([]string{"500", "2m"}, 1, config, configLogDelay))
+	assert.Equal(t, "1m", positionalArg([]string{"500"}, 1, config, configLogDelay))
+	assert.Equal(t, "", positionalArg(nil, 0, map[string]string{}, configTotalRecords))
+}
+
+func TestIsFlagSet(t *testing.T) {
+	flags := flag.NewFlagSet("validation", flag.ContinueOnError)
+	flags.Int("total-records", 0, "")
+	flags.String("log-delay", "", "")
+
+	assert.NoError(t, flags.Parse([]string{"--total-records", "0", "1000"}))
+	assert.True(t, isFlagSet(flags, "total-records"))
+	assert.False(t, isFlagSet(flags, "log-delay"))
+	assert.Equal(t, []string{"1000"}, flags.Args())
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Ways of combining the results of several destinations into one
+const (
+	// A record is delivered if it reached at least one of the destinations
+	combineAny = "any"
+	// A record is delivered only if it reached every destination
+	combineAll = "all"
+)
+
+// Records found in a single destination, each destination counts the occurrences of the input records on its own
+type destinationResult struct {
+	destination string
+	found       int
+	inputMap    *RecordMap
+	parser      *RecordIdParser
+	delays      *DelayStats
+	ordering    *OrderStats
+	// Number and size of the S3 objects validated, nil for other destinations
+	objects *s3Totals
+	// Input records found in the error output of the destination, nil if it is not validated
+	errorRecords *RecordMap
+	// Records found in each log group, only set for CloudWatch with several log groups
+	logGroups []LogGroupRecords
+	// Time until every input record was found when polling, 0 if not polled or some records were never found
+	completion time.Duration
+	// Only the input records were searched for, so that polling can search the records still missing alone
+	searched bool
+	// Retries of the API calls while the destination was validated, over every pass when polling
+	retries RetryStats
+}
+
+// Returns the value of the environment variable scoped to the destination, e.g. S3_LOG_PREFIX,
+// or of the unscoped one if it is not set, so that each destination of a run can have its own settings
+func destinationEnv(destination string, name string) string {
+	if value, ok := os.LookupEnv(strings.ToUpper(destination) + "_" + name); ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// Returns true if nothing at all was read from the destination, not even logs without a record ID or foreign records,
+// which points at a destination configured to the wrong place or read before the test delivered to it
+func (r *destinationResult) empty() bool {
+	if r.found > 0 || r.parser.unparseableCount() > 0 || r.parser.malformedCount() > 0 || r.parser.foreignCount() > 0 {
+		return false
+	}
+	return r.objects == nil || r.objects.objects == 0
+}
+
+// Returns the region of the run, and the regions of S3 and CloudWatch which may differ from it, e.g. to validate
+// cross region delivery. S3_REGION and CW_REGION fall back to AWS_REGION, and all of them to "" which leaves the
+// region to the default of the SDK, e.g. for a run which only reads local directories.
+func getRegions() (region string, s3Region string, cwRegion string) {
+	region = os.Getenv(envAWSRegion)
+	s3Region = os.Getenv(envS3Region)
+	if s3Region == "" {
+		s3Region = region
+	}
+	cwRegion = os.Getenv(envCWRegion)
+	if cwRegion == "" {
+		cwRegion = region
+	}
+	return region, s3Region, cwRegion
+}
+
+// Returns the region the records of a destination are read from, or "" if it is not read from AWS
+func destinationRegion(destination string, region string, s3Region string, cwRegion string) string {
+	switch destination {
+	case "s3", "firehose", "s3tables":
+		return s3Region
+	case "cloudwatch":
+		return cwRegion
+	case "localdir", "http":
+		return ""
+	}
+	return region
+}
+
+// Returns the environment variables which select where the records of a destination are read from
+func destinationLocationEnvs(destination string) []string {
+	var names []string
+	switch destination {
+	case "s3", "firehose":
+		names = []string{envS3Bucket, envLogPrefix}
+	case "cloudwatch":
+		names = []string{envCWLogGroup, envLogPrefix, envCWStreams, envCWPrefix}
+	case "kinesis":
+		names = []string{envKinesisName}
+	case "opensearch":
+		names = []string{envOSEndpoint, envOSIndex}
+	case "dynamodb":
+		names = []string{envDynamoTable}
+	case "http":
+		names = []string{envQueryURL}
+	case "sqs":
+		names = []string{envSQSQueueUrl}
+	case "s3tables":
+		names = []string{envIcebergMeta}
+	case "localdir":
+		names = []string{envLocalDir}
+	}
+	// Records outside of the time window are skipped before they are read
+	for _, name := range []string{envStartTime, envEndTime} {
+		if os.Getenv(name) != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Counts occurrences of a record found in a destination, returns true if it was found for the first time.
+// Records which are not input records are left out, unless the parser only validates duplicates and the map starts empty.
+func countRecord(inputMap *RecordMap, recordId string, occurrences int, parser *RecordIdParser) bool {
+	previous, ok := inputMap.get(recordId)
+	if !ok && !parser.duplicatesOnly {
+		return false
+	}
+	inputMap.set(recordId, previous+occurrences)
+	return previous == 0
+}
+
+// Returns a copy of the parser with its own counters
+func (p *RecordIdParser) clone() *RecordIdParser {
+	return &RecordIdParser{
+		length:         p.length,
+		regex:          p.regex,
+		group:          p.group,
+		timestampGroup: p.timestampGroup,
+		strict:         p.strict,
+		skipCorrupt:    p.skipCorrupt,
+		raw:            p.raw,
+		parquet:        p.parquet,
+		field:          p.field,
+		path:           p.path,
+		delimiter:      p.delimiter,
+		concatenated:   p.concatenated,
+		base64:         p.base64,
+		firehoseErrors: p.firehoseErrors,
+		minId:          p.minId,
+		maxId:          p.maxId,
+		expectedIds:    p.expectedIds,
+		duplicatesOnly: p.duplicatesOnly,
+		payloads:       p.payloads,
+		expectedLength: p.expectedLength,
+	}
+}
+
+// Combines the results of several destinations into the results of a single one.
+// A record counts as delivered as often as in the destination which has most (any) or fewest (all) of it.
+// Records which are not part of the input are left out, as they can not be matched across destinations.
+func combineResults(results []*destinationResult, mode string) *destinationResult {
+	combined := &destinationResult{
+		destination: results[0].destination,
+		inputMap:    results[0].inputMap.reset(),
+		parser:      &RecordIdParser{},
+		delays:      &DelayStats{},
+	}
+	names := make([]string, 0, len(results))
+	for _, result := range results {
+		names = append(names, result.destination)
+	}
+	combined.destination = strings.Join(names, "+")
+
+	results[0].inputMap.each(func(recordId string, occurrences int) {
+		for _, result := range results[1:] {
+			other, _ := result.inputMap.get(recordId)
+			if (mode == combineAny && other > occurrences) || (mode == combineAll && other < occurrences) {
+				occurrences = other
+			}
+		}
+		combined.inputMap.set(recordId, occurrences)
+		combined.found += occurrences
+	})
+
+	for _, result := range results {
+		if result.delays.produced != nil && combined.delays.produced == nil {
+			combined.delays.produced = make(map[string]time.Time, combined.inputMap.len())
+		}
+		combined.parser.countUnparseable(result.parser.unparseableCount())
+		combined.parser.malformed += int64(result.parser.malformedCount())
+		combined.parser.foreign += int64(result.parser.foreignCount())
+		if payloads := result.parser.payloadCounts(); payloads != nil {
+			combined.parser.payloads = result.parser.payloads
+			combined.parser.expectedLength = result.parser.expectedLength
+			combined.parser.truncated += int64(payloads.Truncated)
+			combined.parser.corrupted += int64(payloads.Corrupted)
+		}
+		combined.delays.merge(result.delays)
+		combined.retries.retries += result.retries.retries
+		combined.retries.backoff += result.retries.backoff
+		if result.completion > combined.completion {
+			combined.completion = result.completion
+		}
+		if result.ordering != nil {
+			if combined.ordering == nil {
+				combined.ordering = newOrderStats()
+			}
+			for stream, outOfOrder := range result.ordering.outOfOrder {
+				combined.ordering.add(result.destination+"/"+stream, outOfOrder)
+			}
+		}
+		if result.objects != nil {
+			if combined.objects == nil {
+				combined.objects = &s3Totals{}
+			}
+			combined.objects.add(*result.objects)
+		}
+		combined.logGroups = append(combined.logGroups, result.logGroups...)
+		if result.errorRecords != nil {
+			if combined.errorRecords == nil {
+				combined.errorRecords = combined.inputMap.reset()
+			}
+			result.errorRecords.each(func(recordId string, occurrences int) {
+				if previous, ok := combined.errorRecords.get(recordId); ok {
+					combined.errorRecords.set(recordId, previous+occurrences)
+				}
+			})
+		}
+	}
+	// Polled destinations are complete once the slowest of them is, and not at all if any of them is not
+	for _, result := range results {
+		if result.completion == 0 {
+			combined.completion = 0
+		}
+	}
+
+	return combined
+}
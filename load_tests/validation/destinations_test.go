@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDestinationEnv(t *testing.T) {
+	os.Setenv(envLogPrefix, "shared")
+	os.Setenv("CLOUDWATCH_"+envLogPrefix, "stream")
+	defer os.Unsetenv(envLogPrefix)
+	defer os.Unsetenv("CLOUDWATCH_" + envLogPrefix)
+
+	assert.Equal(t, "shared", destinationEnv("s3", envLogPrefix))
+	assert.Equal(t, "stream", destinationEnv("cloudwatch", envLogPrefix))
+}
+
+func TestCombineResults(t *testing.T) {
+	produced := time.Unix(1639151827, 0)
+	s3Delays := &DelayStats{}
+	s3Delays.addRecord(recordTiming{produced: produced, arrived: produced.Add(2 * time.Second)})
+	cwDelays := &DelayStats{}
+	cwDelays.addRecord(recordTiming{produced: produced.Add(time.Second), arrived: produced.Add(5 * time.Second)})
+
+	s3Parser := newRecordIdParser(8)
+	s3Parser.countUnparseable(1)
+	cwOrdering := newOrderStats()
+	cwOrdering.add("stream", 2)
+
+	results := func() []*destinationResult {
+		return []*destinationResult{
+			{
+				destination: "s3",
+				found:       4,
+				inputMap:    recordMapOf(map[string]int{"10000000": 2, "10000001": 1, "10000002": 0}),
+				parser:      s3Parser,
+				delays:      s3Delays,
+			},
+			{
+				destination: "cloudwatch",
+				found:       3,
+				inputMap:    recordMapOf(map[string]int{"10000000": 1, "10000001": 0, "10000002": 1}),
+				parser:      newRecordIdParser(8),
+				delays:      cwDelays,
+				ordering:    cwOrdering,
+			},
+		}
+	}
+
+	// Test case 1: delivered to any destination
+	combined := combineResults(results(), combineAny)
+	assert.Equal(t, "s3+cloudwatch", combined.destination)
+	assert.Equal(t, map[string]int{"10000000": 2, "10000001": 1, "10000002": 1}, combined.inputMap.toMap())
+	assert.Equal(t, 4, combined.found)
+	assert.Equal(t, 1, combined.parser.unparseableCount())
+	assert.Equal(t, 2, combined.delays.count)
+	assert.Equal(t, 4*time.Second, combined.delays.max)
+	assert.Equal(t, time.Second, combined.delays.span())
+	assert.Equal(t, 2, combined.ordering.outOfOrder["cloudwatch/stream"])
+
+	// Test case 2: delivered to all destinations
+	combined = combineResults(results(), combineAll)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 0, "10000002": 0}, combined.inputMap.toMap())
+	assert.Equal(t, 1, combined.found)
+	assert.Equal(t, time.Duration(0), combined.completion)
+
+	// Test case 3: polled destinations complete with the slowest of them
+	polled := results()
+	polled[0].completion = 2 * time.Second
+	polled[1].completion = 3 * time.Second
+	assert.Equal(t, 3*time.Second, combineResults(polled, combineAny).completion)
+	polled[1].completion = 0
+	assert.Equal(t, time.Duration(0), combineResults(polled, combineAny).completion)
+}
+
+func TestDestinationResultEmpty(t *testing.T) {
+	// Test case 1: nothing read
+	result := &destinationResult{parser: newRecordIdParser(8)}
+	assert.True(t, result.empty())
+	result.objects = &s3Totals{}
+	assert.True(t, result.empty())
+
+	// Test case 2: objects without any log read
+	result.objects = &s3Totals{objects: 1}
+	assert.False(t, result.empty())
+
+	// Test case 3: logs read without an input record
+	result = &destinationResult{parser: newRecordIdParser(8)}
+	result.parser.foreign = 1
+	assert.False(t, result.empty())
+}
+
+func TestDestinationLocationEnvs(t *testing.T) {
+	os.Unsetenv(envStartTime)
+	os.Unsetenv(envEndTime)
+
+	// Test case 1: where the records of a destination are read from
+	assert.Equal(t, []string{envS3Bucket, envLogPrefix}, destinationLocationEnvs("firehose"))
+	assert.Equal(t, []string{envSQSQueueUrl}, destinationLocationEnvs("sqs"))
+
+	// Test case 2: a time window skips records as well
+	os.Setenv(envStartTime, "2021-12-10T15:57:07Z")
+	defer os.Unsetenv(envStartTime)
+	assert.Equal(t, []string{envKinesisName, envStartTime}, destinationLocationEnvs("kinesis"))
+}
+
+func TestDestinationRegion(t *testing.T) {
+	// Test case 1: S3 and CloudWatch may be in their own regions
+	assert.Equal(t, "us-east-1", destinationRegion("firehose", "us-west-2", "us-east-1", "eu-west-1"))
+	assert.Equal(t, "eu-west-1", destinationRegion("cloudwatch", "us-west-2", "us-east-1", "eu-west-1"))
+
+	// Test case 2: other AWS destinations are in the region of the run
+	assert.Equal(t, "us-west-2", destinationRegion("kinesis", "us-west-2", "us-east-1", "eu-west-1"))
+
+	// Test case 3: destinations which are not read from AWS have no region
+	assert.Equal(t, "", destinationRegion("localdir", "us-west-2", "us-east-1", "eu-west-1"))
+}
+
+func TestGetRegions(t *testing.T) {
+	defer os.Unsetenv(envAWSRegion)
+	defer os.Unsetenv(envS3Region)
+	defer os.Unsetenv(envCWRegion)
+
+	// Region of each destination, in order of the per-destination variable, AWS_REGION, then the default of the SDK
+	tests := []struct {
+		name      string
+		awsRegion string
+		s3Region  string
+		cwRegion  string
+		expected  map[string]string
+	}{
+		{
+			name:      "per-destination regions",
+			awsRegion: "us-west-2",
+			s3Region:  "us-east-1",
+			cwRegion:  "eu-west-1",
+			expected:  map[string]string{"s3": "us-east-1", "firehose": "us-east-1", "cloudwatch": "eu-west-1", "kinesis": "us-west-2", "http": ""},
+		},
+		{
+			name:      "fallback to AWS_REGION",
+			awsRegion: "us-west-2",
+			cwRegion:  "eu-west-1",
+			expected:  map[string]string{"s3": "us-west-2", "firehose": "us-west-2", "cloudwatch": "eu-west-1", "kinesis": "us-west-2", "http": ""},
+		},
+		{
+			name:     "per-destination region without AWS_REGION",
+			s3Region: "us-east-1",
+			expected: map[string]string{"s3": "us-east-1", "cloudwatch": "", "kinesis": ""},
+		},
+		{
+			name:     "default of the SDK",
+			expected: map[string]string{"s3": "", "cloudwatch": "", "kinesis": "", "localdir": ""},
+		},
+	}
+	for _, test := range tests {
+		os.Setenv(envAWSRegion, test.awsRegion)
+		os.Setenv(envS3Region, test.s3Region)
+		os.Setenv(envCWRegion, test.cwRegion)
+		region, s3Region, cwRegion := getRegions()
+		assert.Equal(t, test.awsRegion, region, test.name)
+		for destination, expected := range test.expected {
+			assert.Equal(t, expected, destinationRegion(destination, region, s3Region, cwRegion), "%s: %s", test.name, destination)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Modes of the prefix discovery
+const (
+	// Prints the discovered prefixes instead of the results
+	discoverList = "list"
+	// Validates the objects under all the discovered prefixes
+	discoverValidate = "validate"
+)
+
+// Prefixes discovered in a bucket, printed instead of the results in list mode
+type DiscoveredPrefixes struct {
+	Bucket   string   `json:"bucket"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// Lists the common prefixes one "/" level below each of the given parent prefixes of a bucket,
+// or below the root of the bucket if there is none. Objects directly under a parent are not covered by the result.
+func discover_s3_prefixes(ctx context.Context, s3Client s3API, bucket string, parents []string) ([]string, error) {
+	if len(parents) == 0 {
+		parents = []string{""}
+	}
+
+	var prefixes []string
+	for _, parent := range parents {
+		err := s3Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket:    aws.String(bucket),
+			Prefix:    aws.String(parent),
+			Delimiter: aws.String("/"),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, commonPrefix := range page.CommonPrefixes {
+				prefixes = append(prefixes, aws.StringValue(commonPrefix.Prefix))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error occured to list the common prefixes under %q in bucket %q: %w", parent, bucket, err)
+		}
+	}
+
+	return prefixes, nil
+}
+
+// Prints the discovered prefixes in the same format as the results
+func print_prefixes(discovered DiscoveredPrefixes, outputFormat string) {
+	if outputFormat == "json" {
+		output, err := json.Marshal(discovered)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to marshal the discovered prefixes: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	fmt.Println("bucket, ", discovered.Bucket)
+	for _, prefix := range discovered.Prefixes {
+		fmt.Println("prefix, ", prefix)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves the common prefixes of the keys one "/" level below the requested prefix, one page per prefix
+type mockS3Prefixes struct {
+	s3API
+	keys []string
+	err  error
+}
+
+func (m *mockS3Prefixes) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	seen := make(map[string]bool)
+	parent := aws.StringValue(input.Prefix)
+	for _, key := range m.keys {
+		if !strings.HasPrefix(key, parent) {
+			continue
+		}
+		i := strings.Index(key[len(parent):], aws.StringValue(input.Delimiter))
+		if i < 0 {
+			continue
+		}
+		prefix := key[:len(parent)+i+1]
+		if !seen[prefix] {
+			seen[prefix] = true
+			fn(&s3.ListObjectsV2Output{CommonPrefixes: []*s3.CommonPrefix{{Prefix: aws.String(prefix)}}}, false)
+		}
+	}
+	return nil
+}
+
+func TestDiscoverS3Prefixes(t *testing.T) {
+	client := &mockS3Prefixes{
+		keys: []string{"fluent-bit-logs/app/2021/object1", "fluent-bit-logs/app/2021/object2", "fluent-bit-logs/sidecar/object3", "other/object4", "object5"},
+	}
+
+	// Test case 1: root of the bucket
+	prefixes, err := discover_s3_prefixes(context.Background(), client, "bucket", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fluent-bit-logs/", "other/"}, prefixes)
+
+	// Test case 2: below the given parents
+	prefixes, err = discover_s3_prefixes(context.Background(), client, "bucket", []string{"fluent-bit-logs/", "other/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fluent-bit-logs/app/", "fluent-bit-logs/sidecar/"}, prefixes)
+
+	// Test case 3: listing error
+	client.err = errors.New("AccessDenied")
+	_, err = discover_s3_prefixes(context.Background(), client, "bucket", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Duplication results of a validation run which only validates duplicates, printed by print_duplicates.
+// Records are not compared to the input records, so nothing is reported about the loss.
+type DuplicateResults struct {
+	// Only set when several destinations are validated
+	Destination      string  `json:"destination,omitempty"`
+	TotalDestination int     `json:"total_destination"`
+	Unique           int     `json:"unique"`
+	Duplicate        int     `json:"duplicate"`
+	PercentDuplicate float64 `json:"percent_duplicate"`
+	// Number of records found exactly once, twice or more often, and the most occurrences of a single record
+	DeliveredOnce      int `json:"delivered_once"`
+	DeliveredTwice     int `json:"delivered_twice"`
+	DeliveredThreePlus int `json:"delivered_3_plus"`
+	MaxDeliveries      int `json:"max_deliveries"`
+	Unparseable        int `json:"unparseable"`
+	Malformed          int `json:"malformed"`
+	Foreign            int `json:"foreign"`
+}
+
+// Computes the duplication results from the records found in a destination, each of them counted with its occurrences
+func computeDuplicates(destination string, totalRecordFound int, recordMap *RecordMap, unparseable int, malformed int, foreign int) DuplicateResults {
+	results := DuplicateResults{
+		Destination:      destination,
+		TotalDestination: totalRecordFound,
+		Unparseable:      unparseable,
+		Malformed:        malformed,
+		Foreign:          foreign,
+	}
+	recordMap.each(func(recordId string, occurrences int) {
+		if occurrences == 0 {
+			return
+		}
+		results.Unique++
+		switch occurrences {
+		case 1:
+			results.DeliveredOnce++
+		case 2:
+			results.DeliveredTwice++
+		default:
+			results.DeliveredThreePlus++
+		}
+		if occurrences > results.MaxDeliveries {
+			results.MaxDeliveries = occurrences
+		}
+	})
+	results.Duplicate = totalRecordFound - results.Unique
+	if totalRecordFound > 0 {
+		results.PercentDuplicate = float64(results.Duplicate) * 100 / float64(totalRecordFound) // %
+	}
+	return results
+}
+
+// Prints the duplication results as "key,  value" lines, or as a single JSON object
+func print_duplicates(results DuplicateResults, outputFormat string) {
+	if outputFormat == "json" {
+		output, err := json.Marshal(results)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to marshal the results: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	if results.Destination != "" {
+		fmt.Println("destination, ", results.Destination)
+	}
+	fmt.Println("total_destination, ", results.TotalDestination)
+	fmt.Println("unique, ", results.Unique)
+	fmt.Println("duplicate, ", results.Duplicate)
+	fmt.Println("percent_duplicate, ", formatPercent(results.PercentDuplicate))
+	fmt.Println("delivered_once, ", results.DeliveredOnce)
+	fmt.Println("delivered_twice, ", results.DeliveredTwice)
+	fmt.Println("delivered_3_plus, ", results.DeliveredThreePlus)
+	fmt.Println("max_deliveries, ", results.MaxDeliveries)
+	fmt.Println("unparseable, ", results.Unparseable)
+	fmt.Println("malformed, ", results.Malformed)
+	fmt.Println("foreign, ", results.Foreign)
+}
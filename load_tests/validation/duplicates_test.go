@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeDuplicates(t *testing.T) {
+	// Test case 1: records found once, twice and three times
+	results := computeDuplicates("", 6, recordMapOf(map[string]int{"10000000": 1, "10000001": 2, "10000002": 3}), 1, 2, 3)
+	assert.Equal(t, DuplicateResults{
+		TotalDestination:   6,
+		Unique:             3,
+		Duplicate:          3,
+		PercentDuplicate:   50,
+		DeliveredOnce:      1,
+		DeliveredTwice:     1,
+		DeliveredThreePlus: 1,
+		MaxDeliveries:      3,
+		Unparseable:        1,
+		Malformed:          2,
+		Foreign:            3,
+	}, results)
+
+	// Test case 2: nothing found
+	results = computeDuplicates("s3", 0, recordMapOf(map[string]int{}), 0, 0, 0)
+	assert.Equal(t, DuplicateResults{Destination: "s3"}, results)
+}
+
+func TestCountRecord(t *testing.T) {
+	// Test case 1: only input records are counted
+	parser := newRecordIdParser(defaultRecordIdLength)
+	inputMap := recordMapOf(map[string]int{"10000000": 0})
+	assert.True(t, countRecord(inputMap, "10000000", 1, parser))
+	assert.False(t, countRecord(inputMap, "10000000", 2, parser))
+	assert.False(t, countRecord(inputMap, "10000001", 1, parser))
+	assert.Equal(t, map[string]int{"10000000": 3}, inputMap.toMap())
+
+	// Test case 2: every record is counted when only duplicates are validated
+	parser.duplicatesOnly = true
+	inputMap = recordMapOf(map[string]int{})
+	assert.True(t, countRecord(inputMap, "10000001", 1, parser))
+	assert.False(t, countRecord(inputMap, "10000001", 1, parser))
+	assert.Equal(t, map[string]int{"10000001": 2}, inputMap.toMap())
+}
+
+func TestValidateS3DuplicatesOnly(t *testing.T) {
+	client := &mockS3{
+		pages:   [][]string{{"a", "b"}},
+		objects: map[string][]string{"a": producerLogs("10000000", "10000001"), "b": producerLogs("10000001")},
+	}
+	parser := newRecordIdParser(defaultRecordIdLength)
+	parser.duplicatesOnly = true
+	inputMap := recordMapOf(map[string]int{})
+
+	found, _, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, inputMap, &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		parser:       parser,
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 2}, inputMap.toMap())
+
+	results := computeDuplicates("", found, inputMap, 0, 0, 0)
+	assert.Equal(t, 1, results.Duplicate)
+	assert.Equal(t, 2, results.MaxDeliveries)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+// Attribute of the items holding the log when DYNAMO_ID_ATTRIBUTE is not set
+const defaultDynamoAttribute = "log"
+
+// Subset of the DynamoDB API used for validation, so that it can be mocked in tests
+type dynamoAPI interface {
+	ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error
+	DescribeTableWithContext(ctx aws.Context, input *dynamodb.DescribeTableInput, opts ...request.Option) (*dynamodb.DescribeTableOutput, error)
+}
+
+// Creates a new DynamoDB Client
+func getDynamoClient(region string) (*dynamodb.DynamoDB, error) {
+	sess, err := getSession(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamodb.New(sess), nil
+}
+
+// Validate logs in a DynamoDB table.
+// The table is scanned in workerCount parallel segments, each of them page by page, reading only the given attribute.
+// Similar logic as S3 validation, the record ID is read from the string value of the attribute of each item.
+// Items without the attribute, or with a value which is not a string, are counted as unparseable.
+// Once ctx is done, the records found so far are returned. The first error stops all the segments.
+func validate_dynamodb(ctx context.Context, dynamoClient dynamoAPI, table string, attribute string, inputMap *RecordMap, parser *RecordIdParser, workerCount int) (int, error) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	dynamoRecordCounter := 0
+	malformedItems := 0
+
+	// Cancelled on the first error, so that the other segments stop early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for segment := 0; segment < workerCount; segment++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			input := &dynamodb.ScanInput{
+				TableName:                aws.String(table),
+				Segment:                  aws.Int64(int64(segment)),
+				TotalSegments:            aws.Int64(int64(workerCount)),
+				ProjectionExpression:     aws.String("#attribute"),
+				ExpressionAttributeNames: map[string]*string{"#attribute": aws.String(attribute)},
+			}
+
+			err := dynamoClient.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+				recordIds := make([]string, 0, len(page.Items))
+				pageMalformed := 0
+				for _, item := range page.Items {
+					value, ok := item[attribute]
+					if !ok || value.S == nil {
+						// Skip items without a log (count them as lost logs), with a single warning after the scan
+						pageMalformed++
+						continue
+					}
+
+					recordId, ok := parser.parse(aws.StringValue(value.S))
+					if !ok {
+						// Skip items without a record ID (count them as lost logs)
+						continue
+					}
+					recordIds = append(recordIds, recordId)
+				}
+
+				parser.countUnparseable(pageMalformed)
+
+				mutex.Lock()
+				dynamoRecordCounter += len(recordIds)
+				malformedItems += pageMalformed
+				for _, recordId := range recordIds {
+					// Counting the occurrences of this record in the destination
+					countRecord(inputMap, recordId, 1, parser)
+				}
+				mutex.Unlock()
+
+				logrus.Debugf("Read %d items from segment %d of table %q", len(page.Items), segment, table)
+				return true
+			})
+			if err != nil && ctx.Err() == nil {
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("error occured to scan segment %d of table %q: %w", segment, table, err)
+				}
+				mutex.Unlock()
+				cancel()
+			}
+		}(segment)
+	}
+	wg.Wait()
+
+	if malformedItems > 0 {
+		logrus.Warnf("Skipped %d malformed items without a string %q attribute in table %q", malformedItems, attribute, table)
+	}
+	if firstErr != nil {
+		return dynamoRecordCounter, firstErr
+	}
+
+	logrus.Infof("Scanned table %q in %d segments", table, workerCount)
+
+	return dynamoRecordCounter, nil
+}
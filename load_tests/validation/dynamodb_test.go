@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves the items of each scan segment page by page, failing the segments with the given errors
+type mockDynamo struct {
+	dynamoAPI
+	segments [][][]map[string]*dynamodb.AttributeValue
+	errors   map[int64]error
+}
+
+func (m *mockDynamo) ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+	segment := aws.Int64Value(input.Segment)
+	if err := m.errors[segment]; err != nil {
+		return err
+	}
+	if segment >= int64(len(m.segments)) {
+		return nil
+	}
+	pages := m.segments[segment]
+	for i, page := range pages {
+		if !fn(&dynamodb.ScanOutput{Items: page}, i == len(pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+// Returns a DynamoDB item with the log in the given attribute
+func dynamoItem(attribute string, log string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{attribute: {S: aws.String(log)}}
+}
+
+func TestValidateDynamoDB(t *testing.T) {
+	// Test case 1: records spread over segments and pages, with a duplicate and items without the attribute
+	client := &mockDynamo{
+		segments: [][][]map[string]*dynamodb.AttributeValue{
+			{{dynamoItem("log", "10000000_1639151827578_RandomString")}, {dynamoItem("log", "10000001_1639151827578_RandomString")}},
+			{{dynamoItem("log", "10000001_1639151827578_RandomString"), dynamoItem("message", "10000002_1639151827578_RandomString")}},
+		},
+	}
+	parser := newRecordIdParser(8)
+	inputMap := newInputMap(3)
+	found, err := validate_dynamodb(context.Background(), client, "table", "log", inputMap, parser, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 2, "10000002": 0}, inputMap.toMap())
+	assert.Equal(t, 1, parser.unparseableCount())
+
+	// Test case 2: a failed segment fails the validation
+	client = &mockDynamo{
+		errors: map[int64]error{1: awserr.New("ResourceNotFoundException", "Requested resource not found", nil)},
+	}
+	_, err = validate_dynamodb(context.Background(), client, "table", "log", newInputMap(1), newRecordIdParser(8), 2)
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/sirupsen/logrus"
+)
+
+// Size of a destination as reported by its listing APIs, printed instead of the results in estimate only mode
+type Estimate struct {
+	Destination string `json:"destination"`
+	// S3 objects or CloudWatch log streams
+	Objects     int    `json:"objects"`
+	ObjectType  string `json:"object_type"`
+	StoredBytes int64  `json:"stored_bytes"`
+}
+
+// Counts the objects under the given prefixes of a bucket last modified within the window and sums their sizes,
+// without downloading them. The objects are listed like validate_s3 does, an object under overlapping prefixes is counted once.
+func estimate_s3(ctx context.Context, s3Client s3API, bucket string, prefixes []string, settings *validatorSettings) (Estimate, error) {
+	estimate := Estimate{
+		Destination: "s3",
+		ObjectType:  "objects",
+	}
+
+	seen := make(map[string]bool)
+	var skips s3ListingSkips
+	count := func(object s3ObjectVersion) bool {
+		estimate.Objects++
+		estimate.StoredBytes += aws.Int64Value(object.Size)
+		return true
+	}
+	for _, prefix := range prefixes {
+		err := listS3Objects(ctx, s3Client, bucket, prefix, nil, settings.s3PageSize, settings.window, seen, &skips, count, func(nextToken *string) {})
+		if err != nil {
+			return estimate, err
+		}
+	}
+	if skips.duplicates > 0 {
+		logrus.Infof("Skipped %d S3 objects listed more than once", skips.duplicates)
+	}
+
+	return estimate, nil
+}
+
+// Sums the stored bytes of the given log streams as reported by DescribeLogStreams.
+// CloudWatch only updates storedBytes periodically, so recently written events may not be included yet.
+func estimate_cloudwatch(ctx context.Context, cwClient cwAPI, logGroup string, logStreams []string) (Estimate, error) {
+	estimate := Estimate{
+		Destination: "cloudwatch",
+		ObjectType:  "log_streams",
+	}
+
+	for _, logStream := range logStreams {
+		// There is no lookup by name, so find the stream among the ones starting with its name
+		err := cwClient.DescribeLogStreamsPagesWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+			LogGroupName:        aws.String(logGroup),
+			LogStreamNamePrefix: aws.String(logStream),
+		}, func(page *cloudwatchlogs.DescribeLogStreamsOutput, lastPage bool) bool {
+			for _, stream := range page.LogStreams {
+				if aws.StringValue(stream.LogStreamName) == logStream {
+					estimate.Objects++
+					estimate.StoredBytes += aws.Int64Value(stream.StoredBytes)
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return estimate, fmt.Errorf("error occured to describe the log stream %q of log group %q: %w", logStream, logGroup, err)
+		}
+	}
+
+	return estimate, nil
+}
+
+// Prints the estimate in the same format as the results
+func print_estimate(estimate Estimate, outputFormat string) {
+	if outputFormat == "json" {
+		output, err := json.Marshal(estimate)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to marshal the estimate: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	fmt.Println("destination, ", estimate.Destination)
+	fmt.Println("objects, ", estimate.Objects)
+	fmt.Println("object_type, ", estimate.ObjectType)
+	fmt.Println("stored_bytes, ", estimate.StoredBytes)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateS3(t *testing.T) {
+	client := &mockS3{pages: [][]string{{"a", "b"}, {"c"}}}
+
+	// Test case 1: the objects of every page are counted
+	estimate, err := estimate_s3(context.Background(), client, "bucket", []string{"prefix"}, &validatorSettings{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, estimate.Objects)
+	assert.Equal(t, int64(3*mockObjectSize), estimate.StoredBytes)
+
+	// Test case 2: an object listed under overlapping prefixes is counted once
+	estimate, err = estimate_s3(context.Background(), client, "bucket", []string{"prefix", "prefix/2021"}, &validatorSettings{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, estimate.Objects)
+
+	// Test case 3: objects last modified outside of the time window are not counted
+	estimate, err = estimate_s3(context.Background(), client, "bucket", []string{"prefix"}, &validatorSettings{
+		window: TimeWindow{start: time.Unix(1639151837, 578000000).Add(time.Hour)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, estimate.Objects)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Stops the validation of a destination as soon as every input record was found, for a quick answer when nothing is lost.
+// The rest of the destination is not read, so duplicates in it are not counted. The other way around, the destinations
+// validated one after the other are skipped once the loss of one of them is final and exceeds the allowed loss.
+// No earlier bound is known while a destination is read, as none of them tells how many records are left in it.
+// A nil FailFast is valid and never stops anything, so validators can report the records found unconditionally.
+type FailFast struct {
+	// Number of input records not found yet
+	remaining int64
+	stop      context.CancelFunc
+}
+
+// Creates a FailFast calling stop once every record of inputMap which was not found yet is found
+func newFailFast(inputMap *RecordMap, stop context.CancelFunc) *FailFast {
+	f := &FailFast{stop: stop}
+	inputMap.each(func(recordId string, occurrences int) {
+		if occurrences == 0 {
+			f.remaining++
+		}
+	})
+	if f.remaining == 0 {
+		stop()
+	}
+	return f
+}
+
+// Reports input records found for the first time, stopping the validation once none are left.
+// Safe for concurrent use.
+func (f *FailFast) found(count int) {
+	if f == nil || count == 0 {
+		return
+	}
+	if atomic.AddInt64(&f.remaining, -int64(count)) == 0 {
+		logrus.Infof("Found every input record, stopping the validation early")
+		f.stop()
+	}
+}
+
+// Returns true if every input record was found
+func (f *FailFast) complete() bool {
+	return f != nil && atomic.LoadInt64(&f.remaining) <= 0
+}
+
+// Returns the percentage of the input records which were never found, and true if it exceeds maxLossPercent.
+// Once a destination was read, polling included, its loss is final and the run can not pass anymore if it is exceeded.
+func lossExceeded(inputMap *RecordMap, maxLossPercent float64) (float64, bool) {
+	if inputMap.len() == 0 {
+		return 0, false
+	}
+	missing := 0
+	inputMap.each(func(recordId string, occurrences int) {
+		if occurrences == 0 {
+			missing++
+		}
+	})
+	percent := float64(missing) * 100 / float64(inputMap.len())
+	return percent, percent > maxLossPercent
+}
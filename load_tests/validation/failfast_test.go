@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailFast(t *testing.T) {
+	// Test case 1: stops once the last missing record is found
+	ctx, stop := context.WithCancel(context.Background())
+	failFast := newFailFast(recordMapOf(map[string]int{"10000000": 1, "10000001": 0, "10000002": 0}), stop)
+	failFast.found(1)
+	assert.NoError(t, ctx.Err())
+	assert.False(t, failFast.complete())
+	failFast.found(1)
+	assert.Error(t, ctx.Err())
+	assert.True(t, failFast.complete())
+
+	// Test case 2: stops right away if every record was found before, e.g. by a resumed run
+	ctx, stop = context.WithCancel(context.Background())
+	failFast = newFailFast(recordMapOf(map[string]int{"10000000": 1}), stop)
+	assert.Error(t, ctx.Err())
+	assert.True(t, failFast.complete())
+
+	// Test case 3: a nil FailFast never stops
+	var disabled *FailFast
+	disabled.found(1)
+	assert.False(t, disabled.complete())
+}
+
+func TestLossExceeded(t *testing.T) {
+	inputMap := recordMapOf(map[string]int{"10000000": 1, "10000001": 0, "10000002": 2, "10000003": 0})
+
+	// Test case 1: the loss is within the allowed loss
+	percent, exceeded := lossExceeded(inputMap, 50)
+	assert.Equal(t, 50.0, percent)
+	assert.False(t, exceeded)
+
+	// Test case 2: the loss exceeds the allowed loss
+	_, exceeded = lossExceeded(inputMap, 10)
+	assert.True(t, exceeded)
+
+	// Test case 3: nothing can be lost without input records
+	_, exceeded = lossExceeded(newKeyedRecordMap(nil), 0)
+	assert.False(t, exceeded)
+}
+
+func TestValidateS3FailFast(t *testing.T) {
+	client := &mockS3{
+		pages:   [][]string{{"a", "b"}, {"c"}},
+		objects: map[string][]string{"a": producerLogs("10000000", "10000001"), "b": producerLogs("10000000"), "c": producerLogs("10000001")},
+	}
+	inputMap := newInputMap(2)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	// A single worker reads the objects in order, the ones after the first are not needed
+	found, totals, err := validate_s3(ctx, client, "bucket", []string{"prefix"}, inputMap, &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+		failFast:     newFailFast(inputMap, stop),
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found)
+	assert.Equal(t, 1, totals.objects)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1}, inputMap.toMap())
+}
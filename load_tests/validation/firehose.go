@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// Layout of the partitions Firehose appends to the S3 prefix by default, the UTC hour the records arrived in
+	defaultFirehoseLayout = "2006/01/02/15/"
+	// Partition layout of a delivery stream which writes directly under the prefix
+	firehoseLayoutNone = "none"
+	// Encoding of the records when a transformation Lambda writes them base64 encoded, one per line
+	firehoseEncodingBase64 = "base64"
+)
+
+// Failed record as written by Firehose to its S3 error output, e.g. when OpenSearch rejected it
+type firehoseError struct {
+	// Base64 encoded record as received by Firehose
+	RawData string `json:"rawData"`
+}
+
+// Returns the record held by a line of the Firehose error output
+func firehoseErrorRecord(line []byte) ([]byte, error) {
+	var failed firehoseError
+	if err := json.Unmarshal(line, &failed); err != nil {
+		return nil, err
+	}
+	if failed.RawData == "" {
+		return nil, errors.New("failed record without rawData")
+	}
+	record, err := base64.StdEncoding.DecodeString(failed.RawData)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(record, "\r\n"), nil
+}
+
+// Returns the S3 prefixes of the hourly partitions Firehose wrote to within the window, under each of the given prefixes.
+// The layout is a Go time layout, e.g. "2006/01/02/15/" or "year=2006/month=01/day=02/hour=15/" for a custom prefix.
+// The whole prefixes are returned if the window has no start, or if there is no layout, as the partitions can not be enumerated.
+// Without an end, the window ends at now.
+func firehosePrefixes(prefixes []string, layout string, window TimeWindow, now time.Time) []string {
+	if layout == "" || window.start.IsZero() {
+		return prefixes
+	}
+	end := window.end
+	if end.IsZero() {
+		end = now
+	}
+
+	var partitions []string
+	seen := make(map[string]bool)
+	for _, prefix := range prefixes {
+		for hour := window.start.UTC().Truncate(time.Hour); !hour.After(end); hour = hour.Add(time.Hour) {
+			// Layouts coarser than an hour yield the same partition for several hours
+			partition := prefix + hour.Format(layout)
+			if !seen[partition] {
+				seen[partition] = true
+				partitions = append(partitions, partition)
+			}
+		}
+	}
+	return partitions
+}
+
+// Returns the prefixes of the dynamic partitions under each of the given prefixes, with a "key=value" segment per partition key.
+// Partition keys are given in the order of their segments, either as a key matching any of its values or as a "key=value" pair.
+// The values are discovered by listing the common prefixes one segment at a time, so the prefixes should end with a "/".
+func firehoseDynamicPrefixes(ctx context.Context, s3Client s3API, bucket string, prefixes []string, partitionKeys []string) ([]string, error) {
+	for _, partitionKey := range partitionKeys {
+		children, err := discover_s3_prefixes(ctx, s3Client, bucket, prefixes)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes = nil
+		for _, child := range children {
+			segment := strings.TrimSuffix(child, "/")
+			segment = segment[strings.LastIndex(segment, "/")+1:]
+			if strings.Contains(partitionKey, "=") {
+				if segment != partitionKey {
+					continue
+				}
+			} else if !strings.HasPrefix(segment, partitionKey+"=") {
+				continue
+			}
+			prefixes = append(prefixes, child)
+		}
+		if len(prefixes) == 0 {
+			return nil, fmt.Errorf("no dynamic partitions found for partition key %q in bucket %q", partitionKey, bucket)
+		}
+	}
+	return prefixes, nil
+}
+
+// Validates the records Firehose delivered to S3.
+// The dynamic partitions of the partition keys are discovered first, if there are any.
+// Only the partitions of the window are listed, and the objects are then validated like the ones of the S3 destination.
+// Firehose concatenates the records of an object without a separator unless a processor appends a newline,
+// which the parser must be configured for. Objects compressed with gzip are decompressed.
+// Returns the number of records found and the number and size of the objects validated.
+func validate_firehose(ctx context.Context, s3Client s3API, bucket string, prefixes []string, partitionKeys []string, layout string, inputMap *RecordMap, settings *validatorSettings, progress *Progress) (int, s3Totals, error) {
+	if len(partitionKeys) > 0 {
+		var err error
+		prefixes, err = firehoseDynamicPrefixes(ctx, s3Client, bucket, prefixes, partitionKeys)
+		if err != nil {
+			return 0, s3Totals{}, err
+		}
+	}
+	partitions := firehosePrefixes(prefixes, layout, settings.window, time.Now())
+	return validate_s3(ctx, s3Client, bucket, partitions, inputMap, settings, progress)
+}
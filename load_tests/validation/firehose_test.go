@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirehosePrefixes(t *testing.T) {
+	start := time.Date(2022, 1, 31, 22, 30, 0, 0, time.UTC)
+	end := time.Date(2022, 2, 1, 0, 10, 0, 0, time.UTC)
+
+	// Test case 1: hourly partitions of the default layout, across a day boundary
+	prefixes := firehosePrefixes([]string{"logs/"}, defaultFirehoseLayout, TimeWindow{start: start, end: end}, time.Time{})
+	assert.Equal(t, []string{"logs/2022/01/31/22/", "logs/2022/01/31/23/", "logs/2022/02/01/00/"}, prefixes)
+
+	// Test case 2: custom layout coarser than an hour, ending now
+	prefixes = firehosePrefixes([]string{"a/", "b/"}, "year=2006/month=01/day=02/", TimeWindow{start: start}, end)
+	assert.Equal(t, []string{"a/year=2022/month=01/day=31/", "a/year=2022/month=02/day=01/", "b/year=2022/month=01/day=31/", "b/year=2022/month=02/day=01/"}, prefixes)
+
+	// Test case 3: the whole prefix without a window start or a layout
+	assert.Equal(t, []string{"logs/"}, firehosePrefixes([]string{"logs/"}, defaultFirehoseLayout, TimeWindow{end: end}, time.Time{}))
+	assert.Equal(t, []string{"logs/"}, firehosePrefixes([]string{"logs/"}, "", TimeWindow{start: start, end: end}, time.Time{}))
+}
+
+func TestValidateFirehose(t *testing.T) {
+	client := &mockS3{
+		pages:   [][]string{{"a", "b"}},
+		objects: map[string][]string{"a": producerLogs("10000000", "10000001"), "b": producerLogs("10000001")},
+	}
+	parser := newRecordIdParser(8)
+	parser.concatenated = true
+	inputMap := newInputMap(3)
+
+	found, objects, err := validate_firehose(context.Background(), client, "bucket", []string{"logs/"}, nil, defaultFirehoseLayout, inputMap, &validatorSettings{
+		workerCount: 2,
+		parser:      parser,
+		delays:      &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, 2, objects.objects)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 2, "10000002": 0}, inputMap.toMap())
+}
+
+func TestFirehoseDynamicPrefixes(t *testing.T) {
+	client := &mockS3Prefixes{
+		keys: []string{
+			"logs/customer=a/level=info/2022/01/31/22/object1.gz",
+			"logs/customer=a/level=error/2022/01/31/22/object2.gz",
+			"logs/customer=b/level=info/2022/01/31/22/object3.gz",
+			"logs/other/object4.gz",
+		},
+	}
+
+	// Test case 1: every value of the partition keys
+	prefixes, err := firehoseDynamicPrefixes(context.Background(), client, "bucket", []string{"logs/"}, []string{"customer", "level"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"logs/customer=a/level=info/", "logs/customer=a/level=error/", "logs/customer=b/level=info/"}, prefixes)
+
+	// Test case 2: a single value of a partition key
+	prefixes, err = firehoseDynamicPrefixes(context.Background(), client, "bucket", []string{"logs/"}, []string{"customer=b", "level"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"logs/customer=b/level=info/"}, prefixes)
+
+	// Test case 3: no partitions of a key
+	_, err = firehoseDynamicPrefixes(context.Background(), client, "bucket", []string{"logs/"}, []string{"region"})
+	assert.Error(t, err)
+}
+
+// Serves the dynamic partitions of the keys, and the objects of a single partition
+type mockFirehoseS3 struct {
+	*mockS3
+	partitions *mockS3Prefixes
+}
+
+func (m *mockFirehoseS3) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	return m.partitions.ListObjectsV2PagesWithContext(ctx, input, fn, opts...)
+}
+
+func TestValidateFirehoseDynamicPartitions(t *testing.T) {
+	client := &mockFirehoseS3{
+		mockS3: &mockS3{
+			pages:   [][]string{{"a.gz", "b.gz"}},
+			objects: map[string][]string{"a.gz": producerLogs("10000000", "10000001"), "b.gz": producerLogs("10000002")},
+			gzip:    true,
+		},
+		partitions: &mockS3Prefixes{keys: []string{"logs/customer=a/a.gz", "logs/customer=a/b.gz"}},
+	}
+	inputMap := newInputMap(3)
+
+	found, objects, err := validate_firehose(context.Background(), client, "bucket", []string{"logs/"}, []string{"customer"}, "", inputMap, &validatorSettings{
+		workerCount: 2,
+		parser:      newRecordIdParser(8),
+		delays:      &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, 2, objects.objects)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1, "10000002": 1}, inputMap.toMap())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Creates a new HTTP Client for the query URL, the collector may take a while to return all the records
+func getHTTPClient() (*http.Client, error) {
+	httpClient := &http.Client{Timeout: 5 * time.Minute}
+	transport, err := getTransport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		httpClient.Transport = transport
+	}
+	return httpClient, nil
+}
+
+// Validate logs stored by a collector behind Fluent Bit's http output, as returned by a query URL.
+// The response is either a JSON array of the records or newline delimited records, read with the parser like S3 objects.
+// Elements of the array are JSON log entries, or the logs themselves if they are strings.
+// With a token, the request is authenticated with it as a bearer token.
+// Once ctx is done, the records found so far are returned.
+func validate_http(ctx context.Context, httpClient *http.Client, url string, token string, inputMap *RecordMap, parser *RecordIdParser) (int, error) {
+	httpRecordCounter := 0
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return httpRecordCounter, err
+	}
+	req = req.WithContext(ctx)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return httpRecordCounter, nil
+		}
+		return httpRecordCounter, fmt.Errorf("error occured to query the records from %q: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return httpRecordCounter, fmt.Errorf("query of the records from %q returned %s: %s", url, resp.Status, body)
+	}
+
+	handleLog := func(log string) {
+		recordId, ok := parser.parse(log)
+		if !ok {
+			// Skip logs without a record ID (count them as lost logs)
+			return
+		}
+		httpRecordCounter += 1
+		// Counting the occurrences of this record in the destination
+		countRecord(inputMap, recordId, 1, parser)
+	}
+
+	// The first non blank character tells a JSON array apart from newline delimited records
+	reader := bufio.NewReader(resp.Body)
+	var first byte
+	for {
+		first, err = reader.ReadByte()
+		if err != nil || !bytes.ContainsRune([]byte(" \t\r\n"), rune(first)) {
+			break
+		}
+	}
+	switch {
+	case err == io.EOF:
+		// No records at all
+		err = nil
+	case err != nil:
+	case first == '[':
+		reader.UnreadByte()
+		err = decodeHTTPRecords(reader, parser, handleLog)
+	default:
+		reader.UnreadByte()
+		err = parser.scanLogs(reader, handleLog)
+	}
+	if err != nil && ctx.Err() == nil {
+		return httpRecordCounter, fmt.Errorf("error to read the records from %q: %w", url, err)
+	}
+
+	logrus.Infof("Read %d records from %q", httpRecordCounter, url)
+
+	return httpRecordCounter, nil
+}
+
+// Calls fn with the log of every element of a JSON array of records, one element at a time
+func decodeHTTPRecords(reader *bufio.Reader, parser *RecordIdParser, fn func(log string)) error {
+	decoder := json.NewDecoder(reader)
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		var element json.RawMessage
+		if err := decoder.Decode(&element); err != nil {
+			return err
+		}
+
+		var log string
+		if json.Unmarshal(element, &log) == nil {
+			fn(log)
+			continue
+		}
+		if err := parser.handleEntry(element, fn); err != nil {
+			return err
+		}
+	}
+
+	_, err := decoder.Token()
+	return err
+}
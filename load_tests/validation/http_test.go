@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateHTTP(t *testing.T) {
+	var body string
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if body == "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	// Test case 1: newline delimited JSON log entries
+	body = "{\"log\":\"10000000_1639151827578_RandomString\"}\n{\"log\":\"10000001_1639151827578_RandomString\"}\n"
+	inputMap := newInputMap(3)
+	found, err := validate_http(context.Background(), server.Client(), server.URL, "", inputMap, newRecordIdParser(8))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1, "10000002": 0}, inputMap.toMap())
+	assert.Equal(t, "", authorization)
+
+	// Test case 2: JSON array of log entries and logs, with a bearer token
+	body = " [{\"log\":\"10000000_1639151827578_RandomString\"}, \"10000001_1639151827578_RandomString\", {\"message\":\"x\"}]"
+	inputMap = newInputMap(2)
+	parser := newRecordIdParser(8)
+	found, err = validate_http(context.Background(), server.Client(), server.URL, "secret", inputMap, parser)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1}, inputMap.toMap())
+	assert.Equal(t, 1, parser.unparseableCount())
+	assert.Equal(t, "Bearer secret", authorization)
+
+	// Test case 3: truncated JSON array
+	body = "[{\"log\":\"10000000_1639151827578_RandomString\"}, "
+	_, err = validate_http(context.Background(), server.Client(), server.URL, "", newInputMap(1), newRecordIdParser(8))
+	assert.Error(t, err)
+
+	// Test case 4: error status
+	body = ""
+	_, err = validate_http(context.Background(), server.Client(), server.URL, "", newInputMap(1), newRecordIdParser(8))
+	assert.Error(t, err)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/sirupsen/logrus"
+)
+
+// Every KPL aggregated record starts with these magic bytes, followed by a protobuf
+// encoded AggregatedRecord and the MD5 digest of that protobuf message.
+// https://github.com/awslabs/amazon-kinesis-producer/blob/master/aggregation-format.md
+var kplMagic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// Subset of the Kinesis API used for validation, so that it can be mocked in tests
+type kinesisAPI interface {
+	ListShardsWithContext(ctx aws.Context, input *kinesis.ListShardsInput, opts ...request.Option) (*kinesis.ListShardsOutput, error)
+	GetShardIteratorWithContext(ctx aws.Context, input *kinesis.GetShardIteratorInput, opts ...request.Option) (*kinesis.GetShardIteratorOutput, error)
+	GetRecordsWithContext(ctx aws.Context, input *kinesis.GetRecordsInput, opts ...request.Option) (*kinesis.GetRecordsOutput, error)
+}
+
+// Creates a new Kinesis Client
+func getKinesisClient(region string) (*kinesis.Kinesis, error) {
+	sess, err := getSession(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return kinesis.New(sess), nil
+}
+
+// Validate logs in a Kinesis Data Stream.
+// Every shard of the stream is read from TRIM_HORIZON until the shard is either closed or caught up.
+// Similar logic as S3 validation, except that KPL aggregated records are deaggregated first.
+// When ordering is not nil, the records of each shard are also checked for producer order, which Kinesis preserves within a shard.
+// Once ctx is done, the records found so far are returned.
+func validate_kinesis(ctx context.Context, kinesisClient kinesisAPI, streamName string, inputMap *RecordMap, parser *RecordIdParser, delays *DelayStats, ordering *OrderStats) (int, error) {
+	kinesisRecordCounter := 0
+
+	shardIds, err := getKinesisShardIds(ctx, kinesisClient, streamName)
+	if err != nil {
+		return kinesisRecordCounter, err
+	}
+
+	for _, shardId := range shardIds {
+		iteratorOutput, err := kinesisClient.GetShardIteratorWithContext(ctx, &kinesis.GetShardIteratorInput{
+			StreamName:        aws.String(streamName),
+			ShardId:           aws.String(shardId),
+			ShardIteratorType: aws.String(kinesis.ShardIteratorTypeTrimHorizon),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return kinesisRecordCounter, fmt.Errorf("error occured to get the shard iterator for shard %q of stream %q: %w", shardId, streamName, err)
+		}
+
+		// Deaggregated records keep the order they were aggregated in
+		var order orderChecker
+		shardIterator := iteratorOutput.ShardIterator
+		for shardIterator != nil {
+			// GetRecords is limited to 5 TPS per shard
+			if !sleepWithContext(ctx, 200*time.Millisecond) {
+				break
+			}
+
+			var response *kinesis.GetRecordsOutput
+			// retry for throttling exception and server side errors
+			err := retryWithBackoff(ctx, func() error {
+				var err error
+				response, err = kinesisClient.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{
+					ShardIterator: shardIterator,
+				})
+				return err
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				return kinesisRecordCounter, fmt.Errorf("error occured to get the records from shard %q of stream %q: %w", shardId, streamName, err)
+			}
+
+			logrus.Infof("Read %d records from shard %q", len(response.Records), shardId)
+			for _, record := range response.Records {
+				for _, data := range deaggregateKinesisRecord(record.Data) {
+					logs, err := parser.getLogs(data)
+					if err != nil {
+						return kinesisRecordCounter, fmt.Errorf("error to parse a record from shard %q of stream %q: %w", shardId, streamName, err)
+					}
+					for _, log := range logs {
+						recordId, ok := parser.parse(log)
+						if !ok {
+							// Skip logs without a record ID (count them as lost logs)
+							continue
+						}
+						kinesisRecordCounter += 1
+						// Counting the occurrences of this record in the destination
+						countRecord(inputMap, recordId, 1, parser)
+						order.check(recordId)
+						if timestamp, ok := parser.timestamp(log); ok {
+							delays.addRecord(recordTiming{recordId: recordId, produced: timestamp, arrived: aws.TimeValue(record.ApproximateArrivalTimestamp)})
+						} else {
+							delays.addArrival(aws.TimeValue(record.ApproximateArrivalTimestamp))
+						}
+					}
+				}
+			}
+
+			// An open shard never returns a nil iterator, so stop once we have caught up with the tip of the shard
+			if len(response.Records) == 0 && aws.Int64Value(response.MillisBehindLatest) == 0 {
+				break
+			}
+			shardIterator = response.NextShardIterator
+		}
+
+		if ordering != nil {
+			ordering.add(shardId, order.outOfOrder)
+		}
+	}
+
+	return kinesisRecordCounter, nil
+}
+
+// Returns the IDs of all shards in the stream, including closed ones which may still hold records
+func getKinesisShardIds(ctx context.Context, kinesisClient kinesisAPI, streamName string) ([]string, error) {
+	var shardIds []string
+	input := &kinesis.ListShardsInput{
+		StreamName: aws.String(streamName),
+	}
+
+	for {
+		response, err := kinesisClient.ListShardsWithContext(ctx, input)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, fmt.Errorf("error occured to list the shards of stream %q: %w", streamName, err)
+		}
+
+		for _, shard := range response.Shards {
+			shardIds = append(shardIds, aws.StringValue(shard.ShardId))
+		}
+
+		if response.NextToken == nil {
+			break
+		}
+		// StreamName must not be set together with NextToken
+		input = &kinesis.ListShardsInput{
+			NextToken: response.NextToken,
+		}
+	}
+
+	return shardIds, nil
+}
+
+// Splits a KPL aggregated record into the user records it contains.
+// Records which are not aggregated (or fail the checksum) are returned as is.
+func deaggregateKinesisRecord(data []byte) [][]byte {
+	if len(data) < len(kplMagic)+md5.Size || !bytes.HasPrefix(data, kplMagic) {
+		return [][]byte{data}
+	}
+
+	message := data[len(kplMagic) : len(data)-md5.Size]
+	checksum := md5.Sum(message)
+	if !bytes.Equal(checksum[:], data[len(data)-md5.Size:]) {
+		return [][]byte{data}
+	}
+
+	records, err := parseAggregatedRecord(message)
+	if err != nil {
+		logrus.Warnf("Malform aggregated record. Protobuf Error: %v", err)
+		return [][]byte{data}
+	}
+
+	return records
+}
+
+// Decodes the "data" field of every Record in a protobuf encoded AggregatedRecord:
+//
+//	message AggregatedRecord {
+//	  repeated string partition_key_table = 1;
+//	  repeated string explicit_hash_key_table = 2;
+//	  repeated Record records = 3;
+//	}
+//
+//	message Record {
+//	  required uint64 partition_key_index = 1;
+//	  optional uint64 explicit_hash_key_index = 2;
+//	  required bytes data = 3;
+//	  repeated Tag tags = 4;
+//	}
+func parseAggregatedRecord(message []byte) ([][]byte, error) {
+	var records [][]byte
+
+	err := walkProtobufFields(message, func(field uint64, value []byte) error {
+		if field != 3 {
+			return nil
+		}
+		return walkProtobufFields(value, func(field uint64, value []byte) error {
+			if field == 3 {
+				records = append(records, value)
+			}
+			return nil
+		})
+	})
+
+	return records, err
+}
+
+// Calls fn with the field number and payload of every length-delimited field in a protobuf message.
+// Varint fields are skipped since the deaggregation only needs the nested messages and bytes fields.
+func walkProtobufFields(message []byte, fn func(field uint64, value []byte) error) error {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		message = message[n:]
+
+		field, wireType := key>>3, key&0x7
+		switch wireType {
+		case 0:
+			_, n = binary.Uvarint(message)
+			if n <= 0 {
+				return fmt.Errorf("invalid varint for field %d", field)
+			}
+			message = message[n:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return fmt.Errorf("invalid length for field %d", field)
+			}
+			value := message[n : n+int(length)]
+			message = message[n+int(length):]
+			if err := fn(field, value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported wire type %d for field %d", wireType, field)
+		}
+	}
+
+	return nil
+}
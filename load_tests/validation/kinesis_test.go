@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves the records of every shard in a single GetRecords call, the shard iterator is the shard ID
+type mockKinesis struct {
+	kinesisAPI
+	shards map[string][][]byte
+	// Shards in the order they are listed
+	shardIds []string
+}
+
+func (m *mockKinesis) ListShardsWithContext(ctx aws.Context, input *kinesis.ListShardsInput, opts ...request.Option) (*kinesis.ListShardsOutput, error) {
+	output := &kinesis.ListShardsOutput{}
+	for _, shardId := range m.shardIds {
+		output.Shards = append(output.Shards, &kinesis.Shard{ShardId: aws.String(shardId)})
+	}
+	return output, nil
+}
+
+func (m *mockKinesis) GetShardIteratorWithContext(ctx aws.Context, input *kinesis.GetShardIteratorInput, opts ...request.Option) (*kinesis.GetShardIteratorOutput, error) {
+	return &kinesis.GetShardIteratorOutput{ShardIterator: input.ShardId}, nil
+}
+
+func (m *mockKinesis) GetRecordsWithContext(ctx aws.Context, input *kinesis.GetRecordsInput, opts ...request.Option) (*kinesis.GetRecordsOutput, error) {
+	output := &kinesis.GetRecordsOutput{MillisBehindLatest: aws.Int64(0)}
+	for _, data := range m.shards[aws.StringValue(input.ShardIterator)] {
+		output.Records = append(output.Records, &kinesis.Record{Data: data})
+	}
+	// The shard is closed once its records are read
+	return output, nil
+}
+
+// Returns a Kinesis record per log, as put by Fluent Bit
+func kinesisRecords(logs ...string) [][]byte {
+	records := make([][]byte, 0, len(logs))
+	for _, log := range logs {
+		records = append(records, []byte(fmt.Sprintf("{\"log\":%q}", log)))
+	}
+	return records
+}
+
+func appendProtobufBytes(message []byte, field uint64, value []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, field<<3|2)
+	message = append(message, buf[:n]...)
+	n = binary.PutUvarint(buf, uint64(len(value)))
+	message = append(message, buf[:n]...)
+	return append(message, value...)
+}
+
+func aggregateKinesisRecords(records ...string) []byte {
+	var message []byte
+	message = appendProtobufBytes(message, 1, []byte("partition-key"))
+	for _, record := range records {
+		var inner []byte
+		// partition_key_index = 0
+		inner = append(inner, 1<<3, 0)
+		inner = appendProtobufBytes(inner, 3, []byte(record))
+		message = appendProtobufBytes(message, 3, inner)
+	}
+
+	checksum := md5.Sum(message)
+	data := append([]byte{}, kplMagic...)
+	data = append(data, message...)
+	return append(data, checksum[:]...)
+}
+
+func TestDeaggregateKinesisRecord(t *testing.T) {
+	// Test case 1: plain record is returned unchanged
+	plain := []byte(`{"log":"10000000_1639151827578_RandomString"}`)
+	assert.Equal(t, [][]byte{plain}, deaggregateKinesisRecord(plain))
+
+	// Test case 2: aggregated record is split into its user records
+	aggregated := aggregateKinesisRecords(
+		`{"log":"10000000_1639151827578_RandomString"}`,
+		`{"log":"10000001_1639151827579_RandomString"}`,
+	)
+	assert.Equal(t, [][]byte{
+		[]byte(`{"log":"10000000_1639151827578_RandomString"}`),
+		[]byte(`{"log":"10000001_1639151827579_RandomString"}`),
+	}, deaggregateKinesisRecord(aggregated))
+
+	// Test case 3: aggregated record with a bad checksum is treated as a plain record
+	aggregated[len(aggregated)-1] ^= 0xFF
+	assert.Equal(t, [][]byte{aggregated}, deaggregateKinesisRecord(aggregated))
+}
+
+func TestValidateKinesisOrdering(t *testing.T) {
+	client := &mockKinesis{
+		shardIds: []string{"shardId-000000000000", "shardId-000000000001"},
+		shards: map[string][][]byte{
+			"shardId-000000000000": kinesisRecords(producerLogs("10000000", "10000002", "10000001")...),
+			// Records deaggregated from a KPL aggregated record are checked in their aggregated order
+			"shardId-000000000001": {aggregateKinesisRecords(fmt.Sprintf("{\"log\":%q}", "10000003_1639151827578_RandomString"), fmt.Sprintf("{\"log\":%q}", "10000004_1639151827578_RandomString"))},
+		},
+	}
+
+	// Test case 1: the records out of order are counted per shard, each shard is checked on its own
+	ordering := newOrderStats()
+	found, err := validate_kinesis(context.Background(), client, "stream", newInputMap(5), newRecordIdParser(defaultRecordIdLength), &DelayStats{}, ordering)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, found)
+	assert.Equal(t, 1, ordering.total())
+	assert.Equal(t, []StreamOrder{{Stream: "shardId-000000000000", OutOfOrder: 1}}, ordering.streams())
+
+	// Test case 2: the ordering is only checked on request
+	found, err = validate_kinesis(context.Background(), client, "stream", newInputMap(5), newRecordIdParser(defaultRecordIdLength), &DelayStats{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, found)
+}
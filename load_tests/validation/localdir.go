@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// A file found under the local directory
+type localFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Returns every regular file under the directory and its subdirectories, in lexical order
+func listLocalFiles(dir string) ([]localFile, error) {
+	var files []localFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, localFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error occured to list the files of directory %q: %w", dir, err)
+	}
+	return files, nil
+}
+
+// Reads a single local file and calls fn with every log entry in it, decompressing it like a S3 object.
+// Returns the number of bytes read after decompression, and whether the file was compressed.
+func readLocalFileLogs(path string, parser *RecordIdParser, fn func(log string)) (int64, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+
+	decompressed, compressed, err := decompressReader(file)
+	if err != nil {
+		if isCorruptGzip(err) {
+			return 0, compressed, &corruptObjectError{key: path, err: err}
+		}
+		return 0, compressed, fmt.Errorf("error to decompress file %q: %w", path, err)
+	}
+	body := &countingReader{reader: decompressed}
+	scan := parser.scanLogs
+	if parser.parquet {
+		scan = parser.readParquetLogs
+	}
+	if err := scan(body, fn); err != nil {
+		if compressed && isCorruptGzip(err) {
+			return body.count, compressed, &corruptObjectError{key: path, err: err}
+		}
+		return body.count, compressed, fmt.Errorf("error to read file %q: %w", path, err)
+	}
+	return body.count, compressed, nil
+}
+
+// Validate logs in the files of a local directory, e.g. the S3 objects of a failed run downloaded for an offline analysis.
+// Every file under the directory is read like a S3 object, with the modification time of the file as its arrival time,
+// which is only meaningful if the download kept the modification times. Files modified outside of the time window are skipped.
+// Similar logic as S3 validation, without the checkpoints.
+func validate_localdir(ctx context.Context, dir string, inputMap *RecordMap, settings *validatorSettings, progress *Progress) (int, s3Totals, error) {
+	var totals s3Totals
+	files, err := listLocalFiles(dir)
+	if err != nil {
+		return 0, totals, err
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	localRecordCounter := 0
+	outsideWindow := 0
+
+	// Cancelled on the first error, so that the other workers stop early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pending := make(chan localFile)
+	for i := 0; i < settings.workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range pending {
+				// Drain the remaining files without reading them once the run is over
+				if ctx.Err() != nil {
+					continue
+				}
+				if !settings.window.contains(file.modTime) {
+					mutex.Lock()
+					outsideWindow++
+					mutex.Unlock()
+					continue
+				}
+
+				var recordIds []string
+				var recordTimings []recordTiming
+				logCounter := 0
+				contentBytes, compressed, err := readLocalFileLogs(file.path, settings.parser, func(log string) {
+					logCounter++
+					recordId, ok := settings.parser.parse(log)
+					if !ok {
+						// Skip logs without a record ID (count them as lost logs) and foreign records
+						return
+					}
+					settings.audit.add(recordId, "%s:%d", file.path, logCounter)
+					recordIds = append(recordIds, recordId)
+					if timestamp, ok := settings.parser.timestamp(log); ok {
+						recordTimings = append(recordTimings, recordTiming{recordId: recordId, produced: timestamp, arrived: file.modTime})
+					}
+				})
+				// The records read before the corruption are counted, the rest of the file is lost
+				var corrupt *corruptObjectError
+				corruptFile := err != nil && settings.parser.skipCorrupt && errors.As(err, &corrupt)
+				if corruptFile {
+					logrus.Warnf("Skipped the rest of a corrupt file after %d records, %v", len(recordIds), err)
+					err = nil
+				}
+				if err != nil {
+					mutex.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mutex.Unlock()
+					cancel()
+					continue
+				}
+
+				logrus.Debugf("Found %d records in file %q", len(recordIds), file.path)
+
+				fileTotals := s3Totals{objects: 1, bytes: file.size, contentBytes: contentBytes}
+				if compressed {
+					fileTotals.gzipObjects = 1
+				} else {
+					fileTotals.plainObjects = 1
+				}
+				fileTotals.perObject.add(len(recordIds))
+				if corruptFile {
+					fileTotals.corruptObjects = []string{file.path}
+				}
+
+				mutex.Lock()
+				localRecordCounter += len(recordIds)
+				for _, recordId := range recordIds {
+					// Counting the occurrences of this record in the destination
+					countRecord(inputMap, recordId, 1, settings.parser)
+				}
+				for _, timing := range recordTimings {
+					settings.delays.addRecord(timing)
+				}
+				if len(recordIds) > 0 {
+					settings.delays.addArrival(file.modTime)
+				}
+				totals.add(fileTotals)
+				mutex.Unlock()
+				progress.add(len(recordIds), 1)
+			}
+		}()
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		pending <- file
+	}
+	close(pending)
+	wg.Wait()
+
+	if outsideWindow > 0 {
+		logrus.Infof("Skipped %d files modified outside of the time window", outsideWindow)
+	}
+	if firstErr != nil {
+		return localRecordCounter, totals, firstErr
+	}
+
+	logrus.Infof("Validated %d files of %d bytes in directory %q", totals.objects, totals.bytes, dir)
+
+	return localRecordCounter, totals, nil
+}
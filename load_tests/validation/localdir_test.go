@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns the logs as JSON log entries, one per line
+func jsonLines(logs ...string) []byte {
+	var body bytes.Buffer
+	for _, log := range logs {
+		fmt.Fprintf(&body, "{\"log\":%q}\n", log)
+	}
+	return body.Bytes()
+}
+
+func TestValidateLocalDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localdir")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err = writer.Write(jsonLines(producerLogs("10000001", "10000002")...))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "2022", "01"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.log"), jsonLines(producerLogs("10000000", "10000001")...), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2022", "01", "b"), compressed.Bytes(), 0644))
+	old := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "a.log"), old, old))
+
+	// Test case 1: the files of every subdirectory are read, compressed or not
+	inputMap := newInputMap(3)
+	found, totals, err := validate_localdir(context.Background(), dir, inputMap, &validatorSettings{
+		workerCount: 2,
+		parser:      newRecordIdParser(defaultRecordIdLength),
+		delays:      &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, found)
+	assert.Equal(t, 2, totals.objects)
+	assert.Equal(t, 1, totals.gzipObjects)
+	assert.Equal(t, 1, totals.plainObjects)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 2, "10000002": 1}, inputMap.toMap())
+
+	// Test case 2: files modified outside of the time window are skipped
+	inputMap = newInputMap(3)
+	found, totals, err = validate_localdir(context.Background(), dir, inputMap, &validatorSettings{
+		workerCount: 1,
+		window:      TimeWindow{start: old.Add(time.Hour)},
+		parser:      newRecordIdParser(defaultRecordIdLength),
+		delays:      &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found)
+	assert.Equal(t, 1, totals.objects)
+
+	// Test case 3: files which are not Parquet fail when Parquet records are expected
+	parser := newRecordIdParser(defaultRecordIdLength)
+	parser.parquet = true
+	_, _, err = validate_localdir(context.Background(), dir, newInputMap(3), &validatorSettings{
+		workerCount: 1,
+		parser:      parser,
+		delays:      &DelayStats{},
+	}, nil)
+	assert.Error(t, err)
+
+	// Test case 4: a file with a corrupt gzip stream fails the run, unless corrupt files are skipped and counted
+	corruptDir, err := ioutil.TempDir("", "localdir")
+	assert.NoError(t, err)
+	defer os.RemoveAll(corruptDir)
+	corruptBody := append([]byte(nil), compressed.Bytes()...)
+	// The CRC-32 of the content precedes the size in the last 8 bytes of the stream
+	corruptBody[len(corruptBody)-8] ^= 0xff
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(corruptDir, "a.log"), jsonLines(producerLogs("10000000")...), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(corruptDir, "b"), corruptBody, 0644))
+	_, _, err = validate_localdir(context.Background(), corruptDir, newInputMap(3), &validatorSettings{
+		workerCount: 1,
+		parser:      newRecordIdParser(defaultRecordIdLength),
+		delays:      &DelayStats{},
+	}, nil)
+	var corrupt *corruptObjectError
+	assert.True(t, errors.As(err, &corrupt))
+
+	parser = newRecordIdParser(defaultRecordIdLength)
+	parser.skipCorrupt = true
+	inputMap = newInputMap(3)
+	found, totals, err = validate_localdir(context.Background(), corruptDir, inputMap, &validatorSettings{
+		workerCount: 1,
+		parser:      parser,
+		delays:      &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, 2, totals.objects)
+	assert.Equal(t, []string{filepath.Join(corruptDir, "b")}, totals.corruptObjects)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1, "10000002": 1}, inputMap.toMap())
+
+	// Test case 5: a missing directory fails
+	_, _, err = validate_localdir(context.Background(), filepath.Join(dir, "missing"), newInputMap(3), &validatorSettings{
+		workerCount: 1,
+		parser:      newRecordIdParser(defaultRecordIdLength),
+		delays:      &DelayStats{},
+	}, nil)
+	assert.Error(t, err)
+}
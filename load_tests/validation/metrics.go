@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Prefix of the names of the metrics written to METRICS_FILE
+const metricsNamespace = "fluentbit_load_test"
+
+// Results of a destination along with the labels of its metrics
+type MetricResults struct {
+	Destination string
+	LogPrefix   string
+	Results     Results
+}
+
+// A gauge of the results, written once per destination
+type metric struct {
+	name  string
+	help  string
+	value func(results Results) float64
+}
+
+var resultMetrics = []metric{
+	{name: "percent_loss", help: "Percentage of the input records not found in the destination.", value: func(r Results) float64 { return r.PercentLoss }},
+	{name: "missing_records", help: "Number of input records not found in the destination.", value: func(r Results) float64 { return float64(r.Missing) }},
+	{name: "duplicate_records", help: "Number of records found in the destination more than once, not counting their first delivery.", value: func(r Results) float64 { return float64(r.Duplicate) }},
+	{name: "delay_p50_milliseconds", help: "Median delivery delay of the records from the producer timestamp.", value: func(r Results) float64 { return float64(r.DelayP50Ms) }},
+	{name: "delay_p90_milliseconds", help: "90th percentile of the delivery delay of the records from the producer timestamp.", value: func(r Results) float64 { return float64(r.DelayP90Ms) }},
+	{name: "delay_p99_milliseconds", help: "99th percentile of the delivery delay of the records from the producer timestamp.", value: func(r Results) float64 { return float64(r.DelayP99Ms) }},
+	{name: "throughput_records_per_second", help: "Records found per second of the span of the producer timestamps.", value: func(r Results) float64 { return r.ThroughputRecordsSec }},
+}
+
+// Writes the results in the Prometheus text exposition format, e.g. for the textfile collector of the node exporter.
+// Every metric is labelled with the destination and the log prefix of its results.
+// The file is replaced atomically, so that the collector never reads it half written.
+func writeMetrics(path string, results []MetricResults) error {
+	var buffer bytes.Buffer
+	for _, m := range resultMetrics {
+		fmt.Fprintf(&buffer, "# HELP %s_%s %s\n", metricsNamespace, m.name, m.help)
+		fmt.Fprintf(&buffer, "# TYPE %s_%s gauge\n", metricsNamespace, m.name)
+		for _, result := range results {
+			fmt.Fprintf(&buffer, "%s_%s{destination=\"%s\",log_prefix=\"%s\"} %v\n", metricsNamespace, m.name, escapeLabel(result.Destination), escapeLabel(result.LogPrefix), m.value(result.Results))
+		}
+	}
+
+	if err := ioutil.WriteFile(path+".tmp", buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Escapes a label value as required by the Prometheus text exposition format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "validation.prom")
+	err = writeMetrics(path, []MetricResults{
+		{Destination: "s3", LogPrefix: "logs/", Results: Results{PercentLoss: 2, Missing: 20, DelayP99Ms: 1500, ThroughputRecordsSec: 99.5}},
+		{Destination: "cloudwatch", LogPrefix: "stream\"1\"", Results: Results{Duplicate: 3}},
+	})
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(string(data), "\n")
+	assert.Contains(t, lines, "# TYPE fluentbit_load_test_percent_loss gauge")
+	assert.Contains(t, lines, "fluentbit_load_test_percent_loss{destination=\"s3\",log_prefix=\"logs/\"} 2")
+	assert.Contains(t, lines, "fluentbit_load_test_delay_p99_milliseconds{destination=\"s3\",log_prefix=\"logs/\"} 1500")
+	assert.Contains(t, lines, "fluentbit_load_test_throughput_records_per_second{destination=\"s3\",log_prefix=\"logs/\"} 99.5")
+	assert.Contains(t, lines, "fluentbit_load_test_duplicate_records{destination=\"cloudwatch\",log_prefix=\"stream\\\"1\\\"\"} 3")
+
+	// The temporary file is renamed into place
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	openSearchService    = "es"
+	openSearchPageSize   = 1000
+	openSearchScrollTime = "5m"
+)
+
+// Minimal OpenSearch client which signs every request with SigV4 so it works against IAM protected domains
+type OpenSearchClient struct {
+	endpoint   string
+	region     string
+	signer     *v4.Signer
+	httpClient *http.Client
+}
+
+// Subset of the OpenSearch API used for validation, so that it can be mocked in tests
+type openSearchAPI interface {
+	Search(ctx context.Context, index string, body interface{}) (*openSearchResponse, error)
+	Scroll(ctx context.Context, scrollId string) (*openSearchResponse, error)
+	ClearScroll(ctx context.Context, scrollId string) error
+}
+
+// Subset of the search and scroll API response needed for validation
+type openSearchResponse struct {
+	ScrollId string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []struct {
+			Source json.RawMessage `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// Creates a new OpenSearch Client
+func getOpenSearchClient(region string, endpoint string) (*OpenSearchClient, error) {
+	sess, err := getSession(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+
+	// Signed requests are sent by this client rather than the session, it needs the same transport
+	httpClient := &http.Client{Timeout: 1 * time.Minute}
+	transport, err := getTransport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		httpClient.Transport = transport
+	}
+
+	return &OpenSearchClient{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		region:     region,
+		signer:     v4.NewSigner(sess.Config.Credentials),
+		httpClient: httpClient,
+	}, nil
+}
+
+// Sends a SigV4 signed request to the domain and decodes the JSON response into out
+func (c *OpenSearchClient) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The request is created with the body so that it is sent with its length rather than chunked
+	reader := bytes.NewReader(payload)
+	req, err := http.NewRequest(method, c.endpoint+path, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	if _, err = c.signer.Sign(req, reader, openSearchService, c.region, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, respBody)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// Searches the documents of an index, returning the first page and the scroll ID of the following ones
+func (c *OpenSearchClient) Search(ctx context.Context, index string, body interface{}) (*openSearchResponse, error) {
+	var response openSearchResponse
+	err := c.do(ctx, http.MethodPost, "/"+index+"/_search?scroll="+openSearchScrollTime, body, &response)
+	return &response, err
+}
+
+// Returns the next page of a search
+func (c *OpenSearchClient) Scroll(ctx context.Context, scrollId string) (*openSearchResponse, error) {
+	var response openSearchResponse
+	err := c.do(ctx, http.MethodPost, "/_search/scroll", map[string]string{
+		"scroll":    openSearchScrollTime,
+		"scroll_id": scrollId,
+	}, &response)
+	return &response, err
+}
+
+// Releases the search context instead of waiting for it to expire
+func (c *OpenSearchClient) ClearScroll(ctx context.Context, scrollId string) error {
+	return c.do(ctx, http.MethodDelete, "/_search/scroll", map[string][]string{
+		"scroll_id": {scrollId},
+	}, nil)
+}
+
+// Validate logs in an OpenSearch index.
+// This approach utilizes the scroll API to page through all the documents of the index.
+// Similar logic as S3 validation, the record ID is read from the log field of each document.
+// Once ctx is done, the records found so far are returned.
+func validate_opensearch(ctx context.Context, osClient openSearchAPI, index string, inputMap *RecordMap, parser *RecordIdParser) (int, error) {
+	osRecordCounter := 0
+
+	// Only the log is needed from every document
+	sourceFields := []string{"log", "Log"}
+	if parser.field != "" || len(parser.path) > 0 {
+		sourceFields = []string{parser.logField()}
+	}
+
+	response, err := osClient.Search(ctx, index, map[string]interface{}{
+		"size":    openSearchPageSize,
+		"sort":    []string{"_doc"},
+		"_source": sourceFields,
+	})
+	if err != nil && ctx.Err() == nil {
+		return osRecordCounter, fmt.Errorf("error occured to search the documents from index %q: %w", index, err)
+	}
+
+	for len(response.Hits.Hits) > 0 {
+		logrus.Infof("Read %d documents from index %q", len(response.Hits.Hits), index)
+		for _, hit := range response.Hits.Hits {
+			log, ok, decodeError := parser.entryLog(hit.Source)
+			if decodeError != nil {
+				if err := parser.malformedEntry(decodeError, string(hit.Source)); err != nil {
+					return osRecordCounter, fmt.Errorf("error to parse a document from index %q: %w", index, err)
+				}
+				// Skip malform documents (count them as lost logs)
+				continue
+			}
+			if !ok {
+				logrus.Warnf("Malform document without a %q field: %s", parser.logField(), hit.Source)
+				// Skip documents without a log (count them as lost logs)
+				parser.countUnparseable(1)
+				continue
+			}
+
+			recordId, ok := parser.parse(log)
+			if !ok {
+				// Skip documents without a record ID (count them as lost logs)
+				continue
+			}
+			osRecordCounter += 1
+			// Counting the occurrences of this record in the destination
+			countRecord(inputMap, recordId, 1, parser)
+		}
+
+		response, err = osClient.Scroll(ctx, response.ScrollId)
+		if err != nil && ctx.Err() == nil {
+			return osRecordCounter, fmt.Errorf("error occured to scroll the documents from index %q: %w", index, err)
+		}
+	}
+
+	// Release the search context instead of waiting for it to expire
+	if response.ScrollId != "" && ctx.Err() == nil {
+		if err := osClient.ClearScroll(ctx, response.ScrollId); err != nil {
+			logrus.Warnf("Unable to clear the scroll context: %v", err)
+		}
+	}
+
+	return osRecordCounter, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves a page of documents per call, the scroll ID is the index of the next page
+type mockOpenSearch struct {
+	pages [][]string
+	// Scroll IDs of the search contexts cleared
+	cleared []string
+}
+
+func (m *mockOpenSearch) page(index int) *openSearchResponse {
+	response := &openSearchResponse{ScrollId: strconv.Itoa(index + 1)}
+	if index < len(m.pages) {
+		for _, document := range m.pages[index] {
+			response.Hits.Hits = append(response.Hits.Hits, struct {
+				Source json.RawMessage `json:"_source"`
+			}{Source: json.RawMessage(document)})
+		}
+	}
+	return response
+}
+
+func (m *mockOpenSearch) Search(ctx context.Context, index string, body interface{}) (*openSearchResponse, error) {
+	return m.page(0), nil
+}
+
+func (m *mockOpenSearch) Scroll(ctx context.Context, scrollId string) (*openSearchResponse, error) {
+	index, err := strconv.Atoi(scrollId)
+	if err != nil {
+		return nil, err
+	}
+	return m.page(index), nil
+}
+
+func (m *mockOpenSearch) ClearScroll(ctx context.Context, scrollId string) error {
+	m.cleared = append(m.cleared, scrollId)
+	return nil
+}
+
+// Returns an OpenSearch document per log, as indexed by Fluent Bit
+func openSearchDocuments(logs ...string) []string {
+	documents := make([]string, 0, len(logs))
+	for _, log := range logs {
+		documents = append(documents, fmt.Sprintf("{\"log\":%q}", log))
+	}
+	return documents
+}
+
+func TestValidateOpenSearch(t *testing.T) {
+	// Test case 1: the records of every page are counted and the search context is cleared
+	client := &mockOpenSearch{pages: [][]string{
+		openSearchDocuments("10000000_1639151827578_RandomString", "10000001_1639151827578_RandomString"),
+		append(openSearchDocuments("10000000_1639151827578_RandomString"), `{"message":"without a log"}`),
+	}}
+	inputMap := newInputMap(3)
+	parser := newRecordIdParser(defaultRecordIdLength)
+	found, err := validate_opensearch(context.Background(), client, "index", inputMap, parser)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, map[string]int{"10000000": 2, "10000001": 1, "10000002": 0}, inputMap.toMap())
+	assert.Equal(t, 1, parser.unparseableCount())
+	assert.Equal(t, []string{"3"}, client.cleared)
+
+	// Test case 2: malformed documents fail in strict mode
+	client = &mockOpenSearch{pages: [][]string{{`not json`}}}
+	parser = newRecordIdParser(defaultRecordIdLength)
+	parser.strict = true
+	_, err = validate_opensearch(context.Background(), client, "index", newInputMap(1), parser)
+	assert.Error(t, err)
+}
+
+func TestOpenSearchClient(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		if r.URL.Path == "/index/_search" {
+			fmt.Fprint(w, `{"_scroll_id":"scroll","hits":{"hits":[{"_source":{"log":"10000000_1639151827578_RandomString"}}]}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := &OpenSearchClient{
+		endpoint:   server.URL,
+		region:     "us-west-2",
+		signer:     v4.NewSigner(credentials.NewStaticCredentials("id", "secret", "")),
+		httpClient: server.Client(),
+	}
+
+	// Test case 1: the search body is signed and sent with its length
+	response, err := client.Search(context.Background(), "index", map[string]int{"size": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "scroll", response.ScrollId)
+	assert.Len(t, response.Hits.Hits, 1)
+	assert.Equal(t, `{"size":1}`, bodies[0])
+	assert.Equal(t, int64(len(bodies[0])), requests[0].ContentLength)
+	assert.Empty(t, requests[0].TransferEncoding)
+	assert.Contains(t, requests[0].Header.Get("Authorization"), "AWS4-HMAC-SHA256")
+
+	// Test case 2: the scroll context is cleared
+	assert.NoError(t, client.ClearScroll(context.Background(), "scroll"))
+	assert.Equal(t, http.MethodDelete, requests[1].Method)
+	assert.Equal(t, `{"scroll_id":["scroll"]}`, bodies[1])
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// Number of rows of the log column read at once from a Parquet file
+const parquetBatchSize = 1000
+
+// Parquet file held in memory, the reader seeks to the footer and to every column chunk so the file is never streamed
+type parquetBuffer struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newParquetBuffer(data []byte) *parquetBuffer {
+	return &parquetBuffer{Reader: bytes.NewReader(data), data: data}
+}
+
+// The reader opens the file again for every column it reads
+func (b *parquetBuffer) Open(name string) (source.ParquetFile, error) {
+	return newParquetBuffer(b.data), nil
+}
+
+func (b *parquetBuffer) Create(name string) (source.ParquetFile, error) {
+	return nil, errors.New("parquet files are only read")
+}
+
+func (b *parquetBuffer) Write(p []byte) (int, error) {
+	return 0, errors.New("parquet files are only read")
+}
+
+func (b *parquetBuffer) Close() error {
+	return nil
+}
+
+// Reads the log column of a Parquet file, e.g. written by the record format conversion of Firehose, and calls fn with every log.
+// The column is the log field or the path to it, matched case insensitively since Glue and Iceberg schemas are lower case.
+// Rows without a log, or a log which is not a string, are counted as unparseable.
+func (p *RecordIdParser) scanParquetLogs(data []byte, fn func(log string)) error {
+	file := newParquetBuffer(data)
+	parquetReader, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		return fmt.Errorf("error to read the parquet footer: %w", err)
+	}
+	defer parquetReader.ReadStop()
+
+	column, ok := parquetColumn(parquetReader, p.logField())
+	if !ok {
+		return fmt.Errorf("no column %q in the parquet schema", p.logField())
+	}
+
+	for remaining := parquetReader.GetNumRows(); remaining > 0; remaining -= parquetBatchSize {
+		values, _, _, err := parquetReader.ReadColumnByPath(column, parquetBatchSize)
+		if err != nil {
+			return fmt.Errorf("error to read column %q: %w", p.logField(), err)
+		}
+		for _, value := range values {
+			log, ok := value.(string)
+			if !ok {
+				logrus.Warnf("Malform parquet row with a %q of %v", p.logField(), value)
+				// Skip rows without a log (count them as lost logs)
+				p.countUnparseable(1)
+				continue
+			}
+			fn(log)
+		}
+	}
+	return nil
+}
+
+// Same as scanParquetLogs, for a Parquet file read from a stream, e.g. an S3 object.
+// The whole file is held in memory since Parquet is read from its footer.
+func (p *RecordIdParser) readParquetLogs(reader io.Reader, fn func(log string)) error {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return p.scanParquetLogs(data, fn)
+}
+
+// Returns the path of a column of the schema by its field path, e.g. "data.log", as the reader expects it
+func parquetColumn(parquetReader *reader.ParquetReader, field string) (string, bool) {
+	root := parquetReader.SchemaHandler.GetRootExName()
+	for exPath := range parquetReader.SchemaHandler.ExPathToInPath {
+		path := common.StrToPath(exPath)
+		if len(path) < 2 || path[0] != root {
+			continue
+		}
+		if strings.EqualFold(strings.Join(path[1:], "."), field) {
+			return exPath, true
+		}
+	}
+	return "", false
+}
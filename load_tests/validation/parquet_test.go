@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Schema of a Parquet file with an optional string log column
+const parquetLogSchema = `{"Tag": "name=parquet_go_root, repetitiontype=REQUIRED", "Fields": [
+	{"Tag": "name=log, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"}
+]}`
+
+// Schema of a Parquet file with the log nested in a data column
+const parquetNestedLogSchema = `{"Tag": "name=parquet_go_root, repetitiontype=REQUIRED", "Fields": [
+	{"Tag": "name=data, repetitiontype=REQUIRED", "Fields": [
+		{"Tag": "name=log, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"}
+	]}
+]}`
+
+// Returns a Parquet file with a row per JSON encoded row
+func parquetFile(t *testing.T, schema string, rows ...interface{}) []byte {
+	var buffer bytes.Buffer
+	parquetWriter, err := writer.NewJSONWriterFromWriter(schema, &buffer, 1)
+	assert.NoError(t, err)
+	for _, row := range rows {
+		encoded, err := json.Marshal(row)
+		assert.NoError(t, err)
+		assert.NoError(t, parquetWriter.Write(string(encoded)))
+	}
+	assert.NoError(t, parquetWriter.WriteStop())
+	return buffer.Bytes()
+}
+
+// Returns a Parquet file with the logs in its log column
+func parquetLogs(t *testing.T, logs ...string) []byte {
+	rows := make([]interface{}, 0, len(logs))
+	for _, log := range logs {
+		rows = append(rows, map[string]string{"log": log})
+	}
+	return parquetFile(t, parquetLogSchema, rows...)
+}
+
+// Serves the objects of mockS3 as Parquet files with the logs in their log column
+type mockS3Parquet struct {
+	*mockS3
+	t *testing.T
+}
+
+func (m *mockS3Parquet) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(bytes.NewReader(parquetLogs(m.t, m.objects[aws.StringValue(input.Key)]...))),
+	}, nil
+}
+
+func TestScanParquetLogs(t *testing.T) {
+	scan := func(parser *RecordIdParser, data []byte) ([]string, error) {
+		var logs []string
+		err := parser.scanParquetLogs(data, func(log string) {
+			logs = append(logs, log)
+		})
+		return logs, err
+	}
+
+	// Test case 1: the default log field matches the lower case column
+	parser := newRecordIdParser(defaultRecordIdLength)
+	logs, err := scan(parser, parquetLogs(t, producerLogs("10000000", "10000001")...))
+	assert.NoError(t, err)
+	assert.Equal(t, producerLogs("10000000", "10000001"), logs)
+
+	// Test case 2: rows without a log are counted as unparseable
+	parser = newRecordIdParser(defaultRecordIdLength)
+	logs, err = scan(parser, parquetFile(t, parquetLogSchema, map[string]string{"log": "10000000_1639151827578_RandomString"}, map[string]interface{}{"log": nil}))
+	assert.NoError(t, err)
+	assert.Equal(t, producerLogs("10000000"), logs)
+	assert.Equal(t, 1, parser.unparseableCount())
+
+	// Test case 3: the log is read from a nested column with a log path
+	parser = newRecordIdParser(defaultRecordIdLength)
+	parser.path = []string{"data", "log"}
+	logs, err = scan(parser, parquetFile(t, parquetNestedLogSchema, map[string]interface{}{"data": map[string]string{"log": "10000000_1639151827578_RandomString"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, producerLogs("10000000"), logs)
+
+	// Test case 4: the rows are read in batches
+	var recordIds []string
+	for i := 0; i < parquetBatchSize+10; i++ {
+		recordIds = append(recordIds, fmt.Sprintf("%d", idCounterBase+i))
+	}
+	logs, err = scan(newRecordIdParser(defaultRecordIdLength), parquetLogs(t, producerLogs(recordIds...)...))
+	assert.NoError(t, err)
+	assert.Equal(t, producerLogs(recordIds...), logs)
+
+	// Test case 5: a file without the log column fails
+	parser = newRecordIdParser(defaultRecordIdLength)
+	parser.field = "message"
+	_, err = scan(parser, parquetLogs(t, producerLogs("10000000")...))
+	assert.Error(t, err)
+
+	// Test case 6: data which is not Parquet fails
+	_, err = scan(newRecordIdParser(defaultRecordIdLength), []byte("{\"log\":\"10000000_1639151827578_RandomString\"}\n"))
+	assert.Error(t, err)
+}
+
+func TestValidateS3Parquet(t *testing.T) {
+	client := &mockS3Parquet{t: t, mockS3: &mockS3{
+		pages: [][]string{{"a.parquet", "b.parquet"}},
+		objects: map[string][]string{
+			"a.parquet": producerLogs("10000000", "10000001"),
+			"b.parquet": producerLogs("10000001"),
+		},
+	}}
+	parser := newRecordIdParser(defaultRecordIdLength)
+	parser.parquet = true
+
+	// Test case 1: the records of every row are counted like the lines of other objects
+	inputMap := newInputMap(2)
+	found, totals, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, inputMap, &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		parser:       parser,
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, 2, totals.objects)
+	assert.Equal(t, 2, totals.plainObjects)
+	occurrences, _ := inputMap.get("10000001")
+	assert.Equal(t, 2, occurrences)
+
+	// Test case 2: JSON lines objects are not Parquet files
+	_, _, err = validate_s3(context.Background(), client.mockS3, "bucket", []string{"prefix"}, newInputMap(2), &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		parser:       parser,
+		delays:       &DelayStats{},
+	}, nil)
+	assert.Error(t, err)
+}
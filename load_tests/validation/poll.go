@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Validates a destination again every interval until every input record was found, or the timeout passed.
+// Only CloudWatch searched with FilterLogEvents can be queried for given records, its passes after the first search the
+// records still missing alone and add what they find to the earlier passes. Duplicates of the records found by an earlier
+// pass are not counted after it. Every other destination, and CloudWatch read with GetLogEvents or Logs Insights, is
+// read in full again by each pass with a fresh copy of inputMap, so the result of the last pass is returned.
+// Its completion is the time until every record was found, 0 if some never were.
+// Polling stops early once ctx is done, or if validate returns nil.
+func pollDestination(ctx context.Context, interval time.Duration, timeout time.Duration, inputMap *RecordMap, validate func(inputMap *RecordMap) *destinationResult) *destinationResult {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	result := validate(inputMap)
+	for pass := 1; ; pass++ {
+		if result == nil {
+			return nil
+		}
+
+		missing := 0
+		result.inputMap.each(func(recordId string, occurrences int) {
+			if occurrences == 0 {
+				missing++
+			}
+		})
+		if missing == 0 {
+			result.completion = time.Since(start)
+			logrus.Infof("Found every record in %s after %d passes in %s", result.destination, pass, result.completion.Round(time.Millisecond))
+			return result
+		}
+
+		if ctx.Err() != nil || time.Now().Add(interval).After(deadline) {
+			logrus.Warnf("%d records still missing in %s after %d passes, stopped polling", missing, result.destination, pass)
+			return result
+		}
+		logrus.Infof("%d records missing in %s after pass %d, polling again in %s", missing, result.destination, pass, interval)
+		if !sleepWithContext(ctx, interval) {
+			return result
+		}
+
+		if !result.searched {
+			result = validate(inputMap.reset())
+			continue
+		}
+		if found := validate(result.inputMap.missing()); found != nil {
+			result.addPass(found)
+		}
+	}
+}
+
+// Adds the records found by a pass which only searched the records still missing to the result of the earlier passes
+func (r *destinationResult) addPass(pass *destinationResult) {
+	pass.inputMap.each(func(recordId string, occurrences int) {
+		if occurrences > 0 {
+			r.inputMap.set(recordId, occurrences)
+		}
+	})
+	r.found += pass.found
+	r.parser.countUnparseable(pass.parser.unparseableCount())
+	r.parser.malformed += int64(pass.parser.malformedCount())
+	r.parser.foreign += int64(pass.parser.foreignCount())
+	if payloads := pass.parser.payloadCounts(); payloads != nil {
+		r.parser.truncated += int64(payloads.Truncated)
+		r.parser.corrupted += int64(payloads.Corrupted)
+	}
+	r.delays.merge(pass.delays)
+	if pass.ordering != nil && r.ordering != nil {
+		for stream, outOfOrder := range pass.ordering.outOfOrder {
+			r.ordering.add(stream, outOfOrder)
+		}
+	}
+	// The records of each log group are added up by log group
+	for _, records := range pass.logGroups {
+		added := false
+		for i := range r.logGroups {
+			if r.logGroups[i].LogGroup == records.LogGroup {
+				r.logGroups[i].Records += records.Records
+				added = true
+			}
+		}
+		if !added {
+			r.logGroups = append(r.logGroups, records)
+		}
+	}
+}
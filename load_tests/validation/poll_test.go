@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollDestination(t *testing.T) {
+	// Test case 1: a record arrives on the third pass
+	passes := 0
+	result := pollDestination(context.Background(), time.Millisecond, time.Minute, recordMapOf(map[string]int{"10000000": 0, "10000001": 0}), func(inputMap *RecordMap) *destinationResult {
+		passes++
+		assert.Equal(t, 2, inputMap.len())
+		inputMap.set("10000000", 1)
+		if passes == 3 {
+			inputMap.set("10000001", 1)
+		}
+		return &destinationResult{destination: "s3", found: passes, inputMap: inputMap}
+	})
+	assert.Equal(t, 3, passes)
+	assert.Equal(t, 3, result.found)
+	assert.True(t, result.completion > 0)
+
+	// Test case 2: a record which never arrives stops polling at the timeout
+	passes = 0
+	result = pollDestination(context.Background(), 50*time.Millisecond, 120*time.Millisecond, recordMapOf(map[string]int{"10000000": 0}), func(inputMap *RecordMap) *destinationResult {
+		passes++
+		return &destinationResult{destination: "s3", inputMap: inputMap}
+	})
+	assert.Equal(t, 3, passes)
+	assert.Equal(t, time.Duration(0), result.completion)
+
+	// Test case 3: no more passes once the run is over
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	passes = 0
+	result = pollDestination(ctx, time.Millisecond, time.Minute, recordMapOf(map[string]int{"10000000": 0}), func(inputMap *RecordMap) *destinationResult {
+		passes++
+		return &destinationResult{destination: "s3", inputMap: inputMap}
+	})
+	assert.Equal(t, 1, passes)
+	assert.NotNil(t, result)
+
+	// Test case 4: nothing to poll when only an estimate was printed
+	assert.Nil(t, pollDestination(context.Background(), time.Millisecond, time.Minute, newKeyedRecordMap(nil), func(*RecordMap) *destinationResult { return nil }))
+
+	// Test case 5: passes after the first only search the records still missing when the destination can be searched
+	var searched []int
+	result = pollDestination(context.Background(), time.Millisecond, time.Minute, recordMapOf(map[string]int{"10000000": 0, "10000001": 0, "10000002": 0}), func(inputMap *RecordMap) *destinationResult {
+		searched = append(searched, inputMap.len())
+		found := 0
+		for _, recordId := range []string{"10000000", "10000001", "10000002"}[:len(searched)] {
+			if _, ok := inputMap.get(recordId); ok {
+				inputMap.set(recordId, 1)
+				found++
+			}
+		}
+		return &destinationResult{
+			destination: "cloudwatch",
+			found:       found,
+			inputMap:    inputMap,
+			parser:      &RecordIdParser{unparseable: 1},
+			delays:      &DelayStats{},
+			logGroups:   []LogGroupRecords{{LogGroup: "group", Records: found}},
+			searched:    true,
+		}
+	})
+	assert.Equal(t, []int{3, 2, 1}, searched)
+	assert.Equal(t, 3, result.found)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1, "10000002": 1}, result.inputMap.toMap())
+	assert.Equal(t, 3, result.parser.unparseableCount())
+	assert.Equal(t, []LogGroupRecords{{LogGroup: "group", Records: 3}}, result.logGroups)
+	assert.True(t, result.completion > 0)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// AWS account and region a destination is validated in, reported with its results to tell environments apart
+type AWSIdentity struct {
+	Account string
+	Region  string
+}
+
+type stsAPI interface {
+	GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error)
+}
+
+// Creates a new STS Client
+func getSTSClient(region string) (*sts.STS, error) {
+	sess, err := getSession(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sts.New(sess), nil
+}
+
+// Returns the account and ARN of the credentials the validator runs with, after assuming ROLE_ARN if set,
+// with a single GetCallerIdentity call. The call requires no permission, it only fails without valid credentials.
+func preflightIdentity(ctx context.Context, stsClient stsAPI) (string, string, error) {
+	var output *sts.GetCallerIdentityOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		output, err = stsClient.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+		return err
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to get the caller identity, %s: %w", preflightHint(err, "sts:GetCallerIdentity"), err)
+	}
+	return aws.StringValue(output.Account), aws.StringValue(output.Arn), nil
+}
+
+// Checks that a bucket can be listed with a single HeadBucket call, which requires the same s3:ListBucket permission
+func preflightS3(ctx context.Context, s3Client s3API, bucket string) error {
+	err := retryWithBackoff(ctx, func() error {
+		_, err := s3Client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to access bucket %q, %s: %w", bucket, preflightHint(err, "s3:ListBucket"), err)
+	}
+	return nil
+}
+
+// Checks that the log group exists and can be described, with a single DescribeLogGroups call of one log group
+func preflightCloudWatch(ctx context.Context, cwClient cwAPI, logGroup string) error {
+	var output *cloudwatchlogs.DescribeLogGroupsOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		output, err = cwClient.DescribeLogGroupsWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+			LogGroupNamePrefix: aws.String(logGroup),
+			Limit:              aws.Int64(1),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to describe log group %q, %s: %w", logGroup, preflightHint(err, "logs:DescribeLogGroups"), err)
+	}
+	// The prefix matches the log group itself first, as the log groups are sorted by name
+	if len(output.LogGroups) == 0 || aws.StringValue(output.LogGroups[0].LogGroupName) != logGroup {
+		return fmt.Errorf("log group %q does not exist", logGroup)
+	}
+	return nil
+}
+
+// Checks that the table exists and can be described with a single DescribeTable call
+func preflightDynamo(ctx context.Context, dynamoClient dynamoAPI, table string) error {
+	err := retryWithBackoff(ctx, func() error {
+		_, err := dynamoClient.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to describe table %q, %s: %w", table, preflightHint(err, "dynamodb:DescribeTable"), err)
+	}
+	return nil
+}
+
+// Checks that the queue exists and its attributes can be read with a single GetQueueAttributes call
+func preflightSQS(ctx context.Context, sqsClient sqsAPI, queueUrl string) error {
+	err := retryWithBackoff(ctx, func() error {
+		_, err := sqsClient.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queueUrl),
+			AttributeNames: []*string{aws.String(sqs.QueueAttributeNameApproximateNumberOfMessages)},
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to access queue %q, %s: %w", queueUrl, preflightHint(err, "sqs:GetQueueAttributes"), err)
+	}
+	return nil
+}
+
+// Returns what most likely went wrong when a preflight call failed, naming the permission it requires
+func preflightHint(err error, permission string) string {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return "the call failed"
+	}
+	switch awsErr.Code() {
+	case request.ErrCodeRequestError:
+		return "the service could not be reached"
+	case "NoCredentialProviders":
+		return "no AWS credentials were found"
+	case "ExpiredToken", "ExpiredTokenException", "InvalidClientTokenId", "UnrecognizedClientException", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return "the AWS credentials are invalid or expired"
+	case "AccessDenied", "AccessDeniedException", "Forbidden":
+		return "the validator is likely missing the " + permission + " permission"
+	case "NotFound", "NoSuchBucket", "ResourceNotFoundException", sqs.ErrCodeQueueDoesNotExist:
+		return "it does not exist"
+	}
+	return "the call failed"
+}
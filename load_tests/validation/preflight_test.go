@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fails HeadBucket with err, if any
+type mockS3Head struct {
+	s3API
+	err error
+}
+
+func (m *mockS3Head) HeadBucketWithContext(ctx aws.Context, input *s3.HeadBucketInput, opts ...request.Option) (*s3.HeadBucketOutput, error) {
+	return &s3.HeadBucketOutput{}, m.err
+}
+
+// Serves the log groups starting with the requested prefix, in order of their names
+type mockCWLogGroups struct {
+	cwAPI
+	logGroups []string
+	err       error
+}
+
+func (m *mockCWLogGroups) DescribeLogGroupsWithContext(ctx aws.Context, input *cloudwatchlogs.DescribeLogGroupsInput, opts ...request.Option) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	output := &cloudwatchlogs.DescribeLogGroupsOutput{}
+	for _, logGroup := range m.logGroups {
+		if len(output.LogGroups) < int(aws.Int64Value(input.Limit)) && strings.HasPrefix(logGroup, aws.StringValue(input.LogGroupNamePrefix)) {
+			output.LogGroups = append(output.LogGroups, &cloudwatchlogs.LogGroup{LogGroupName: aws.String(logGroup)})
+		}
+	}
+	return output, nil
+}
+
+func TestPreflightS3(t *testing.T) {
+	assert.NoError(t, preflightS3(context.Background(), &mockS3Head{}, "bucket"))
+
+	err := preflightS3(context.Background(), &mockS3Head{err: awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), 403, "")}, "bucket")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "s3:ListBucket")
+}
+
+func TestPreflightCloudWatch(t *testing.T) {
+	client := &mockCWLogGroups{logGroups: []string{"fluent-bit", "fluent-bit-load-test"}}
+
+	// Test case 1: the log group sorts first among the ones it is a prefix of
+	assert.NoError(t, preflightCloudWatch(context.Background(), client, "fluent-bit"))
+
+	// Test case 2: only log groups the name is a prefix of
+	err := preflightCloudWatch(context.Background(), client, "fluent")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
+
+	// Test case 3: missing credentials
+	client.err = awserr.New("NoCredentialProviders", "no valid providers in chain", nil)
+	err = preflightCloudWatch(context.Background(), client, "fluent-bit")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no AWS credentials were found")
+}
+
+func TestPreflightSQS(t *testing.T) {
+	assert.NoError(t, preflightSQS(context.Background(), &mockSQS{}, "queue"))
+
+	err := preflightSQS(context.Background(), &mockSQS{err: awserr.New(sqs.ErrCodeQueueDoesNotExist, "The specified queue does not exist", nil)}, "queue")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "it does not exist")
+}
+
+// Returns the identity of an account, or fails with err if set
+type mockSTS struct {
+	err error
+}
+
+func (m *mockSTS) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &sts.GetCallerIdentityOutput{Account: aws.String("123456789012"), Arn: aws.String("arn:aws:iam::123456789012:user/validator")}, nil
+}
+
+func TestPreflightIdentity(t *testing.T) {
+	account, arn, err := preflightIdentity(context.Background(), &mockSTS{})
+	assert.NoError(t, err)
+	assert.Equal(t, "123456789012", account)
+	assert.Equal(t, "arn:aws:iam::123456789012:user/validator", arn)
+
+	_, _, err = preflightIdentity(context.Background(), &mockSTS{err: awserr.New("InvalidClientTokenId", "The security token included in the request is invalid", nil)})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the AWS credentials are invalid or expired")
+}
+
+func TestPreflightHint(t *testing.T) {
+	assert.Equal(t, "the validator is likely missing the logs:DescribeLogGroups permission", preflightHint(awserr.New("AccessDeniedException", "denied", nil), "logs:DescribeLogGroups"))
+	assert.Equal(t, "the AWS credentials are invalid or expired", preflightHint(awserr.New("ExpiredToken", "expired", nil), ""))
+	assert.Equal(t, "it does not exist", preflightHint(awserr.New("ResourceNotFoundException", "missing", nil), ""))
+	assert.Equal(t, "the service could not be reached", preflightHint(awserr.New(request.ErrCodeRequestError, "send request failed", nil), ""))
+	assert.Equal(t, "the call failed", preflightHint(errors.New("unexpected"), ""))
+}
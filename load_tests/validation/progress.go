@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const progressPeriod = 5 * time.Second
+
+// Periodically reports how many records have been processed so far while a destination is validated.
+// A nil Progress is valid and reports nothing, so validators can update it unconditionally.
+type Progress struct {
+	totalInput int
+	// Objects or events the records were read from
+	unit    string
+	records int64
+	units   int64
+	done    chan struct{}
+}
+
+// Creates a Progress and starts reporting it every period until stop is called
+func startProgress(totalInput int, unit string, period time.Duration) *Progress {
+	p := &Progress{
+		totalInput: totalInput,
+		unit:       unit,
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				logrus.Info(p.line())
+			case <-p.done:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// Adds the records found in a number of objects or events, safe for concurrent use
+func (p *Progress) add(records int, units int) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.records, int64(records))
+	atomic.AddInt64(&p.units, int64(units))
+}
+
+// Stops the periodic reports
+func (p *Progress) stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+}
+
+// Returns the progress so far, with the records processed as a percentage of the input records
+func (p *Progress) line() string {
+	records := atomic.LoadInt64(&p.records)
+	units := atomic.LoadInt64(&p.units)
+
+	percent := 0.0
+	if p.totalInput > 0 {
+		percent = float64(records) * 100 / float64(p.totalInput)
+	}
+	return fmt.Sprintf("Progress: %d records (%.1f%% of input) processed from %d %s", records, percent, units, p.unit)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	p := startProgress(200, "objects", time.Hour)
+	defer p.stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.add(5, 1)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, "Progress: 50 records (25.0% of input) processed from 10 objects", p.line())
+}
+
+func TestNilProgress(t *testing.T) {
+	var p *Progress
+	assert.NotPanics(t, func() {
+		p.add(1, 1)
+		p.stop()
+	})
+}
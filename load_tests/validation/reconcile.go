@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Number of records missing from a single destination, which every other destination received
+type DestinationMissing struct {
+	Destination string `json:"destination"`
+	Missing     int    `json:"missing"`
+}
+
+// Records missing from some of several destinations which should each receive every record, printed by print_reconciliation.
+// Records missing from more than one but not every destination, e.g. two of three, are only counted in the results of each destination.
+type Reconciliation struct {
+	MissingOnly []DestinationMissing `json:"missing_only"`
+	MissingAll  int                  `json:"missing_all"`
+}
+
+// Compares the records found in every destination, each of which counted the same input records on its own.
+// Also returns the records as found in any destination, once each, so that the ones missing from every destination can be written.
+func reconcile(results []*destinationResult) (Reconciliation, *RecordMap) {
+	reconciliation := Reconciliation{MissingOnly: make([]DestinationMissing, len(results))}
+	for i, result := range results {
+		reconciliation.MissingOnly[i].Destination = result.destination
+	}
+
+	delivered := results[0].inputMap.reset()
+	results[0].inputMap.each(func(recordId string, occurrences int) {
+		missing := 0
+		// Destination missing the record, the only one if missing is 1
+		missingFrom := 0
+		for i, result := range results {
+			if i > 0 {
+				occurrences, _ = result.inputMap.get(recordId)
+			}
+			if occurrences == 0 {
+				missing++
+				missingFrom = i
+			}
+		}
+
+		switch missing {
+		case len(results):
+			reconciliation.MissingAll++
+			return
+		case 1:
+			reconciliation.MissingOnly[missingFrom].Missing++
+		}
+		delivered.set(recordId, 1)
+	})
+	return reconciliation, delivered
+}
+
+// Prints the reconciliation in the same format as the results
+func print_reconciliation(reconciliation Reconciliation, outputFormat string) {
+	if outputFormat == "json" {
+		output, err := json.Marshal(reconciliation)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to marshal the reconciliation: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	for _, missing := range reconciliation.MissingOnly {
+		fmt.Printf("missing_only_%s,  %d\n", missing.Destination, missing.Missing)
+	}
+	fmt.Println("missing_all, ", reconciliation.MissingAll)
+}
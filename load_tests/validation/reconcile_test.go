@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns the result of a destination which found the records with the given occurrences
+func foundResult(destination string, occurrences map[string]int) *destinationResult {
+	inputMap := newInputMap(4)
+	for recordId, count := range occurrences {
+		inputMap.set(recordId, count)
+	}
+	return &destinationResult{destination: destination, inputMap: inputMap}
+}
+
+func TestReconcile(t *testing.T) {
+	// Test case 1: records missing from either destination, from both, or from neither
+	s3 := foundResult("s3", map[string]int{"10000000": 1, "10000002": 2})
+	cloudwatch := foundResult("cloudwatch", map[string]int{"10000000": 1, "10000001": 1})
+	reconciliation, delivered := reconcile([]*destinationResult{s3, cloudwatch})
+	assert.Equal(t, Reconciliation{
+		MissingOnly: []DestinationMissing{{Destination: "s3", Missing: 1}, {Destination: "cloudwatch", Missing: 1}},
+		MissingAll:  1,
+	}, reconciliation)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1, "10000002": 1, "10000003": 0}, delivered.toMap())
+
+	// Test case 2: records missing from two of three destinations are neither missing from one only nor from all
+	kinesis := foundResult("kinesis", map[string]int{"10000000": 1, "10000001": 1, "10000002": 1, "10000003": 1})
+	reconciliation, delivered = reconcile([]*destinationResult{s3, cloudwatch, kinesis})
+	assert.Equal(t, Reconciliation{
+		MissingOnly: []DestinationMissing{{Destination: "s3", Missing: 1}, {Destination: "cloudwatch", Missing: 1}, {Destination: "kinesis", Missing: 0}},
+		MissingAll:  0,
+	}, reconciliation)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 1, "10000002": 1, "10000003": 1}, delivered.toMap())
+}
@@ -0,0 +1,857 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRecordIdLength = 8
+	recordIdGroup         = "id"
+	timestampGroup        = "timestamp"
+	// Field of the JSON log entries holding the log, matched case insensitively
+	defaultLogField = "Log"
+	// Milliseconds since epoch, e.g. 1639151827578
+	timestampLength = 13
+	// Longest line read from a destination, longer lines fail the validation
+	maxLineSize = 16 * 1024 * 1024
+	// Record delimiter of JSON log entries concatenated without any separator
+	recordDelimiterJSON = "json"
+)
+
+// Extracts the unique record ID from the log entries written by our producer
+type RecordIdParser struct {
+	// Number of leading characters of the log which make up the record ID
+	length int
+	// Optional expression whose "id" capture group is the record ID, takes precedence over length
+	regex          *regexp.Regexp
+	group          int
+	timestampGroup int
+	// Number of logs without a record ID, updated concurrently by the S3 workers
+	unparseable int64
+	// Number of lines which are not JSON log entries, updated concurrently by the S3 workers
+	malformed int64
+	// Fail on lines which are not JSON log entries instead of counting them
+	strict bool
+	// Count and skip the rest of compressed objects with a corrupt gzip stream instead of failing
+	skipCorrupt bool
+	// Lines are the logs themselves rather than JSON log entries
+	raw bool
+	// Objects are Parquet files, e.g. converted by Firehose, whose log column is read rather than their lines
+	parquet bool
+	// Field of the JSON log entries holding the log, defaultLogField if empty
+	field string
+	// Fields of the nested JSON objects leading to the log, e.g. ["data", "log"], used instead of field if set
+	path []string
+	// Separator of the records, a newline (optionally preceded by a carriage return) if empty
+	delimiter string
+	// Records are JSON log entries concatenated without a separator, read one after the other
+	concatenated bool
+	// Records are base64 encoded, e.g. by a Firehose transformation Lambda, and decoded before they are parsed
+	base64 bool
+	// Lines are the failed records Firehose writes to its S3 error output, each holding an encoded record
+	firehoseErrors bool
+	// Range of the record IDs sent by the producer, from minId up to but excluding maxId. Not checked if maxId is 0
+	minId int
+	maxId int
+	// IDs sent by the producer when they are read from a file, checked instead of the range if set
+	expectedIds map[string]bool
+	// Records are counted without being input records, as only duplicates are validated and the input map starts empty
+	duplicatesOnly bool
+	// Full log sent by the producer for every record ID, the delivered logs are compared to it if set
+	payloads map[string]string
+	// Length of every log sent by the producer, the delivered logs are compared to it if set
+	expectedLength int
+	// Number of logs delivered with a truncated or otherwise changed payload, updated concurrently
+	truncated int64
+	corrupted int64
+	// Number of records with an ID outside of the range, e.g. of other tests sharing the destination, updated concurrently
+	foreign int64
+}
+
+// Creates a parser for record IDs made of the first idLength characters of the log
+func newRecordIdParser(idLength int) *RecordIdParser {
+	return &RecordIdParser{
+		length: idLength,
+	}
+}
+
+// Creates a parser for record IDs captured by the "id" group of the given expression
+// An optional "timestamp" group captures the producer timestamp in milliseconds since epoch.
+func newRegexRecordIdParser(regex *regexp.Regexp) (*RecordIdParser, error) {
+	parser := &RecordIdParser{
+		regex: regex,
+	}
+
+	for i, name := range regex.SubexpNames() {
+		switch name {
+		case recordIdGroup:
+			parser.group = i
+		case timestampGroup:
+			parser.timestampGroup = i
+		}
+	}
+
+	if parser.group == 0 {
+		return nil, fmt.Errorf("expression %q has no capture group named %q", regex.String(), recordIdGroup)
+	}
+	return parser, nil
+}
+
+// Returns the record ID of a log, or false if the log does not contain one or the ID is not expected.
+// With expected payloads or an expected length, the log is compared to the payload of its record ID or the length as well.
+func (p *RecordIdParser) parse(log string) (string, bool) {
+	recordId, ok := p.recordId(log)
+	if !ok {
+		if p.regex != nil {
+			logrus.Warnf("Malform log entry not matching the record ID expression: %s", log)
+		} else {
+			logrus.Warnf("Malform log entry shorter than the record ID length %d: %s", p.length, log)
+		}
+		p.countUnparseable(1)
+		return "", false
+	}
+
+	recordId, ok = p.checkExpected(recordId)
+	if ok && p.payloads != nil {
+		p.checkPayload(recordId, log)
+	}
+	if ok && p.expectedLength > 0 {
+		p.checkLength(recordId, log)
+	}
+	return recordId, ok
+}
+
+// Returns the record ID of a log without counting anything, or false if the log does not contain one
+func (p *RecordIdParser) recordId(log string) (string, bool) {
+	if p.regex != nil {
+		match := p.regex.FindStringSubmatch(log)
+		if match == nil || match[p.group] == "" {
+			return "", false
+		}
+		return match[p.group], true
+	}
+
+	if len(log) < p.length {
+		return "", false
+	}
+	return log[:p.length], true
+}
+
+// Counts a log which differs from the expected payload of its record ID, as truncated if it is a prefix of it
+func (p *RecordIdParser) checkPayload(recordId string, log string) {
+	payload, ok := p.payloads[recordId]
+	if !ok || log == payload {
+		return
+	}
+	if strings.HasPrefix(payload, log) {
+		logrus.Debugf("Truncated payload of record ID %s, %d of %d characters delivered", recordId, len(log), len(payload))
+		atomic.AddInt64(&p.truncated, 1)
+		return
+	}
+	logrus.Debugf("Corrupted payload of record ID %s: %s", recordId, log)
+	atomic.AddInt64(&p.corrupted, 1)
+}
+
+// Counts a log whose length differs from the expected length, as truncated if it is shorter.
+// The record ID may survive a truncation which chops the rest of the log, which would go unnoticed otherwise.
+func (p *RecordIdParser) checkLength(recordId string, log string) {
+	if len(log) == p.expectedLength {
+		return
+	}
+	if len(log) < p.expectedLength {
+		logrus.Debugf("Truncated log of record ID %s, %d of %d characters delivered", recordId, len(log), p.expectedLength)
+		atomic.AddInt64(&p.truncated, 1)
+		return
+	}
+	logrus.Debugf("Corrupted log of record ID %s, %d instead of %d characters delivered", recordId, len(log), p.expectedLength)
+	atomic.AddInt64(&p.corrupted, 1)
+}
+
+// Returns the numbers of logs with a truncated or corrupted payload so far, or nil if neither the payloads nor their length are verified
+func (p *RecordIdParser) payloadCounts() *PayloadCounts {
+	if p.payloads == nil && p.expectedLength == 0 {
+		return nil
+	}
+	return &PayloadCounts{
+		Truncated: int(atomic.LoadInt64(&p.truncated)),
+		Corrupted: int(atomic.LoadInt64(&p.corrupted)),
+	}
+}
+
+// Returns the record ID, or false and counts it as foreign if it is not one of the expected IDs
+// or not a number within the expected range
+func (p *RecordIdParser) checkExpected(recordId string) (string, bool) {
+	if p.expectedIds != nil {
+		if !p.expectedIds[recordId] {
+			logrus.Debugf("Foreign record ID %s not in the expected IDs", recordId)
+			atomic.AddInt64(&p.foreign, 1)
+			return "", false
+		}
+		return recordId, true
+	}
+	if p.maxId == 0 {
+		return recordId, true
+	}
+	if id, err := strconv.Atoi(recordId); err != nil || id < p.minId || id >= p.maxId {
+		logrus.Debugf("Foreign record ID %s outside of the expected range", recordId)
+		atomic.AddInt64(&p.foreign, 1)
+		return "", false
+	}
+	return recordId, true
+}
+
+// Returns the number of records found with an ID outside of the expected range so far
+func (p *RecordIdParser) foreignCount() int {
+	return int(atomic.LoadInt64(&p.foreign))
+}
+
+// Adds logs found without a record ID to the unparseable tally
+func (p *RecordIdParser) countUnparseable(count int) {
+	atomic.AddInt64(&p.unparseable, int64(count))
+}
+
+// Returns the number of logs found without a record ID so far
+func (p *RecordIdParser) unparseableCount() int {
+	return int(atomic.LoadInt64(&p.unparseable))
+}
+
+// Parses delimited JSON log entries and returns the log of each of them.
+// Malform entries are skipped and counted, or returned as an error if the parser is strict.
+// Raw lines are returned as is.
+func (p *RecordIdParser) getLogs(dataByte []byte) ([]string, error) {
+	var logs []string
+	err := p.scanLogs(bytes.NewReader(dataByte), func(log string) {
+		logs = append(logs, log)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// Same as getLogs, but reads the entries one by one and calls fn with each log,
+// so that memory stays flat regardless of the amount of data read.
+func (p *RecordIdParser) scanLogs(reader io.Reader, fn func(log string)) error {
+	if p.concatenated {
+		return p.decodeLogs(reader, fn)
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	if p.delimiter != "" {
+		scanner.Split(splitOnDelimiter([]byte(p.delimiter)))
+	}
+
+	for scanner.Scan() {
+		d := scanner.Bytes()
+		if len(d) == 0 {
+			continue
+		}
+
+		if p.firehoseErrors {
+			record, err := firehoseErrorRecord(d)
+			if err != nil {
+				if err := p.malformedEntry(err, string(d)); err != nil {
+					return err
+				}
+				continue
+			}
+			d = record
+		}
+
+		if p.base64 {
+			decoded, err := base64.StdEncoding.DecodeString(string(d))
+			if err != nil {
+				if err := p.malformedEntry(err, string(d)); err != nil {
+					return err
+				}
+				continue
+			}
+			d = bytes.TrimRight(decoded, "\r\n")
+		}
+
+		if p.raw {
+			fn(string(d))
+			continue
+		}
+
+		if err := p.handleEntry(d, fn); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Same as scanLogs, for JSON log entries concatenated without a separator, e.g. by Firehose without the appended newline.
+// The decoder can not recover from a syntax error, so the remaining data is counted as a single malform entry.
+func (p *RecordIdParser) decodeLogs(reader io.Reader, fn func(log string)) error {
+	decoder := json.NewDecoder(reader)
+	for {
+		var entry json.RawMessage
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var syntaxError *json.SyntaxError
+			if !errors.As(err, &syntaxError) && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			rest, _ := ioutil.ReadAll(decoder.Buffered())
+			return p.malformedEntry(err, string(rest))
+		}
+
+		if err := p.handleEntry(entry, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// Calls fn with the log of a JSON log entry, malform entries and entries without a log are counted instead
+func (p *RecordIdParser) handleEntry(entry []byte, fn func(log string)) error {
+	log, ok, decodeError := p.entryLog(entry)
+	if decodeError != nil {
+		// Skip malform log entries (count them as lost logs)
+		return p.malformedEntry(decodeError, string(entry))
+	}
+	if !ok {
+		logrus.Warnf("Malform log entry without a %q field: %s", p.logField(), entry)
+		// Skip log entries without a log (count them as lost logs)
+		p.countUnparseable(1)
+		return nil
+	}
+
+	fn(log)
+	return nil
+}
+
+// Returns a split function for bufio.Scanner which splits the data on every occurrence of delimiter
+func splitOnDelimiter(delimiter []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.Index(data, delimiter); i >= 0 {
+			return i + len(delimiter), data[:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		// Request more data
+		return 0, nil, nil
+	}
+}
+
+// Returns the name of the field of the JSON log entries holding the log
+func (p *RecordIdParser) logField() string {
+	if len(p.path) > 0 {
+		return strings.Join(p.path, ".")
+	}
+	if p.field == "" {
+		return defaultLogField
+	}
+	return p.field
+}
+
+// Returns the log of a JSON log entry, or false if the entry has no string field holding the log
+func (p *RecordIdParser) entryLog(entry []byte) (string, bool, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(entry, &fields); err != nil {
+		return "", false, err
+	}
+
+	if len(p.path) > 0 {
+		return nestedLog(fields, p.path)
+	}
+
+	value, ok := fields[p.logField()]
+	if !ok && p.field == "" {
+		for name, v := range fields {
+			if strings.EqualFold(name, defaultLogField) {
+				value, ok = v, true
+				break
+			}
+		}
+	}
+
+	log, ok := value.(string)
+	return log, ok, nil
+}
+
+// Returns the string at the end of path in the nested JSON objects, or false if a field is missing or not an object
+func nestedLog(fields map[string]interface{}, path []string) (string, bool, error) {
+	for _, name := range path[:len(path)-1] {
+		nested, ok := fields[name].(map[string]interface{})
+		if !ok {
+			return "", false, nil
+		}
+		fields = nested
+	}
+
+	log, ok := fields[path[len(path)-1]].(string)
+	return log, ok, nil
+}
+
+// Counts an entry which could not be unmarshalled, or returns an error if the parser is strict
+func (p *RecordIdParser) malformedEntry(decodeError error, entry string) error {
+	if p.strict {
+		return fmt.Errorf("malform log entry %q: %w", entry, decodeError)
+	}
+	logrus.Warnf("Malform log entry. Unmarshal Error: %v, Malform entry: %s", decodeError, entry)
+	atomic.AddInt64(&p.malformed, 1)
+	return nil
+}
+
+// Returns the number of entries which could not be unmarshalled so far
+func (p *RecordIdParser) malformedCount() int {
+	return int(atomic.LoadInt64(&p.malformed))
+}
+
+// Returns the producer timestamp of a log, or false if the log does not contain one.
+// Without an expression, the timestamp follows the record ID and a single separator character.
+func (p *RecordIdParser) timestamp(log string) (time.Time, bool) {
+	var value string
+	if p.regex != nil {
+		if p.timestampGroup == 0 {
+			return time.Time{}, false
+		}
+		match := p.regex.FindStringSubmatch(log)
+		if match == nil {
+			return time.Time{}, false
+		}
+		value = match[p.timestampGroup]
+	} else {
+		start := p.length + 1
+		if len(log) < start+timestampLength {
+			return time.Time{}, false
+		}
+		value = log[start : start+timestampLength]
+	}
+
+	milliseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, milliseconds*int64(time.Millisecond)), true
+}
+
+// Maximum number of delays and arrivals kept for the percentiles and the jitter, every one of them if 0.
+// Only set from DELAY_SAMPLE_SIZE, which bounds the memory of huge runs at the cost of estimated percentiles and jitter.
+var delaySampleSize = 0
+
+// Statistics of the delivery delay of the records found in a destination.
+// The count, mean, extremes and histogram are exact for any number of records. The percentiles and the jitter are exact
+// unless delaySampleSize is set, they are then computed from uniform samples of at most that many records and are
+// estimates beyond it, which sampled() tells.
+type DelayStats struct {
+	count int
+	sum   time.Duration
+	min   time.Duration
+	max   time.Duration
+	// Number of delays in each bucket of delayBuckets, nil until the first delay
+	buckets []int
+	// Sample of the delays, kept for the percentiles
+	delays      []time.Duration
+	delaySample reservoir
+	sorted      bool
+	// Earliest and latest producer timestamps of the records
+	earliest time.Time
+	latest   time.Time
+	// Producer and arrival time of the records in nanoseconds since epoch, kept for the jitter
+	arrivals      [][2]int64
+	arrivalSample reservoir
+	// Earliest and latest time a record arrived in the destination, including records without a producer timestamp
+	firstArrival time.Time
+	lastArrival  time.Time
+	// Records which arrived before their producer timestamp, so the producer clock is ahead of the destination one.
+	// They are left out of the delays, and the time they arrived early is tracked instead.
+	skewed  int
+	skewSum time.Duration
+	skewMax time.Duration
+	// First producer timestamp of every record ID, only kept for the time series when not nil.
+	// Unlike the samples it grows with the records of the run, which is why it is only kept on request.
+	produced map[string]time.Time
+}
+
+// Uniform sample of a stream of items, of at most delaySampleSize of them (reservoir sampling), or every item if it is 0.
+// The sample is seeded the same in every run, so that the estimates of the same records are reproducible.
+type reservoir struct {
+	// Number of items offered to the sample
+	seen int
+	rand *rand.Rand
+}
+
+// Returns where to store the next item in a sample of the given size: the size to append it, an index to replace
+// an earlier item, or -1 to skip it
+func (r *reservoir) slot(size int) int {
+	r.seen++
+	if delaySampleSize == 0 || size < delaySampleSize {
+		return size
+	}
+	if r.rand == nil {
+		r.rand = rand.New(rand.NewSource(1))
+	}
+	if i := r.rand.Intn(r.seen); i < size {
+		return i
+	}
+	return -1
+}
+
+// Shuffles a sample before it is truncated, so that the items kept are a uniform sample of it
+func (r *reservoir) shuffle(size int, swap func(i, j int)) {
+	if r.rand == nil {
+		r.rand = rand.New(rand.NewSource(1))
+	}
+	r.rand.Shuffle(size, swap)
+}
+
+// Returns true if the percentiles or the jitter are estimated from a sample rather than from every record
+func (d *DelayStats) sampled() bool {
+	return d.delaySample.seen > len(d.delays) || d.arrivalSample.seen > len(d.arrivals)
+}
+
+// Returns how many items of two samples to keep in their merged sample, in proportion to the items each of them represents
+func mergedShares(seen int, size int, otherSeen int, otherSize int) (int, int) {
+	if delaySampleSize == 0 || size+otherSize <= delaySampleSize {
+		return size, otherSize
+	}
+	keep := int(math.Round(float64(delaySampleSize) * float64(seen) / float64(seen+otherSeen)))
+	if keep > size {
+		keep = size
+	}
+	otherKeep := delaySampleSize - keep
+	if otherKeep > otherSize {
+		otherKeep = otherSize
+	}
+	return keep, otherKeep
+}
+
+// Upper bounds of the buckets of the delay histogram, the last bucket holds every longer delay
+var delayBuckets = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// Number of records whose delay falls into a bucket of the delay histogram
+type DelayBucket struct {
+	// Range of the delays in the bucket, e.g. "1s-5s", or "30s+" for the last one
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// Producer timestamp of a record and the time it arrived in the destination
+type recordTiming struct {
+	recordId string
+	produced time.Time
+	arrived  time.Time
+}
+
+// Adds a single record, measuring its delay and the span of the producer timestamps.
+// A record which arrived before it was produced is counted as clock skew instead of a delay.
+func (d *DelayStats) addRecord(timing recordTiming) {
+	if d.earliest.IsZero() || timing.produced.Before(d.earliest) {
+		d.earliest = timing.produced
+	}
+	if d.latest.IsZero() || timing.produced.After(d.latest) {
+		d.latest = timing.produced
+	}
+	arrival := [2]int64{timing.produced.UnixNano(), timing.arrived.UnixNano()}
+	if i := d.arrivalSample.slot(len(d.arrivals)); i == len(d.arrivals) {
+		d.arrivals = append(d.arrivals, arrival)
+	} else if i >= 0 {
+		d.arrivals[i] = arrival
+	}
+	d.addArrival(timing.arrived)
+	if d.produced != nil {
+		if _, ok := d.produced[timing.recordId]; !ok {
+			d.produced[timing.recordId] = timing.produced
+		}
+	}
+	if delay := timing.arrived.Sub(timing.produced); delay < 0 {
+		d.addSkew(-delay)
+	} else {
+		d.add(delay)
+	}
+}
+
+// Adds the time a single record arrived before its producer timestamp
+func (d *DelayStats) addSkew(skew time.Duration) {
+	d.skewed++
+	d.skewSum += skew
+	if skew > d.skewMax {
+		d.skewMax = skew
+	}
+}
+
+// Returns the mean time the records with clock skew arrived before their producer timestamp, or zero if there are none
+func (d *DelayStats) averageSkew() time.Duration {
+	if d.skewed == 0 {
+		return 0
+	}
+	return d.skewSum / time.Duration(d.skewed)
+}
+
+// Adds the time a record arrived in the destination, for records whose delay can not be measured as well
+func (d *DelayStats) addArrival(arrived time.Time) {
+	if arrived.IsZero() {
+		return
+	}
+	if d.firstArrival.IsZero() || arrived.Before(d.firstArrival) {
+		d.firstArrival = arrived
+	}
+	if arrived.After(d.lastArrival) {
+		d.lastArrival = arrived
+	}
+}
+
+// Returns the time between the earliest and the latest producer timestamp, or zero if no record was added
+func (d *DelayStats) span() time.Duration {
+	return d.latest.Sub(d.earliest)
+}
+
+// Adds the delays, the producer timestamp span and the arrivals of other
+func (d *DelayStats) merge(other *DelayStats) {
+	d.addArrival(other.firstArrival)
+	d.addArrival(other.lastArrival)
+	d.skewed += other.skewed
+	d.skewSum += other.skewSum
+	if other.skewMax > d.skewMax {
+		d.skewMax = other.skewMax
+	}
+	if d.produced != nil {
+		for recordId, produced := range other.produced {
+			if _, ok := d.produced[recordId]; !ok {
+				d.produced[recordId] = produced
+			}
+		}
+	}
+	if !other.earliest.IsZero() && (d.earliest.IsZero() || other.earliest.Before(d.earliest)) {
+		d.earliest = other.earliest
+	}
+	if other.latest.After(d.latest) {
+		d.latest = other.latest
+	}
+
+	if other.count > 0 {
+		if d.count == 0 || other.min < d.min {
+			d.min = other.min
+		}
+		if other.max > d.max {
+			d.max = other.max
+		}
+		if d.buckets == nil {
+			d.buckets = make([]int, len(delayBuckets)+1)
+		}
+		for i, count := range other.buckets {
+			d.buckets[i] += count
+		}
+		keep, otherKeep := mergedShares(d.count, len(d.delays), other.count, len(other.delays))
+		if keep < len(d.delays) || otherKeep < len(other.delays) {
+			d.delaySample.shuffle(len(d.delays), func(i, j int) { d.delays[i], d.delays[j] = d.delays[j], d.delays[i] })
+			other.delaySample.shuffle(len(other.delays), func(i, j int) { other.delays[i], other.delays[j] = other.delays[j], other.delays[i] })
+			other.sorted = false
+		}
+		d.delays = append(d.delays[:keep], other.delays[:otherKeep]...)
+		d.count += other.count
+		d.sum += other.sum
+		d.delaySample.seen += other.delaySample.seen
+		d.sorted = false
+	}
+
+	keep, otherKeep := mergedShares(d.arrivalSample.seen, len(d.arrivals), other.arrivalSample.seen, len(other.arrivals))
+	if keep < len(d.arrivals) || otherKeep < len(other.arrivals) {
+		d.arrivalSample.shuffle(len(d.arrivals), func(i, j int) { d.arrivals[i], d.arrivals[j] = d.arrivals[j], d.arrivals[i] })
+		other.arrivalSample.shuffle(len(other.arrivals), func(i, j int) { other.arrivals[i], other.arrivals[j] = other.arrivals[j], other.arrivals[i] })
+	}
+	d.arrivals = append(d.arrivals[:keep], other.arrivals[:otherKeep]...)
+	d.arrivalSample.seen += other.arrivalSample.seen
+}
+
+// Adds the delay of a single record
+func (d *DelayStats) add(delay time.Duration) {
+	if d.count == 0 || delay < d.min {
+		d.min = delay
+	}
+	if d.count == 0 || delay > d.max {
+		d.max = delay
+	}
+	d.count++
+	d.sum += delay
+	if d.buckets == nil {
+		d.buckets = make([]int, len(delayBuckets)+1)
+	}
+	d.buckets[sort.Search(len(delayBuckets), func(i int) bool { return delay < delayBuckets[i] })]++
+	if i := d.delaySample.slot(len(d.delays)); i == len(d.delays) {
+		d.delays = append(d.delays, delay)
+	} else if i >= 0 {
+		d.delays[i] = delay
+	}
+	d.sorted = false
+}
+
+// Returns the mean delay, or zero if no delay was measured
+func (d *DelayStats) average() time.Duration {
+	if d.count == 0 {
+		return 0
+	}
+	return d.sum / time.Duration(d.count)
+}
+
+// Returns the delay which percent of the records did not exceed (nearest-rank), or zero if no delay was measured.
+// Estimated from the sample of the delays beyond delaySampleSize records if it is set.
+func (d *DelayStats) percentile(percent float64) time.Duration {
+	if d.count == 0 {
+		return 0
+	}
+
+	if !d.sorted {
+		sort.Slice(d.delays, func(i, j int) bool { return d.delays[i] < d.delays[j] })
+		d.sorted = true
+	}
+
+	rank := int(math.Ceil(percent / 100 * float64(len(d.delays))))
+	if rank < 1 {
+		rank = 1
+	}
+	return d.delays[rank-1]
+}
+
+// Returns the number of records in each bucket of delayBuckets, which tells a bimodal distribution apart at a glance.
+// Every bucket is returned, even empty ones, so that histograms of several runs line up.
+func (d *DelayStats) histogram() []DelayBucket {
+	buckets := make([]DelayBucket, len(delayBuckets)+1)
+	var lower time.Duration
+	for i, upper := range delayBuckets {
+		buckets[i].Bucket = lower.String() + "-" + upper.String()
+		lower = upper
+	}
+	buckets[len(delayBuckets)].Bucket = lower.String() + "+"
+
+	for i, count := range d.buckets {
+		buckets[i].Count = count
+	}
+	return buckets
+}
+
+// Returns the standard deviation of the time between the arrivals of consecutive records in producer order,
+// or zero with fewer than three records. Zero means the records arrived at a steady rate, a high value that they arrived in bursts.
+// Estimated beyond delaySampleSize records if it is set: the records between two sampled ones are not known, so the gap
+// between their arrivals is scaled down by the share of the producer time between them. Bursts shorter than the gaps
+// between the sampled records are smoothed out, a steady rate still reads as zero.
+func (d *DelayStats) jitter() time.Duration {
+	if len(d.arrivals) < 3 {
+		return 0
+	}
+
+	arrivals := d.arrivals
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i][0] < arrivals[j][0] })
+	sampled := d.arrivalSample.seen > len(arrivals)
+	// Mean producer time between two consecutive records of the whole run
+	producerGap := float64(d.span()) / float64(d.arrivalSample.seen-1)
+	gaps := make([]float64, 0, len(arrivals)-1)
+	mean := 0.0
+	for i := 1; i < len(arrivals); i++ {
+		gap := float64(arrivals[i][1] - arrivals[i-1][1])
+		if sampled {
+			// Records produced at the same time can not be scaled
+			produced := float64(arrivals[i][0] - arrivals[i-1][0])
+			if produced == 0 {
+				continue
+			}
+			gap *= producerGap / produced
+		}
+		gaps = append(gaps, gap)
+		mean += gap
+	}
+	if len(gaps) < 2 {
+		return 0
+	}
+	mean /= float64(len(gaps))
+
+	variance := 0.0
+	for _, gap := range gaps {
+		variance += (gap - mean) * (gap - mean)
+	}
+	variance /= float64(len(gaps))
+	return time.Duration(math.Sqrt(variance))
+}
+
+// Returns the record ID expression in the Logs Insights parse command syntax, with an "id" capture group
+func (p *RecordIdParser) insightsPattern() string {
+	pattern := fmt.Sprintf("^(?<%s>.{%d})", recordIdGroup, p.length)
+	if p.regex != nil {
+		// Insights does not support the (?P<name>...) form of named groups
+		pattern = strings.Replace(p.regex.String(), "(?P<", "(?<", -1)
+	}
+	return strings.Replace(pattern, "/", "\\/", -1)
+}
+
+// Number of records found out of producer order in each log stream (or shard) of a destination
+type OrderStats struct {
+	outOfOrder map[string]int
+}
+
+func newOrderStats() *OrderStats {
+	return &OrderStats{
+		outOfOrder: make(map[string]int),
+	}
+}
+
+// Records the number of out of order records found in a stream
+func (o *OrderStats) add(stream string, outOfOrder int) {
+	o.outOfOrder[stream] += outOfOrder
+}
+
+// Returns the number of out of order records across all streams
+func (o *OrderStats) total() int {
+	total := 0
+	for _, outOfOrder := range o.outOfOrder {
+		total += outOfOrder
+	}
+	return total
+}
+
+// Returns the number of out of order records in each stream with any, by stream name
+func (o *OrderStats) streams() []StreamOrder {
+	var streams []StreamOrder
+	for stream, outOfOrder := range o.outOfOrder {
+		if outOfOrder > 0 {
+			streams = append(streams, StreamOrder{Stream: stream, OutOfOrder: outOfOrder})
+		}
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].Stream < streams[j].Stream })
+	return streams
+}
+
+// Counts records whose numeric ID is lower than the ID of the record preceding it in a stream
+type orderChecker struct {
+	previous   int64
+	outOfOrder int
+}
+
+// Checks the next record ID of the stream, non numeric IDs are ignored
+func (c *orderChecker) check(recordId string) {
+	id, err := strconv.ParseInt(recordId, 10, 64)
+	if err != nil {
+		return
+	}
+	if id < c.previous {
+		c.outOfOrder++
+	}
+	c.previous = id
+}
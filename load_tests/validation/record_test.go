@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordIdParser(t *testing.T) {
+	// Test case 1: fixed length prefix
+	parser := newRecordIdParser(8)
+
+	recordId, ok := parser.parse("10029999_1639151827578_RandomString")
+	assert.True(t, ok)
+	assert.Equal(t, "10029999", recordId)
+
+	// Test case 2: log shorter than the record ID length
+	_, ok = parser.parse("1002")
+	assert.False(t, ok)
+	_, ok = parser.parse("")
+	assert.False(t, ok)
+	assert.Equal(t, 2, parser.unparseableCount())
+
+	// Test case 3: regex with an "id" capture group
+	parser, err := newRegexRecordIdParser(regexp.MustCompile(`^prefix-(?P<id>\d+)-\d+$`))
+	assert.NoError(t, err)
+
+	recordId, ok = parser.parse("prefix-100000000001-1639151827578")
+	assert.True(t, ok)
+	assert.Equal(t, "100000000001", recordId)
+
+	_, ok = parser.parse("10029999_1639151827578_RandomString")
+	assert.False(t, ok)
+	assert.Equal(t, 1, parser.unparseableCount())
+
+	// Test case 4: regex without an "id" capture group
+	_, err = newRegexRecordIdParser(regexp.MustCompile(`^(\d+)_`))
+	assert.Error(t, err)
+
+	// Test case 5: IDs outside of the expected range are foreign
+	parser = newRecordIdParser(8)
+	parser.minId = 10000000
+	parser.maxId = 10000010
+
+	recordId, ok = parser.parse("10000009_1639151827578_RandomString")
+	assert.True(t, ok)
+	assert.Equal(t, "10000009", recordId)
+
+	_, ok = parser.parse("10000010_1639151827578_RandomString")
+	assert.False(t, ok)
+	_, ok = parser.parse("09999999_1639151827578_RandomString")
+	assert.False(t, ok)
+	_, ok = parser.parse("abcdefgh_1639151827578_RandomString")
+	assert.False(t, ok)
+	assert.Equal(t, 3, parser.foreignCount())
+	assert.Equal(t, 0, parser.unparseableCount())
+
+	// A clone checks the same range with its own count
+	clone := parser.clone()
+	_, ok = clone.parse("10000010_1639151827578_RandomString")
+	assert.False(t, ok)
+	assert.Equal(t, 1, clone.foreignCount())
+
+	// Test case 6: IDs which are not expected are foreign, regardless of the range
+	parser.expectedIds = map[string]bool{"3f2a9c1e": true}
+	recordId, ok = parser.parse("3f2a9c1e_1639151827578_RandomString")
+	assert.True(t, ok)
+	assert.Equal(t, "3f2a9c1e", recordId)
+	_, ok = parser.parse("10000009_1639151827578_RandomString")
+	assert.False(t, ok)
+	assert.Equal(t, 4, parser.foreignCount())
+}
+
+func TestRecordIdParserPayloads(t *testing.T) {
+	parser := newRecordIdParser(8)
+	assert.Nil(t, parser.payloadCounts())
+
+	// Test case 1: logs equal to, cut short from or different from their payload
+	parser.payloads = map[string]string{
+		"10000000": "10000000_1639151827578_RandomString",
+		"10000001": "10000001_1639151827578_RandomString",
+		"10000002": "10000002_1639151827578_RandomString",
+	}
+	for _, log := range []string{"10000000_1639151827578_RandomString", "10000001_1639151827578_Random", "10000002_1639151827578_RandomStrinG"} {
+		_, ok := parser.parse(log)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, &PayloadCounts{Truncated: 1, Corrupted: 1}, parser.payloadCounts())
+
+	// Test case 2: a clone verifies the same payloads with its own counts
+	clone := parser.clone()
+	_, ok := clone.parse("10000000_1639151827578")
+	assert.True(t, ok)
+	assert.Equal(t, &PayloadCounts{Truncated: 1}, clone.payloadCounts())
+
+	// Test case 3: logs without a payload are not verified
+	_, ok = parser.parse("10000003_1639151827578_RandomString")
+	assert.True(t, ok)
+	assert.Equal(t, &PayloadCounts{Truncated: 1, Corrupted: 1}, parser.payloadCounts())
+}
+
+func TestRecordIdParserLength(t *testing.T) {
+	parser := newRecordIdParser(8)
+	parser.expectedLength = len("10000000_1639151827578_RandomString")
+
+	// Test case 1: logs of the expected length, shorter or longer
+	for _, log := range []string{"10000000_1639151827578_RandomString", "10000001_1639151827578_Random", "10000002_1639151827578_RandomStringRandomString"} {
+		_, ok := parser.parse(log)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, &PayloadCounts{Truncated: 1, Corrupted: 1}, parser.payloadCounts())
+
+	// Test case 2: a clone checks the same length with its own counts
+	clone := parser.clone()
+	_, ok := clone.parse("10000000_1639151827578")
+	assert.True(t, ok)
+	assert.Equal(t, &PayloadCounts{Truncated: 1}, clone.payloadCounts())
+
+	// Test case 3: a log truncated within its record ID is not counted, it is lost instead
+	_, ok = parser.parse("1000000")
+	assert.False(t, ok)
+	assert.Equal(t, &PayloadCounts{Truncated: 1, Corrupted: 1}, parser.payloadCounts())
+}
+
+func TestRecordTimestamp(t *testing.T) {
+	// Test case 1: timestamp following a fixed length record ID
+	parser := newRecordIdParser(8)
+
+	timestamp, ok := parser.timestamp("10029999_1639151827578_RandomString")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1639151827578), timestamp.UnixNano()/int64(time.Millisecond))
+
+	_, ok = parser.timestamp("10029999_163915")
+	assert.False(t, ok)
+
+	// Test case 2: timestamp captured by the regex
+	parser, err := newRegexRecordIdParser(regexp.MustCompile(`^prefix-(?P<id>\d+)-(?P<timestamp>\d+)$`))
+	assert.NoError(t, err)
+
+	timestamp, ok = parser.timestamp("prefix-100000000001-1639151827578")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1639151827578), timestamp.UnixNano()/int64(time.Millisecond))
+
+	// Test case 3: regex without a timestamp group
+	parser, err = newRegexRecordIdParser(regexp.MustCompile(`^prefix-(?P<id>\d+)-\d+$`))
+	assert.NoError(t, err)
+
+	_, ok = parser.timestamp("prefix-100000000001-1639151827578")
+	assert.False(t, ok)
+}
+
+func TestDelayStats(t *testing.T) {
+	delays := &DelayStats{}
+	assert.Equal(t, time.Duration(0), delays.average())
+
+	delays.add(2 * time.Second)
+	delays.add(1 * time.Second)
+	delays.add(6 * time.Second)
+
+	assert.Equal(t, 3, delays.count)
+	assert.Equal(t, 1*time.Second, delays.min)
+	assert.Equal(t, 3*time.Second, delays.average())
+	assert.Equal(t, 6*time.Second, delays.max)
+}
+
+func TestDelayStatsHistogram(t *testing.T) {
+	delays := &DelayStats{}
+	assert.Equal(t, []DelayBucket{{"0s-1s", 0}, {"1s-5s", 0}, {"5s-30s", 0}, {"30s+", 0}}, delays.histogram())
+
+	// Delays on a bucket bound fall into the next bucket, like a bimodal distribution of fast and retried records
+	for _, delay := range []time.Duration{200 * time.Millisecond, 900 * time.Millisecond, time.Second, 45 * time.Second, 2 * time.Minute} {
+		delays.add(delay)
+	}
+	assert.Equal(t, []DelayBucket{{"0s-1s", 2}, {"1s-5s", 1}, {"5s-30s", 0}, {"30s+", 2}}, delays.histogram())
+}
+
+func TestDelayStatsClockSkew(t *testing.T) {
+	produced := time.Unix(1639151827, 0)
+	delays := &DelayStats{}
+	delays.addRecord(recordTiming{produced: produced, arrived: produced.Add(2 * time.Second)})
+	// The producer clock is ahead, so these records arrived before they were produced
+	delays.addRecord(recordTiming{produced: produced.Add(time.Second), arrived: produced.Add(500 * time.Millisecond)})
+	delays.addRecord(recordTiming{produced: produced.Add(2 * time.Second), arrived: produced.Add(500 * time.Millisecond)})
+
+	// Only the record which arrived after it was produced counts as a delay
+	assert.Equal(t, 1, delays.count)
+	assert.Equal(t, 2*time.Second, delays.min)
+	assert.Equal(t, 2, delays.skewed)
+	assert.Equal(t, time.Second, delays.averageSkew())
+	assert.Equal(t, 1500*time.Millisecond, delays.skewMax)
+	assert.Equal(t, 2*time.Second, delays.span())
+
+	// Test case 2: merged with the delays of another destination, which only has skewed records
+	other := &DelayStats{}
+	other.addRecord(recordTiming{produced: produced.Add(3 * time.Second), arrived: produced})
+	delays.merge(other)
+	assert.Equal(t, 1, delays.count)
+	assert.Equal(t, 3, delays.skewed)
+	assert.Equal(t, 3*time.Second, delays.skewMax)
+	assert.Equal(t, 3*time.Second, delays.span())
+}
+
+func TestDelayStatsSpan(t *testing.T) {
+	delays := &DelayStats{}
+	assert.Equal(t, time.Duration(0), delays.span())
+
+	produced := time.Unix(1639151827, 0)
+	delays.addRecord(recordTiming{produced: produced.Add(30 * time.Second), arrived: produced.Add(32 * time.Second)})
+	delays.addRecord(recordTiming{produced: produced, arrived: produced.Add(1 * time.Second)})
+	delays.addRecord(recordTiming{produced: produced.Add(60 * time.Second), arrived: produced.Add(66 * time.Second)})
+
+	assert.Equal(t, 60*time.Second, delays.span())
+	assert.Equal(t, 3*time.Second, delays.average())
+}
+
+func TestDelayStatsArrivals(t *testing.T) {
+	produced := time.Unix(1639151827, 0)
+	delays := &DelayStats{}
+	delays.addRecord(recordTiming{produced: produced, arrived: produced.Add(5 * time.Second)})
+	// Records without a producer timestamp only extend the arrivals
+	delays.addArrival(produced.Add(2 * time.Second))
+	delays.addArrival(time.Time{})
+	assert.Equal(t, produced.Add(2*time.Second), delays.firstArrival)
+	assert.Equal(t, produced.Add(5*time.Second), delays.lastArrival)
+	assert.Equal(t, 1, delays.count)
+
+	other := &DelayStats{}
+	other.addArrival(produced.Add(9 * time.Second))
+	delays.merge(other)
+	assert.Equal(t, produced.Add(2*time.Second), delays.firstArrival)
+	assert.Equal(t, produced.Add(9*time.Second), delays.lastArrival)
+
+	results := get_results(resultInputs{
+		totalInputRecord: 1,
+		totalRecordFound: 1,
+		recordMap:        recordMapOf(map[string]int{"10000000": 1}),
+		logDelay:         "1ms",
+		delays:           delays,
+		sampleRate:       1,
+	}, "json")
+	assert.Equal(t, "2021-12-10T15:57:09.000Z", results.FirstArrival)
+	assert.Equal(t, "2021-12-10T15:57:16.000Z", results.LastArrival)
+}
+
+func TestDelayJitter(t *testing.T) {
+	produced := time.Unix(1639151827, 0)
+
+	// Test case 1: too few records
+	delays := &DelayStats{}
+	delays.addRecord(recordTiming{produced: produced, arrived: produced.Add(5 * time.Second)})
+	delays.addRecord(recordTiming{produced: produced.Add(time.Second), arrived: produced.Add(9 * time.Second)})
+	assert.Equal(t, time.Duration(0), delays.jitter())
+
+	// Test case 2: steady arrivals, added out of producer order on purpose
+	delays = &DelayStats{}
+	delays.addRecord(recordTiming{produced: produced.Add(2 * time.Second), arrived: produced.Add(7 * time.Second)})
+	delays.addRecord(recordTiming{produced: produced, arrived: produced.Add(5 * time.Second)})
+	delays.addRecord(recordTiming{produced: produced.Add(time.Second), arrived: produced.Add(6 * time.Second)})
+	assert.Equal(t, time.Duration(0), delays.jitter())
+
+	// Test case 3: bursty arrivals, gaps of 0s and 2s
+	delays = &DelayStats{}
+	delays.addRecord(recordTiming{produced: produced, arrived: produced.Add(5 * time.Second)})
+	delays.addRecord(recordTiming{produced: produced.Add(time.Second), arrived: produced.Add(5 * time.Second)})
+	delays.addRecord(recordTiming{produced: produced.Add(2 * time.Second), arrived: produced.Add(7 * time.Second)})
+	assert.Equal(t, time.Second, delays.jitter())
+}
+
+func TestDelayPercentiles(t *testing.T) {
+	delays := &DelayStats{}
+	assert.Equal(t, time.Duration(0), delays.percentile(99))
+
+	// Added out of order on purpose, 1s to 100s
+	for i := 100; i > 0; i-- {
+		delays.add(time.Duration(i) * time.Second)
+	}
+
+	assert.Equal(t, 50*time.Second, delays.percentile(50))
+	assert.Equal(t, 90*time.Second, delays.percentile(90))
+	assert.Equal(t, 99*time.Second, delays.percentile(99))
+	assert.Equal(t, 100*time.Second, delays.percentile(100))
+}
+
+func TestDelayStatsSample(t *testing.T) {
+	delaySampleSize = 100
+	defer func() { delaySampleSize = 0 }()
+	produced := time.Unix(1639151827, 0)
+
+	// Test case 1: only the sample is kept beyond its size, the count, extremes and histogram stay exact
+	delays := &DelayStats{}
+	for i := 0; i < 10000; i++ {
+		// 1ms to 10s, added out of order on purpose
+		delay := time.Duration(i*7919%10000+1) * time.Millisecond
+		delays.addRecord(recordTiming{produced: produced.Add(time.Duration(i) * time.Second), arrived: produced.Add(time.Duration(i)*time.Second + delay)})
+	}
+	assert.Len(t, delays.delays, 100)
+	assert.Len(t, delays.arrivals, 100)
+	assert.True(t, delays.sampled())
+	assert.Equal(t, 10000, delays.count)
+	assert.Equal(t, time.Millisecond, delays.min)
+	assert.Equal(t, 10*time.Second, delays.max)
+	assert.Equal(t, []DelayBucket{{"0s-1s", 999}, {"1s-5s", 4000}, {"5s-30s", 5001}, {"30s+", 0}}, delays.histogram())
+	assert.InDelta(t, float64(5*time.Second), float64(delays.percentile(50)), float64(time.Second))
+
+	// Test case 2: merged samples stay within the size, in proportion to the records of each
+	other := &DelayStats{}
+	for i := 0; i < 30000; i++ {
+		other.addRecord(recordTiming{produced: produced, arrived: produced.Add(time.Minute)})
+	}
+	delays.merge(other)
+	assert.Len(t, delays.delays, 100)
+	assert.Equal(t, 40000, delays.count)
+	assert.Equal(t, time.Minute, delays.max)
+	assert.Equal(t, 30000, delays.histogram()[3].Count)
+	assert.Equal(t, time.Minute, delays.percentile(50))
+	assert.Less(t, int64(delays.percentile(20)), int64(time.Minute))
+
+	// Test case 3: steady arrivals of sampled records stay steady
+	delays = &DelayStats{}
+	for i := 0; i < 1000; i++ {
+		delays.addRecord(recordTiming{produced: produced.Add(time.Duration(i) * time.Second), arrived: produced.Add(time.Duration(i+5) * time.Second)})
+	}
+	assert.Len(t, delays.arrivals, 100)
+	assert.Equal(t, time.Duration(0), delays.jitter())
+
+	// Test case 4: batches of 200 records arriving at once are still told apart from a steady rate
+	delays = &DelayStats{}
+	for i := 0; i < 1000; i++ {
+		delays.addRecord(recordTiming{produced: produced.Add(time.Duration(i) * time.Second), arrived: produced.Add(time.Duration(i/200*200+5) * time.Second)})
+	}
+	assert.Greater(t, int64(delays.jitter()), int64(time.Second))
+}
+
+func TestDelayStatsExact(t *testing.T) {
+	produced := time.Unix(1639151827, 0)
+
+	// Test case 1: every delay and arrival is kept without a sample size, even beyond 100000 records produced within 10s
+	delays := &DelayStats{}
+	for i := 0; i < 150000; i++ {
+		// Delays growing from 1s by 1µs per record and falling back every 1000 records
+		producedAt := produced.Add(time.Duration(i) * 50 * time.Microsecond)
+		delays.addRecord(recordTiming{produced: producedAt, arrived: producedAt.Add(time.Second + time.Duration(i%1000)*time.Microsecond)})
+	}
+	assert.Len(t, delays.delays, 150000)
+	assert.Len(t, delays.arrivals, 150000)
+	assert.False(t, delays.sampled())
+	assert.Equal(t, time.Second+999*time.Microsecond, delays.percentile(100))
+	assert.Equal(t, time.Second+989*time.Microsecond, delays.percentile(99))
+	assert.Greater(t, int64(delays.jitter()), int64(0))
+}
+
+func TestInsightsPattern(t *testing.T) {
+	assert.Equal(t, "^(?<id>.{8})", newRecordIdParser(8).insightsPattern())
+
+	parser, err := newRegexRecordIdParser(regexp.MustCompile(`^app/(?P<id>\d+)-`))
+	assert.NoError(t, err)
+	assert.Equal(t, `^app\/(?<id>\d+)-`, parser.insightsPattern())
+}
+
+func TestOrderChecker(t *testing.T) {
+	var order orderChecker
+	for _, recordId := range []string{"10000000", "10000001", "10000003", "10000002", "10000004", "not-a-number", "10000000"} {
+		order.check(recordId)
+	}
+	assert.Equal(t, 2, order.outOfOrder)
+
+	ordering := newOrderStats()
+	ordering.add("stream-a", order.outOfOrder)
+	ordering.add("stream-b", 1)
+	ordering.add("stream-c", 0)
+	assert.Equal(t, 3, ordering.total())
+	assert.Equal(t, []StreamOrder{{Stream: "stream-a", OutOfOrder: 2}, {Stream: "stream-b", OutOfOrder: 1}}, ordering.streams())
+}
+
+func TestGetLogs(t *testing.T) {
+	data := []byte("{\"log\":\"10000000_1639151827578_RandomString\"}\nnot json\n\n{\"log\":\"10000001_1639151827578_RandomString\"}\n")
+
+	// Test case 1: malform lines are skipped and counted
+	parser := newRecordIdParser(8)
+	logs, err := parser.getLogs(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000_1639151827578_RandomString", "10000001_1639151827578_RandomString"}, logs)
+	assert.Equal(t, 1, parser.malformedCount())
+
+	// Test case 2: malform lines fail a strict parser
+	parser = newRecordIdParser(8)
+	parser.strict = true
+	_, err = parser.getLogs(data)
+	assert.Error(t, err)
+	assert.Equal(t, 0, parser.malformedCount())
+
+	// Test case 3: raw lines are the logs themselves
+	parser = newRecordIdParser(8)
+	parser.raw = true
+	logs, err = parser.getLogs([]byte("10000000_1639151827578_RandomString\n\n10000001_1639151827578_RandomString"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000_1639151827578_RandomString", "10000001_1639151827578_RandomString"}, logs)
+
+	// Test case 4: the log is read from the configured field, entries without it are unparseable
+	parser = newRecordIdParser(8)
+	parser.field = "message"
+	logs, err = parser.getLogs([]byte("{\"message\":\"10000000_1639151827578_RandomString\"}\n{\"log\":\"10000001_1639151827578_RandomString\"}\n{\"message\":1}"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000_1639151827578_RandomString"}, logs)
+	assert.Equal(t, 2, parser.unparseableCount())
+	assert.Equal(t, 0, parser.malformedCount())
+
+	// Test case 5: the log is read from a nested field, entries with a missing or non object field on the path are unparseable
+	parser = newRecordIdParser(8)
+	parser.path = []string{"data", "log"}
+	logs, err = parser.getLogs([]byte("{\"data\":{\"log\":\"10000000_1639151827578_RandomString\"}}\n{\"log\":\"10000001_1639151827578_RandomString\"}\n{\"data\":\"10000002\"}\n{\"data\":{\"message\":\"10000003\"}}"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000_1639151827578_RandomString"}, logs)
+	assert.Equal(t, 3, parser.unparseableCount())
+	assert.Equal(t, "data.log", parser.logField())
+
+	// Test case 6: lines longer than the default scanner buffer
+	parser = newRecordIdParser(8)
+	long := "10000000_1639151827578_" + strings.Repeat("x", 1024*1024)
+	logs, err = parser.getLogs([]byte("{\"log\":\"" + long + "\"}\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{long}, logs)
+
+	// Test case 7: records separated by a custom delimiter
+	parser = newRecordIdParser(8)
+	parser.delimiter = "\x1e"
+	logs, err = parser.getLogs([]byte("{\"log\":\"10000000_1639151827578_RandomString\"}\x1e{\"log\":\"10000001_1639151827578_RandomString\"}\x1e"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000_1639151827578_RandomString", "10000001_1639151827578_RandomString"}, logs)
+
+	// Test case 8: concatenated JSON log entries
+	parser = newRecordIdParser(8)
+	parser.concatenated = true
+	logs, err = parser.getLogs([]byte("{\"log\":\"10000000_1639151827578_RandomString\"}{\"log\":\"10000001_1639151827578_RandomString\"}\n[1]{\"message\":\"x\"}"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000_1639151827578_RandomString", "10000001_1639151827578_RandomString"}, logs)
+	assert.Equal(t, 1, parser.malformedCount())
+	assert.Equal(t, 1, parser.unparseableCount())
+
+	// Test case 9: the rest of concatenated entries after a syntax error is a single malform entry
+	parser = newRecordIdParser(8)
+	parser.concatenated = true
+	logs, err = parser.getLogs([]byte("{\"log\":\"10000000_1639151827578_RandomString\"}{\"log\":}{\"log\":\"10000001_1639151827578_RandomString\"}"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000_1639151827578_RandomString"}, logs)
+	assert.Equal(t, 1, parser.malformedCount())
+
+	// Test case 10: a syntax error fails a strict parser
+	parser = newRecordIdParser(8)
+	parser.concatenated = true
+	parser.strict = true
+	_, err = parser.getLogs([]byte("{\"log\":\"10000000_1639151827578_RandomString\"}{\"log\""))
+	assert.Error(t, err)
+
+	// Test case 11: base64 encoded records, undecodable lines are malform entries
+	parser = newRecordIdParser(8)
+	parser.base64 = true
+	logs, err = parser.getLogs([]byte(base64.StdEncoding.EncodeToString([]byte("{\"log\":\"10000000_1639151827578_RandomString\"}\n")) + "\nnot base64\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000_1639151827578_RandomString"}, logs)
+	assert.Equal(t, 1, parser.malformedCount())
+
+	// Test case 12: records of the Firehose error output, lines without an encoded record are malform entries
+	parser = newRecordIdParser(8)
+	parser.firehoseErrors = true
+	rawData := base64.StdEncoding.EncodeToString([]byte("{\"log\":\"10000000_1639151827578_RandomString\"}\n"))
+	logs, err = parser.getLogs([]byte("{\"errorCode\":\"400\",\"rawData\":\"" + rawData + "\"}\n{\"errorCode\":\"400\"}\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000_1639151827578_RandomString"}, logs)
+	assert.Equal(t, 1, parser.malformedCount())
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Occurrences of a record ID left out of a sample in the slice of a RecordMap
+const notTracked = -1
+
+// Occurrences of the input records in a destination, by record ID.
+// The sequential IDs of the producer are counted in a slice indexed from the first ID, a fraction of the memory
+// a map with a string key per record takes for large runs. Other IDs, e.g. read from a file, are counted in a map.
+// A RecordMap is not safe for concurrent use, the validators guard it like the map it replaces.
+type RecordMap struct {
+	// Occurrences of the sequential IDs from base on, notTracked for IDs which are not input records
+	counts []int32
+	base   int
+	// Occurrences of every input record when the IDs are not sequential
+	ids map[string]int
+	// Number of input records
+	size int
+}
+
+// Creates a RecordMap of total sequential IDs starting at base, none of them found yet.
+// Only the IDs tracked returns true for are input records, every ID is if tracked is nil.
+// Checking every ID, e.g. hashing it for a sample, is split between workers goroutines since it is slow for large runs,
+// tracked must be safe for concurrent use.
+func newSequentialRecordMap(base int, total int, tracked func(recordId string) bool, workers int) *RecordMap {
+	m := &RecordMap{counts: make([]int32, total), base: base, size: total}
+	if tracked == nil {
+		return m
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Each worker checks its own range of the IDs, so the slice is written without a lock
+	var wg sync.WaitGroup
+	chunk := (total + workers - 1) / workers
+	untracked := make([]int, workers)
+	for w := 0; w*chunk < total; w++ {
+		start, end := w*chunk, (w+1)*chunk
+		if end > total {
+			end = total
+		}
+		wg.Add(1)
+		go func(w int, start int, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				if !tracked(strconv.Itoa(base + i)) {
+					m.counts[i] = notTracked
+					untracked[w]++
+				}
+			}
+		}(w, start, end)
+	}
+	wg.Wait()
+
+	for _, count := range untracked {
+		m.size -= count
+	}
+	return m
+}
+
+// Creates a RecordMap of the given IDs, none of them found yet
+func newKeyedRecordMap(recordIds []string) *RecordMap {
+	m := &RecordMap{ids: make(map[string]int, len(recordIds))}
+	for _, recordId := range recordIds {
+		m.ids[recordId] = 0
+	}
+	m.size = len(m.ids)
+	return m
+}
+
+// Returns the index of a sequential ID in the slice, or false if it is not one of them.
+// IDs with a sign or leading zeros are not the string of any sequential ID, even if they parse to one.
+func (m *RecordMap) index(recordId string) (int, bool) {
+	if recordId == "" || recordId[0] < '1' || recordId[0] > '9' {
+		return 0, false
+	}
+	id, err := strconv.Atoi(recordId)
+	if err != nil || id < m.base || id-m.base >= len(m.counts) {
+		return 0, false
+	}
+	return id - m.base, true
+}
+
+// Returns the occurrences of a record, or false if it is not an input record
+func (m *RecordMap) get(recordId string) (int, bool) {
+	if m.ids != nil {
+		occurrences, ok := m.ids[recordId]
+		return occurrences, ok
+	}
+	i, ok := m.index(recordId)
+	if !ok || m.counts[i] == notTracked {
+		return 0, false
+	}
+	return int(m.counts[i]), true
+}
+
+// Sets the occurrences of a record, making it an input record if it is not one yet.
+// IDs outside of the range of the sequential IDs can not be added and are ignored.
+func (m *RecordMap) set(recordId string, occurrences int) {
+	if m.ids != nil {
+		if _, ok := m.ids[recordId]; !ok {
+			m.size++
+		}
+		m.ids[recordId] = occurrences
+		return
+	}
+	i, ok := m.index(recordId)
+	if !ok {
+		return
+	}
+	if m.counts[i] == notTracked {
+		m.size++
+	}
+	m.counts[i] = int32(occurrences)
+}
+
+// Returns the number of input records
+func (m *RecordMap) len() int {
+	return m.size
+}
+
+// Calls fn with every input record and its occurrences, in no particular order
+func (m *RecordMap) each(fn func(recordId string, occurrences int)) {
+	if m.ids != nil {
+		for recordId, occurrences := range m.ids {
+			fn(recordId, occurrences)
+		}
+		return
+	}
+	for i, occurrences := range m.counts {
+		if occurrences != notTracked {
+			fn(strconv.Itoa(m.base+i), int(occurrences))
+		}
+	}
+}
+
+// Returns the same input records, none of them found yet
+func (m *RecordMap) reset() *RecordMap {
+	if m.ids != nil {
+		records := &RecordMap{ids: make(map[string]int, len(m.ids)), size: m.size}
+		for recordId := range m.ids {
+			records.ids[recordId] = 0
+		}
+		return records
+	}
+	records := &RecordMap{counts: make([]int32, len(m.counts)), base: m.base, size: m.size}
+	for i, occurrences := range m.counts {
+		if occurrences == notTracked {
+			records.counts[i] = notTracked
+		}
+	}
+	return records
+}
+
+// Returns the input records which were not found yet, none of them found.
+// Searching them alone lets a polling pass skip the records an earlier pass found.
+func (m *RecordMap) missing() *RecordMap {
+	if m.ids != nil {
+		records := &RecordMap{ids: make(map[string]int)}
+		for recordId, occurrences := range m.ids {
+			if occurrences == 0 {
+				records.ids[recordId] = 0
+			}
+		}
+		records.size = len(records.ids)
+		return records
+	}
+	records := &RecordMap{counts: make([]int32, len(m.counts)), base: m.base}
+	for i, occurrences := range m.counts {
+		if occurrences == 0 {
+			records.size++
+		} else {
+			records.counts[i] = notTracked
+		}
+	}
+	return records
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a RecordMap of the records with the given occurrences
+func recordMapOf(records map[string]int) *RecordMap {
+	m := newKeyedRecordMap(nil)
+	for recordId, occurrences := range records {
+		m.set(recordId, occurrences)
+	}
+	return m
+}
+
+// Returns the input records with their occurrences as a map, for comparisons
+func (m *RecordMap) toMap() map[string]int {
+	records := make(map[string]int, m.len())
+	m.each(func(recordId string, occurrences int) {
+		records[recordId] = occurrences
+	})
+	return records
+}
+
+func TestSequentialRecordMap(t *testing.T) {
+	// Test case 1: every ID of the range is an input record
+	m := newSequentialRecordMap(idCounterBase, 3, nil, 1)
+	assert.Equal(t, 3, m.len())
+	m.set("10000001", 2)
+	occurrences, ok := m.get("10000001")
+	assert.True(t, ok)
+	assert.Equal(t, 2, occurrences)
+	assert.Equal(t, map[string]int{"10000000": 0, "10000001": 2, "10000002": 0}, m.toMap())
+
+	// Test case 2: IDs outside of the range, or not written like a sequential ID, are not input records
+	for _, recordId := range []string{"", "9999999", "10000003", "010000000", "+10000000", "1000000a"} {
+		_, ok := m.get(recordId)
+		assert.False(t, ok, recordId)
+		m.set(recordId, 1)
+	}
+	assert.Equal(t, 3, m.len())
+
+	// Test case 3: only the tracked IDs are input records, the others can be added later
+	m = newSequentialRecordMap(idCounterBase, 4, func(recordId string) bool {
+		id, _ := strconv.Atoi(recordId)
+		return id%2 == 0
+	}, 1)
+	assert.Equal(t, map[string]int{"10000000": 0, "10000002": 0}, m.toMap())
+	_, ok = m.get("10000001")
+	assert.False(t, ok)
+	m.set("10000001", 1)
+	assert.Equal(t, 3, m.len())
+
+	// Test case 4: a reset map has the same input records, none of them found
+	m = m.reset()
+	assert.Equal(t, map[string]int{"10000000": 0, "10000001": 0, "10000002": 0}, m.toMap())
+
+	// Test case 5: only the records not found yet are missing
+	m.set("10000001", 2)
+	missing := m.missing()
+	assert.Equal(t, 2, missing.len())
+	assert.Equal(t, map[string]int{"10000000": 0, "10000002": 0}, missing.toMap())
+
+	// Test case 6: the IDs checked by several workers are the same as by one, including more workers than IDs
+	sampled := func(recordId string) bool { return isSampled(recordId, 0.3) }
+	expected := newSequentialRecordMap(idCounterBase, 1001, sampled, 1)
+	for _, workers := range []int{3, 10, 2000} {
+		m = newSequentialRecordMap(idCounterBase, 1001, sampled, workers)
+		assert.Equal(t, expected.len(), m.len(), workers)
+		assert.Equal(t, expected.toMap(), m.toMap(), workers)
+	}
+}
+
+func TestKeyedRecordMap(t *testing.T) {
+	m := newKeyedRecordMap([]string{"a", "b", "a"})
+	assert.Equal(t, 2, m.len())
+	_, ok := m.get("c")
+	assert.False(t, ok)
+
+	m.set("a", 3)
+	m.set("c", 1)
+	assert.Equal(t, 3, m.len())
+	assert.Equal(t, map[string]int{"a": 3, "b": 0, "c": 1}, m.toMap())
+	assert.Equal(t, map[string]int{"a": 0, "b": 0, "c": 0}, m.reset().toMap())
+	assert.Equal(t, map[string]int{"b": 0}, m.missing().toMap())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A line of the result map written as newline delimited JSON
+type resultMapEntry struct {
+	RecordId    string `json:"id"`
+	Occurrences int    `json:"occurrences"`
+}
+
+// Writes the occurrences of every input record in the destination to a file, 0 for the records which were not found,
+// e.g. for an analysis of the results with other tools. Files named *.jsonl or *.ndjson get a JSON object per record,
+// other files a single JSON object from record ID to occurrences. Either way the records are streamed from the map,
+// so that large runs do not need another copy of them in memory.
+func writeResultMap(path string, recordMap *RecordMap) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	lines := false
+	switch filepath.Ext(path) {
+	case ".jsonl", ".ndjson":
+		lines = true
+	default:
+		_, err = writer.WriteString("{")
+	}
+
+	first := true
+	recordMap.each(func(recordId string, occurrences int) {
+		if err != nil {
+			return
+		}
+		if lines {
+			var line []byte
+			line, err = json.Marshal(resultMapEntry{RecordId: recordId, Occurrences: occurrences})
+			if err == nil {
+				_, err = fmt.Fprintf(writer, "%s\n", line)
+			}
+			return
+		}
+
+		var key []byte
+		key, err = json.Marshal(recordId)
+		if err != nil {
+			return
+		}
+		separator := ","
+		if first {
+			separator = ""
+			first = false
+		}
+		_, err = fmt.Fprintf(writer, "%s\n%s:%d", separator, key, occurrences)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !lines {
+		if _, err := writer.WriteString("\n}\n"); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteResultMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resultmap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordMap := newInputMap(3)
+	recordMap.set("10000000", 1)
+	recordMap.set("10000002", 2)
+
+	// Test case 1: a single JSON object from record ID to occurrences
+	path := filepath.Join(dir, "results.json")
+	assert.NoError(t, writeResultMap(path, recordMap))
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n\"10000000\":1,\n\"10000001\":0,\n\"10000002\":2\n}\n", string(data))
+	var occurrences map[string]int
+	assert.NoError(t, json.Unmarshal(data, &occurrences))
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 0, "10000002": 2}, occurrences)
+
+	// Test case 2: a JSON object per record
+	path = filepath.Join(dir, "results.jsonl")
+	assert.NoError(t, writeResultMap(path, recordMap))
+	data, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"id\":\"10000000\",\"occurrences\":1}\n{\"id\":\"10000001\",\"occurrences\":0}\n{\"id\":\"10000002\",\"occurrences\":2}\n", string(data))
+
+	// Test case 3: an empty map is an empty JSON object
+	path = filepath.Join(dir, "empty.json")
+	assert.NoError(t, writeResultMap(path, newKeyedRecordMap(nil)))
+	data, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n}\n", string(data))
+
+	// Test case 4: a file in a missing directory fails
+	assert.Error(t, writeResultMap(filepath.Join(dir, "missing", "results.json"), recordMap))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	retryBaseDelay  = 200 * time.Millisecond
+	retryMaxDelay   = 30 * time.Second
+	retryMaxRetries = 10
+)
+
+// Error codes returned by AWS services when a request is throttled
+var throttlingErrorCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ProvisionedThroughputExceededException": true,
+	"RequestLimitExceeded":                   true,
+	"TooManyRequestsException":               true,
+	"SlowDown":                               true,
+}
+
+// Retries of every API call of the run so far, a high count means the validators are close to the API limits
+var retryTotals RetryStats
+
+// Number of retries and the time slept in backoff before them, updated concurrently
+type RetryStats struct {
+	retries int64
+	backoff int64
+}
+
+// Adds a backoff, which is only a retry if the sleep was not cut short by ctx being done
+func (s *RetryStats) add(backoff time.Duration, retried bool) {
+	if retried {
+		atomic.AddInt64(&s.retries, 1)
+	}
+	atomic.AddInt64(&s.backoff, int64(backoff))
+}
+
+// Returns the retries so far
+func (s *RetryStats) snapshot() RetryStats {
+	return RetryStats{retries: atomic.LoadInt64(&s.retries), backoff: atomic.LoadInt64(&s.backoff)}
+}
+
+// Returns the retries since an earlier snapshot
+func (s RetryStats) since(start RetryStats) RetryStats {
+	return RetryStats{retries: s.retries - start.retries, backoff: s.backoff - start.backoff}
+}
+
+// Returns true for throttling and server side errors which are worth retrying
+func isRetryableError(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() >= 500 {
+		return true
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		return throttlingErrorCodes[awsErr.Code()]
+	}
+	return false
+}
+
+// Calls fn until it succeeds, fails with a non retryable error, runs out of retries or ctx is done.
+// The delay between attempts grows exponentially from retryBaseDelay up to retryMaxDelay with jitter,
+// so that concurrent validators do not retry in lockstep.
+func retryWithBackoff(ctx context.Context, fn func() error) error {
+	return retryWithMaxRetries(ctx, retryMaxRetries, fn)
+}
+
+// Same as retryWithBackoff, but gives up after maxRetries retries
+func retryWithMaxRetries(ctx context.Context, maxRetries int, fn func() error) error {
+	delay := retryBaseDelay
+	for retry := 0; ; retry++ {
+		err := fn()
+		if err == nil || retry >= maxRetries || !isRetryableError(err) {
+			return err
+		}
+
+		sleepStart := time.Now()
+		retried := sleepWithContext(ctx, delay/2+time.Duration(rand.Int63n(int64(delay/2))))
+		retryTotals.add(time.Since(sleepStart), retried)
+		if !retried {
+			return err
+		}
+
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
+
+// Sleeps for the given duration, returns false if ctx is done first
+func sleepWithContext(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, isRetryableError(awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, "")))
+	assert.True(t, isRetryableError(awserr.NewRequestFailure(awserr.New("SlowDown", "", nil), 503, "")))
+	assert.True(t, isRetryableError(awserr.New("ThrottlingException", "", nil)))
+	assert.False(t, isRetryableError(awserr.NewRequestFailure(awserr.New("NoSuchKey", "", nil), 404, "")))
+	assert.False(t, isRetryableError(errors.New("unexpected EOF")))
+}
+
+func TestRetryWithMaxRetries(t *testing.T) {
+	throttled := awserr.New("SlowDown", "", nil)
+
+	attempts := 0
+	err := retryWithMaxRetries(context.Background(), 2, func() error {
+		attempts++
+		return throttled
+	})
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 3, attempts, "first attempt and two retries")
+
+	attempts = 0
+	err = retryWithMaxRetries(context.Background(), 2, func() error {
+		attempts++
+		if attempts == 1 {
+			return throttled
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	attempts = 0
+	notFound := awserr.New("NoSuchKey", "", nil)
+	err = retryWithMaxRetries(context.Background(), 2, func() error {
+		attempts++
+		return notFound
+	})
+	assert.Equal(t, notFound, err)
+	assert.Equal(t, 1, attempts, "non retryable errors are returned immediately")
+}
+
+func TestRetryTotals(t *testing.T) {
+	throttled := awserr.New("SlowDown", "", nil)
+
+	// Test case 1: a retry and the backoff before it
+	start := retryTotals.snapshot()
+	retryWithMaxRetries(context.Background(), 1, func() error { return throttled })
+	retries := retryTotals.snapshot().since(start)
+	assert.Equal(t, int64(1), retries.retries)
+	assert.True(t, time.Duration(retries.backoff) >= retryBaseDelay/2, "slept %s", time.Duration(retries.backoff))
+
+	// Test case 2: a backoff cut short is not a retry
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = retryTotals.snapshot()
+	retryWithMaxRetries(ctx, 1, func() error { return throttled })
+	assert.Equal(t, int64(0), retryTotals.snapshot().since(start).retries)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Orders the listed S3 objects are validated in
+const (
+	// As listed, streamed to the workers page by page
+	s3OrderListing = "listing"
+	// By the time the objects were last modified
+	s3OrderModified = "last-modified"
+	// By the time embedded in the keys, e.g. by Firehose, or the last modified time of the keys without one
+	s3OrderKeyTime = "key-time"
+)
+
+// Time embedded in the object names of Firehose, e.g. "stream-1-2022-01-31-23-59-59-uuid"
+var s3KeyTimeRegex = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2})`)
+
+// Layout of the time matched by s3KeyTimeRegex, which is in UTC
+const s3KeyTimeLayout = "2006-01-02-15-04-05"
+
+// Returns the time embedded in the key of an object, or false if it has none
+func s3KeyTime(key string) (time.Time, bool) {
+	match := s3KeyTimeRegex.FindString(key)
+	if match == "" {
+		return time.Time{}, false
+	}
+	timestamp, err := time.Parse(s3KeyTimeLayout, match)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return timestamp, true
+}
+
+// Sorts the objects by their time in the given order, oldest first. Objects with the same time keep their listing order.
+func sortS3Objects(objects []s3ObjectVersion, order string) {
+	times := make([]time.Time, len(objects))
+	for i, object := range objects {
+		times[i] = aws.TimeValue(object.LastModified)
+		if order == s3OrderKeyTime {
+			if timestamp, ok := s3KeyTime(aws.StringValue(object.Key)); ok {
+				times[i] = timestamp
+			}
+		}
+	}
+
+	indexes := make([]int, len(objects))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool { return times[indexes[i]].Before(times[indexes[j]]) })
+
+	sorted := make([]s3ObjectVersion, len(objects))
+	for i, index := range indexes {
+		sorted[i] = objects[index]
+	}
+	copy(objects, sorted)
+}
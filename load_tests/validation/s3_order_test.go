@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the keys of the objects in the order they are downloaded
+type mockS3Downloads struct {
+	*mockS3
+	keys []string
+}
+
+func (m *mockS3Downloads) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	m.keys = append(m.keys, aws.StringValue(input.Key))
+	return m.mockS3.GetObjectWithContext(ctx, input, opts...)
+}
+
+func TestS3KeyTime(t *testing.T) {
+	// Test case 1: object name of Firehose
+	timestamp, ok := s3KeyTime("logs/2022/01/31/23/stream-1-2022-01-31-23-59-58-0b1e6a3c")
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2022, 1, 31, 23, 59, 58, 0, time.UTC), timestamp)
+
+	// Test case 2: key without a time
+	_, ok = s3KeyTime("logs/object.gz")
+	assert.False(t, ok)
+}
+
+func TestSortS3Objects(t *testing.T) {
+	start := time.Unix(1639151827, 0)
+	object := func(key string, lastModified time.Time) s3ObjectVersion {
+		return s3ObjectVersion{Object: &s3.Object{Key: aws.String(key), LastModified: aws.Time(lastModified)}}
+	}
+	keys := func(objects []s3ObjectVersion) []string {
+		var keys []string
+		for _, object := range objects {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return keys
+	}
+	listed := func() []s3ObjectVersion {
+		return []s3ObjectVersion{
+			object("s-2021-12-10-15-57-09-a", start),
+			object("s-2021-12-10-15-57-07-b", start.Add(2*time.Second)),
+			object("c", start.Add(time.Second)),
+		}
+	}
+
+	// Test case 1: by last modified time
+	objects := listed()
+	sortS3Objects(objects, s3OrderModified)
+	assert.Equal(t, []string{"s-2021-12-10-15-57-09-a", "c", "s-2021-12-10-15-57-07-b"}, keys(objects))
+
+	// Test case 2: by the time in the keys, or the last modified time of the keys without one
+	objects = listed()
+	sortS3Objects(objects, s3OrderKeyTime)
+	assert.Equal(t, []string{"s-2021-12-10-15-57-07-b", "c", "s-2021-12-10-15-57-09-a"}, keys(objects))
+}
+
+func TestValidateS3Sorted(t *testing.T) {
+	client := &mockS3Downloads{mockS3: &mockS3{
+		pages: [][]string{{"s-2021-12-10-15-57-09-a"}, {"s-2021-12-10-15-57-07-b"}},
+		objects: map[string][]string{
+			"s-2021-12-10-15-57-09-a": producerLogs("10000001"),
+			"s-2021-12-10-15-57-07-b": producerLogs("10000000"),
+		},
+	}}
+
+	// Test case 1: the objects of every page are downloaded in the order of the times in their keys
+	found, _, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(2), &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		objectOrder:  s3OrderKeyTime,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found)
+	assert.Equal(t, []string{"s-2021-12-10-15-57-07-b", "s-2021-12-10-15-57-09-a"}, client.keys)
+
+	// Test case 2: in listing order by default
+	client.keys = nil
+	_, _, err = validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(2), &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"s-2021-12-10-15-57-09-a", "s-2021-12-10-15-57-07-b"}, client.keys)
+}
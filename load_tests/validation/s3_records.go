@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Upper bounds of the buckets of the records per object histogram, the last bucket holds every larger object
+var objectRecordBuckets = []int{1, 10, 100, 1000, 10000}
+
+// Number of objects whose number of records falls into a bucket of the records per object histogram
+type ObjectRecordBucket struct {
+	// Range of the records in the bucket, e.g. "10-100", or "10000+" for the last one
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// Distribution of the number of records found per object, which tells tiny flushes apart from well batched objects
+type objectRecordStats struct {
+	objects int
+	records int
+	min     int
+	max     int
+	// Number of objects in each bucket of objectRecordBuckets
+	counts []int
+}
+
+// Records the number of records found in an object
+func (s *objectRecordStats) add(records int) {
+	s.merge(objectRecordStats{objects: 1, records: records, min: records, max: records, counts: objectRecordCounts(records)})
+}
+
+// Adds the objects of other stats
+func (s *objectRecordStats) merge(other objectRecordStats) {
+	if other.objects == 0 {
+		return
+	}
+	if s.objects == 0 || other.min < s.min {
+		s.min = other.min
+	}
+	if other.max > s.max {
+		s.max = other.max
+	}
+	s.objects += other.objects
+	s.records += other.records
+	if s.counts == nil {
+		s.counts = make([]int, len(objectRecordBuckets)+1)
+	}
+	for i, count := range other.counts {
+		s.counts[i] += count
+	}
+}
+
+// Returns the counts of a single object with the given number of records
+func objectRecordCounts(records int) []int {
+	counts := make([]int, len(objectRecordBuckets)+1)
+	counts[sort.Search(len(objectRecordBuckets), func(i int) bool { return records < objectRecordBuckets[i] })]++
+	return counts
+}
+
+// Returns the average number of records per object, with two decimals
+func (s *objectRecordStats) average() float64 {
+	if s.objects == 0 {
+		return 0
+	}
+	return math.Round(float64(s.records)/float64(s.objects)*100) / 100
+}
+
+// Returns the number of objects in each bucket of objectRecordBuckets.
+// Every bucket is returned, even empty ones, so that histograms of several runs line up.
+func (s *objectRecordStats) histogram() []ObjectRecordBucket {
+	buckets := make([]ObjectRecordBucket, len(objectRecordBuckets)+1)
+	lower := 0
+	for i, upper := range objectRecordBuckets {
+		buckets[i].Bucket = strconv.Itoa(lower) + "-" + strconv.Itoa(upper)
+		lower = upper
+	}
+	buckets[len(objectRecordBuckets)].Bucket = strconv.Itoa(lower) + "+"
+
+	for i, count := range s.counts {
+		buckets[i].Count = count
+	}
+	return buckets
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectRecordStats(t *testing.T) {
+	// Test case 1: no objects
+	var stats objectRecordStats
+	assert.Equal(t, 0.0, stats.average())
+	assert.Equal(t, []ObjectRecordBucket{{"0-1", 0}, {"1-10", 0}, {"10-100", 0}, {"100-1000", 0}, {"1000-10000", 0}, {"10000+", 0}}, stats.histogram())
+
+	// Test case 2: empty, small and large objects
+	for _, records := range []int{0, 5, 9, 10, 20000} {
+		stats.add(records)
+	}
+	assert.Equal(t, 0, stats.min)
+	assert.Equal(t, 20000, stats.max)
+	assert.Equal(t, 4004.8, stats.average())
+	assert.Equal(t, []ObjectRecordBucket{{"0-1", 1}, {"1-10", 2}, {"10-100", 1}, {"100-1000", 0}, {"1000-10000", 0}, {"10000+", 1}}, stats.histogram())
+
+	// Test case 3: the objects of other stats are merged
+	var other objectRecordStats
+	other.add(3)
+	other.add(1000)
+	var merged objectRecordStats
+	merged.merge(other)
+	merged.merge(objectRecordStats{})
+	assert.Equal(t, 3, merged.min)
+	assert.Equal(t, 1000, merged.max)
+	assert.Equal(t, 2, merged.objects)
+	assert.Equal(t, 501.5, merged.average())
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sirupsen/logrus"
+)
+
+// Alias of the projected log in the S3 Select output
+const selectLogAlias = "log"
+
+// Returns the S3 Select expression projecting the log of every JSON log entry.
+// With a fixed length record ID only the record ID and the timestamp following it are returned.
+func selectExpression(parser *RecordIdParser) string {
+	// Unquoted attribute names are matched case insensitively, like the default log field
+	field := "s." + defaultLogField
+	if parser.field != "" {
+		field = "s.\"" + strings.Replace(parser.field, "\"", "\"\"", -1) + "\""
+	} else if len(parser.path) > 0 {
+		field = "s"
+		for _, name := range parser.path {
+			field += ".\"" + strings.Replace(name, "\"", "\"\"", -1) + "\""
+		}
+	}
+
+	if parser.regex == nil {
+		field = fmt.Sprintf("SUBSTRING(%s, 1, %d)", field, parser.length+1+timestampLength)
+	}
+	return fmt.Sprintf("SELECT %s AS %s FROM S3Object s", field, selectLogAlias)
+}
+
+// Calls fn with the log of every JSON log entry in a S3 object, extracted server side with S3 Select.
+// Only JSON Lines objects are supported. Retries throttling and server side errors up to maxRetries times.
+// Returns the number of bytes S3 Select processed, which are decompressed for compressed objects.
+func selectS3ObjectLogs(ctx context.Context, s3Client s3API, bucket string, key *string, parser *RecordIdParser, maxRetries int, fn func(log string)) (int64, error) {
+	input := &s3.SelectObjectContentInput{
+		Bucket:         aws.String(bucket),
+		Key:            key,
+		Expression:     aws.String(selectExpression(parser)),
+		ExpressionType: aws.String(s3.ExpressionTypeSql),
+		InputSerialization: &s3.InputSerialization{
+			JSON: &s3.JSONInput{
+				Type: aws.String(s3.JSONTypeLines),
+			},
+		},
+		OutputSerialization: &s3.OutputSerialization{
+			JSON: &s3.JSONOutput{
+				RecordDelimiter: aws.String("\n"),
+			},
+		},
+	}
+
+	var response *s3.SelectObjectContentOutput
+	err := retryWithMaxRetries(ctx, maxRetries, func() error {
+		var err error
+		response, err = s3Client.SelectObjectContentWithContext(ctx, input)
+		return err
+	})
+	if isKMSAccessDenied(err) {
+		return 0, fmt.Errorf("access denied to s3 object %q encrypted with SSE-KMS, the validator is likely missing the kms:Decrypt permission on the key of the object: %w", aws.StringValue(key), err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error occured to select s3 object %q: %w", aws.StringValue(key), err)
+	}
+	defer response.EventStream.Close()
+
+	// Records may be split across events, so the lines are only parsed once the stream is done
+	var data bytes.Buffer
+	var processedBytes int64
+	for event := range response.EventStream.Events() {
+		switch e := event.(type) {
+		case *s3.RecordsEvent:
+			data.Write(e.Payload)
+		case *s3.StatsEvent:
+			if e.Details != nil {
+				processedBytes = aws.Int64Value(e.Details.BytesProcessed)
+			}
+		}
+	}
+	if err := response.EventStream.Err(); err != nil {
+		return processedBytes, fmt.Errorf("error to read the selected content of s3 object %q: %w", aws.StringValue(key), err)
+	}
+
+	for _, line := range strings.Split(data.String(), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var selected struct {
+			Log *string `json:"log"`
+		}
+		if err := json.Unmarshal([]byte(line), &selected); err != nil {
+			return processedBytes, fmt.Errorf("error to parse the selected content of s3 object %q: %w", aws.StringValue(key), err)
+		}
+		if selected.Log == nil {
+			logrus.Warnf("Malform log entry without a %q field in S3 object %q", parser.logField(), aws.StringValue(key))
+			// Skip log entries without a log (count them as lost logs)
+			parser.countUnparseable(1)
+			continue
+		}
+
+		fn(*selected.Log)
+	}
+
+	return processedBytes, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectExpression(t *testing.T) {
+	// Test case 1: fixed length record ID followed by the timestamp
+	parser := newRecordIdParser(8)
+	assert.Equal(t, "SELECT SUBSTRING(s.Log, 1, 22) AS log FROM S3Object s", selectExpression(parser))
+
+	// Test case 2: configured log field
+	parser.field = "message"
+	assert.Equal(t, "SELECT SUBSTRING(s.\"message\", 1, 22) AS log FROM S3Object s", selectExpression(parser))
+
+	// Test case 3: configured nested log field
+	parser = newRecordIdParser(8)
+	parser.path = []string{"data", "log"}
+	assert.Equal(t, "SELECT SUBSTRING(s.\"data\".\"log\", 1, 22) AS log FROM S3Object s", selectExpression(parser))
+
+	// Test case 4: the whole log is needed to match a record ID expression
+	parser, err := newRegexRecordIdParser(regexp.MustCompile(`^prefix-(?P<id>\d+)`))
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT s.Log AS log FROM S3Object s", selectExpression(parser))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sirupsen/logrus"
+)
+
+// An S3 object listed for validation, with its version when every version of the objects is validated
+type s3ObjectVersion struct {
+	*s3.Object
+	// Only set when the versions are listed
+	versionId *string
+	latest    bool
+}
+
+// Records found in one version of an object with several versions, e.g. overwritten by a retry
+type ObjectVersionRecords struct {
+	Key       string `json:"key"`
+	VersionId string `json:"version_id"`
+	Latest    bool   `json:"latest"`
+	Records   int    `json:"records"`
+}
+
+// Returns the location of an object for the audit log, with its version if it is known
+func (o s3ObjectVersion) location(bucket string) string {
+	if o.versionId == nil {
+		return fmt.Sprintf("s3://%s/%s", bucket, aws.StringValue(o.Key))
+	}
+	return fmt.Sprintf("s3://%s/%s?versionId=%s", bucket, aws.StringValue(o.Key), aws.StringValue(o.versionId))
+}
+
+// Lists every version of the objects with a prefix, unlike ListObjectsV2 which only returns the latest one.
+// Delete markers have no content and are left out. Like listS3Objects, each version is only sent once.
+func listS3ObjectVersions(ctx context.Context, s3Client s3API, bucket string, prefix string, pageSize int64, window TimeWindow, seen map[string]bool, skips *s3ListingSkips, send func(s3ObjectVersion) bool) error {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	if pageSize > 0 {
+		input.MaxKeys = aws.Int64(pageSize)
+	}
+
+	for {
+		response, err := s3Client.ListObjectVersionsWithContext(ctx, input)
+		if err != nil {
+			return fmt.Errorf("error occured to get the object versions with prefix %q from bucket %q: %w", prefix, bucket, err)
+		}
+
+		logrus.Infof("Listed %d object versions with prefix %q", len(response.Versions), prefix)
+		for _, version := range response.Versions {
+			id := aws.StringValue(version.Key) + "?versionId=" + aws.StringValue(version.VersionId)
+			if seen[id] {
+				skips.duplicates++
+				continue
+			}
+			seen[id] = true
+
+			// Versions written by other runs sharing the prefix are never downloaded
+			if !window.contains(aws.TimeValue(version.LastModified)) {
+				skips.outsideWindow++
+				continue
+			}
+
+			object := s3ObjectVersion{
+				Object: &s3.Object{
+					Key:          version.Key,
+					LastModified: version.LastModified,
+					Size:         version.Size,
+				},
+				versionId: version.VersionId,
+				latest:    aws.BoolValue(version.IsLatest),
+			}
+			if !send(object) {
+				return nil
+			}
+		}
+
+		if !aws.BoolValue(response.IsTruncated) {
+			return nil
+		}
+		input.KeyMarker = response.NextKeyMarker
+		input.VersionIdMarker = response.NextVersionIdMarker
+	}
+}
+
+// Returns the records of the versions of the objects which have several of them, by key with the latest version first
+func multipleVersions(versions []ObjectVersionRecords) []ObjectVersionRecords {
+	count := make(map[string]int)
+	for _, version := range versions {
+		count[version.Key]++
+	}
+
+	var multiple []ObjectVersionRecords
+	for _, version := range versions {
+		if count[version.Key] > 1 {
+			multiple = append(multiple, version)
+		}
+	}
+	// The versions are validated concurrently, in no particular order
+	sort.Slice(multiple, func(i, j int) bool {
+		if multiple[i].Key != multiple[j].Key {
+			return multiple[i].Key < multiple[j].Key
+		}
+		if multiple[i].Latest != multiple[j].Latest {
+			return multiple[i].Latest
+		}
+		return multiple[i].VersionId < multiple[j].VersionId
+	})
+	return multiple
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves the versions of the objects page by page, and the logs of every version by "key?versionId=id"
+type mockS3Versions struct {
+	s3API
+	pages   [][]*s3.ObjectVersion
+	objects map[string][]string
+}
+
+func (m *mockS3Versions) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	page := 0
+	if input.KeyMarker != nil {
+		page, _ = strconv.Atoi(aws.StringValue(input.KeyMarker))
+	}
+
+	output := &s3.ListObjectVersionsOutput{
+		IsTruncated: aws.Bool(page+1 < len(m.pages)),
+		Versions:    m.pages[page],
+		// Delete markers have no content and are never read
+		DeleteMarkers: []*s3.DeleteMarkerEntry{{Key: aws.String("deleted"), VersionId: aws.String("v1")}},
+	}
+	if page+1 < len(m.pages) {
+		output.NextKeyMarker = aws.String(strconv.Itoa(page + 1))
+		output.NextVersionIdMarker = aws.String("marker")
+	}
+	return output, nil
+}
+
+func (m *mockS3Versions) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	var body string
+	for _, log := range m.objects[aws.StringValue(input.Key)+"?versionId="+aws.StringValue(input.VersionId)] {
+		body += fmt.Sprintf("{\"log\":%q}\n", log)
+	}
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func objectVersion(key string, versionId string, latest bool) *s3.ObjectVersion {
+	return &s3.ObjectVersion{
+		Key:          aws.String(key),
+		VersionId:    aws.String(versionId),
+		IsLatest:     aws.Bool(latest),
+		LastModified: aws.Time(time.Unix(1639151837, 578000000)),
+		Size:         aws.Int64(mockObjectSize),
+	}
+}
+
+func TestValidateS3Versions(t *testing.T) {
+	client := &mockS3Versions{
+		pages: [][]*s3.ObjectVersion{
+			{objectVersion("a", "v2", true), objectVersion("a", "v1", false)},
+			{objectVersion("b", "v1", true)},
+		},
+		objects: map[string][]string{
+			"a?versionId=v1": producerLogs("10000000", "10000001"),
+			"a?versionId=v2": producerLogs("10000001"),
+			"b?versionId=v1": producerLogs("10000002"),
+		},
+	}
+	inputMap := newInputMap(3)
+
+	// Test case 1: the records of every version are counted, overwritten ones as duplicates
+	found, totals, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, inputMap, &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		useVersions:  true,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, found)
+	assert.Equal(t, map[string]int{"10000000": 1, "10000001": 2, "10000002": 1}, inputMap.toMap())
+	assert.Equal(t, 3, totals.objects)
+
+	// Test case 2: only the versions of the keys with several of them are reported
+	assert.Equal(t, []ObjectVersionRecords{
+		{Key: "a", VersionId: "v2", Latest: true, Records: 1},
+		{Key: "a", VersionId: "v1", Records: 2},
+	}, totals.versions)
+}
+
+func TestMultipleVersions(t *testing.T) {
+	// Test case 1: by key with the latest version first
+	versions := multipleVersions([]ObjectVersionRecords{
+		{Key: "b", VersionId: "1"},
+		{Key: "a", VersionId: "3"},
+		{Key: "b", VersionId: "2", Latest: true},
+		{Key: "c", VersionId: "1", Latest: true},
+		{Key: "a", VersionId: "1", Latest: true},
+	})
+	assert.Equal(t, []ObjectVersionRecords{
+		{Key: "a", VersionId: "1", Latest: true},
+		{Key: "a", VersionId: "3"},
+		{Key: "b", VersionId: "2", Latest: true},
+		{Key: "b", VersionId: "1"},
+	}, versions)
+
+	// Test case 2: no key with several versions
+	assert.Empty(t, multipleVersions([]ObjectVersionRecords{{Key: "a", VersionId: "1", Latest: true}}))
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/linkedin/goavro/v2"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Content of the manifests and data files holding rows, rather than the rows deleted from other data files
+	icebergContentData = 0
+	// Status of the manifest entries of the data files removed from the table
+	icebergStatusDeleted = 2
+	// Format of the data files written by Firehose and S3 Tables, the only one validated
+	icebergFormatParquet = "PARQUET"
+)
+
+// Subset of the Iceberg table metadata needed to find the data files of the current snapshot
+type icebergMetadata struct {
+	// Not set, or -1, for a table without any snapshot yet
+	CurrentSnapshotId *int64 `json:"current-snapshot-id"`
+	Snapshots         []struct {
+		SnapshotId   int64  `json:"snapshot-id"`
+		ManifestList string `json:"manifest-list"`
+		// Manifests of the format version 1 tables written without a manifest list
+		Manifests []string `json:"manifests"`
+	} `json:"snapshots"`
+}
+
+// A data file of the table, as listed in a manifest
+type icebergDataFile struct {
+	location string
+	// Number of rows in the file according to the manifest
+	records int64
+}
+
+// Returns the bucket and key of an S3 location, e.g. "s3://bucket/metadata/00001-uuid.metadata.json"
+func parseS3Location(location string) (string, string, error) {
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	// Iceberg writers using Hadoop file systems may use the s3a and s3n schemes
+	if parsed.Scheme != "s3" && parsed.Scheme != "s3a" && parsed.Scheme != "s3n" {
+		return "", "", fmt.Errorf("location %q is not in S3", location)
+	}
+	key := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Host == "" || key == "" {
+		return "", "", fmt.Errorf("location %q has no bucket or key", location)
+	}
+	return parsed.Host, key, nil
+}
+
+// Downloads the S3 object at a location, returns its content and the time it was last modified
+func readS3Location(ctx context.Context, s3Client s3API, location string, maxRetries int) ([]byte, time.Time, error) {
+	bucket, key, err := parseS3Location(location)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	obj, err := getS3Object(ctx, s3Client, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}, maxRetries)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer obj.Body.Close()
+
+	data, err := ioutil.ReadAll(obj.Body)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error to read s3 object %q: %w", key, err)
+	}
+	return data, aws.TimeValue(obj.LastModified), nil
+}
+
+// Calls fn with every record of an Avro object container file, e.g. an Iceberg manifest list or manifest
+func readAvroRecords(data []byte, fn func(record map[string]interface{}) error) error {
+	ocfReader, err := goavro.NewOCFReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for ocfReader.Scan() {
+		datum, err := ocfReader.Read()
+		if err != nil {
+			return err
+		}
+		record, ok := datum.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("unexpected avro record %v", datum)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return ocfReader.Err()
+}
+
+// Returns an integer field of an Avro record, which is 0 if it is not set, e.g. the content of a format version 1 manifest
+func avroInt(record map[string]interface{}, field string) int64 {
+	switch value := record[field].(type) {
+	case int32:
+		return int64(value)
+	case int64:
+		return value
+	}
+	return 0
+}
+
+// Returns a string field of an Avro record, empty if it is not set
+func avroString(record map[string]interface{}, field string) string {
+	value, _ := record[field].(string)
+	return value
+}
+
+// Lists the data files of the current snapshot of an Iceberg table from its metadata file.
+// The snapshot's manifest list leads to the manifests, which list the data files. Delete files and the manifests
+// of delete files are left out with a warning, the rows they delete are still counted.
+func icebergDataFiles(ctx context.Context, s3Client s3API, metadataLocation string, maxRetries int) ([]icebergDataFile, error) {
+	data, _, err := readS3Location(ctx, s3Client, metadataLocation, maxRetries)
+	if err != nil {
+		return nil, fmt.Errorf("error occured to get the table metadata: %w", err)
+	}
+	var metadata icebergMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("error to parse the table metadata %q: %w", metadataLocation, err)
+	}
+
+	if metadata.CurrentSnapshotId == nil || *metadata.CurrentSnapshotId == -1 {
+		logrus.Warnf("Table %q has no snapshot yet", metadataLocation)
+		return nil, nil
+	}
+	var manifestList string
+	var manifests []string
+	found := false
+	for _, snapshot := range metadata.Snapshots {
+		if snapshot.SnapshotId == *metadata.CurrentSnapshotId {
+			manifestList, manifests, found = snapshot.ManifestList, snapshot.Manifests, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("current snapshot %d not found in the table metadata %q", *metadata.CurrentSnapshotId, metadataLocation)
+	}
+
+	if manifestList != "" {
+		data, _, err := readS3Location(ctx, s3Client, manifestList, maxRetries)
+		if err != nil {
+			return nil, fmt.Errorf("error occured to get the manifest list: %w", err)
+		}
+		manifests = nil
+		err = readAvroRecords(data, func(record map[string]interface{}) error {
+			if avroInt(record, "content") != icebergContentData {
+				logrus.Warnf("Skipped manifest of delete files %q, the rows it deletes are still counted", avroString(record, "manifest_path"))
+				return nil
+			}
+			manifests = append(manifests, avroString(record, "manifest_path"))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error to parse the manifest list %q: %w", manifestList, err)
+		}
+	}
+
+	var dataFiles []icebergDataFile
+	for _, manifest := range manifests {
+		data, _, err := readS3Location(ctx, s3Client, manifest, maxRetries)
+		if err != nil {
+			return nil, fmt.Errorf("error occured to get the manifest: %w", err)
+		}
+		err = readAvroRecords(data, func(entry map[string]interface{}) error {
+			if avroInt(entry, "status") == icebergStatusDeleted {
+				return nil
+			}
+			dataFile, ok := entry["data_file"].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("manifest entry without a data file")
+			}
+			location := avroString(dataFile, "file_path")
+			if avroInt(dataFile, "content") != icebergContentData {
+				logrus.Warnf("Skipped delete file %q, the rows it deletes are still counted", location)
+				return nil
+			}
+			if format := avroString(dataFile, "file_format"); !strings.EqualFold(format, icebergFormatParquet) {
+				return fmt.Errorf("data file %q is in %s format, only %s data files are supported", location, format, icebergFormatParquet)
+			}
+			dataFiles = append(dataFiles, icebergDataFile{location: location, records: avroInt(dataFile, "record_count")})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error to parse the manifest %q: %w", manifest, err)
+		}
+	}
+
+	logrus.Infof("Found %d data files in %d manifests of snapshot %d", len(dataFiles), len(manifests), *metadata.CurrentSnapshotId)
+	return dataFiles, nil
+}
+
+// Validate logs in an Amazon S3 Tables or other Iceberg table, e.g. written by Firehose. Experimental.
+// Rather than listing objects, the data files of the current snapshot are found from the table metadata and their
+// log column is read like the log field of the S3 objects. The data files are downloaded by workerCount workers,
+// each file as a whole since Parquet is read from its footer. The time a data file was last modified is the time its
+// records arrived, data files last modified outside of the window are skipped.
+// Once ctx is done, the records found so far are returned.
+func validate_s3tables(ctx context.Context, s3Client s3API, metadataLocation string, inputMap *RecordMap, settings *validatorSettings, progress *Progress) (int, s3Totals, error) {
+	var totals s3Totals
+	dataFiles, err := icebergDataFiles(ctx, s3Client, metadataLocation, settings.s3MaxRetries)
+	if err != nil {
+		return 0, totals, err
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	s3TablesRecordCounter := 0
+	outsideWindow := 0
+
+	// Cancelled on the first error, so that the other workers stop early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	files := make(chan icebergDataFile)
+	for i := 0; i < settings.workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				// Drain the remaining data files without downloading them once the run is over
+				if ctx.Err() != nil {
+					continue
+				}
+				data, lastModified, err := readS3Location(ctx, s3Client, file.location, settings.s3MaxRetries)
+				if err == nil && !settings.window.contains(lastModified) {
+					mutex.Lock()
+					outsideWindow++
+					mutex.Unlock()
+					continue
+				}
+
+				var recordIds []string
+				var recordTimings []recordTiming
+				rowCounter := 0
+				if err == nil {
+					err = settings.parser.scanParquetLogs(data, func(log string) {
+						rowCounter++
+						recordId, ok := settings.parser.parse(log)
+						if !ok {
+							// Skip rows without a record ID (count them as lost logs) and foreign records
+							return
+						}
+						settings.audit.add(recordId, "%s:%d", file.location, rowCounter)
+						recordIds = append(recordIds, recordId)
+						if timestamp, ok := settings.parser.timestamp(log); ok {
+							recordTimings = append(recordTimings, recordTiming{recordId: recordId, produced: timestamp, arrived: lastModified})
+						}
+					})
+					if err != nil {
+						err = fmt.Errorf("error to read data file %q: %w", file.location, err)
+					}
+				}
+				if err != nil {
+					mutex.Lock()
+					// The data file may have been read partially once the run is over, which is not an error
+					if firstErr == nil && ctx.Err() == nil {
+						firstErr = err
+					}
+					mutex.Unlock()
+					cancel()
+					continue
+				}
+
+				if file.records != int64(rowCounter) {
+					logrus.Warnf("Read %d rows from data file %q, which has %d rows according to its manifest", rowCounter, file.location, file.records)
+				}
+				logrus.Debugf("Found %d records in data file %q", len(recordIds), file.location)
+
+				mutex.Lock()
+				s3TablesRecordCounter += len(recordIds)
+				for _, recordId := range recordIds {
+					// Counting the occurrences of this record in the destination
+					countRecord(inputMap, recordId, 1, settings.parser)
+				}
+				for _, timing := range recordTimings {
+					settings.delays.addRecord(timing)
+				}
+				if len(recordIds) > 0 {
+					settings.delays.addArrival(lastModified)
+				}
+				fileTotals := s3Totals{objects: 1, bytes: int64(len(data)), contentBytes: int64(len(data))}
+				fileTotals.perObject.add(len(recordIds))
+				totals.add(fileTotals)
+				mutex.Unlock()
+				progress.add(len(recordIds), 1)
+			}
+		}()
+	}
+
+	for _, file := range dataFiles {
+		if ctx.Err() != nil {
+			break
+		}
+		files <- file
+	}
+	close(files)
+	wg.Wait()
+
+	if outsideWindow > 0 {
+		logrus.Infof("Skipped %d data files last modified outside of the time window", outsideWindow)
+	}
+	if firstErr != nil {
+		return s3TablesRecordCounter, totals, firstErr
+	}
+
+	logrus.Infof("Validated %d data files of %d bytes", totals.objects, totals.bytes)
+
+	return s3TablesRecordCounter, totals, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// Subset of the Avro schema of the Iceberg manifest lists
+const icebergManifestListSchema = `{"type": "record", "name": "manifest_file", "fields": [
+	{"name": "manifest_path", "type": "string"},
+	{"name": "content", "type": "int"}
+]}`
+
+// Subset of the Avro schema of the Iceberg manifests
+const icebergManifestSchema = `{"type": "record", "name": "manifest_entry", "fields": [
+	{"name": "status", "type": "int"},
+	{"name": "data_file", "type": {"type": "record", "name": "r2", "fields": [
+		{"name": "content", "type": "int"},
+		{"name": "file_path", "type": "string"},
+		{"name": "file_format", "type": "string"},
+		{"name": "record_count", "type": "long"}
+	]}}
+]}`
+
+// Serves the objects of a table by location, each last modified at the given time
+type mockS3Tables struct {
+	s3API
+	objects      map[string][]byte
+	lastModified map[string]time.Time
+}
+
+func (m *mockS3Tables) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	location := "s3://" + aws.StringValue(input.Bucket) + "/" + aws.StringValue(input.Key)
+	data, ok := m.objects[location]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	lastModified, ok := m.lastModified[location]
+	if !ok {
+		lastModified = time.Unix(1639151837, 578000000)
+	}
+	return &s3.GetObjectOutput{
+		Body:         ioutil.NopCloser(bytes.NewReader(data)),
+		LastModified: aws.Time(lastModified),
+	}, nil
+}
+
+// Returns an Avro object container file with the records
+func avroFile(t *testing.T, schema string, records ...map[string]interface{}) []byte {
+	var buffer bytes.Buffer
+	ocfWriter, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buffer, Schema: schema})
+	assert.NoError(t, err)
+	data := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		data = append(data, record)
+	}
+	assert.NoError(t, ocfWriter.Append(data))
+	return buffer.Bytes()
+}
+
+// Returns a manifest entry of a data file
+func manifestEntry(status int32, content int32, location string, format string, records int64) map[string]interface{} {
+	return map[string]interface{}{
+		"status": status,
+		"data_file": map[string]interface{}{
+			"content":      content,
+			"file_path":    location,
+			"file_format":  format,
+			"record_count": records,
+		},
+	}
+}
+
+// Returns the objects of a table with two data files in its current snapshot, besides a removed data file,
+// a delete file and a manifest of delete files
+func icebergTable(t *testing.T) map[string][]byte {
+	metadata, err := json.Marshal(map[string]interface{}{
+		"format-version":      2,
+		"current-snapshot-id": 2,
+		"snapshots": []map[string]interface{}{
+			{"snapshot-id": 1, "manifest-list": "s3://table/metadata/snap-1.avro"},
+			{"snapshot-id": 2, "manifest-list": "s3://table/metadata/snap-2.avro"},
+		},
+	})
+	assert.NoError(t, err)
+
+	return map[string][]byte{
+		"s3://table/metadata/00002.metadata.json": metadata,
+		"s3://table/metadata/snap-2.avro": avroFile(t, icebergManifestListSchema,
+			map[string]interface{}{"manifest_path": "s3://table/metadata/manifest-1.avro", "content": int32(0)},
+			map[string]interface{}{"manifest_path": "s3://table/metadata/manifest-2.avro", "content": int32(0)},
+			map[string]interface{}{"manifest_path": "s3://table/metadata/deletes.avro", "content": int32(1)},
+		),
+		"s3://table/metadata/manifest-1.avro": avroFile(t, icebergManifestSchema,
+			manifestEntry(1, 0, "s3://table/data/00000.parquet", "PARQUET", 2),
+			manifestEntry(2, 0, "s3://table/data/removed.parquet", "PARQUET", 1),
+		),
+		"s3://table/metadata/manifest-2.avro": avroFile(t, icebergManifestSchema,
+			manifestEntry(0, 0, "s3://table/data/00001.parquet", "PARQUET", 1),
+			manifestEntry(1, 1, "s3://table/data/deletes.parquet", "PARQUET", 1),
+		),
+		"s3://table/data/00000.parquet": parquetLogs(t, producerLogs("10000000", "10000001")...),
+		"s3://table/data/00001.parquet": parquetLogs(t, producerLogs("10000001")...),
+	}
+}
+
+func TestParseS3Location(t *testing.T) {
+	// Test case 1: bucket and key of an s3 location
+	bucket, key, err := parseS3Location("s3://table--table-s3/metadata/00001.metadata.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "table--table-s3", bucket)
+	assert.Equal(t, "metadata/00001.metadata.json", key)
+
+	// Test case 2: location of a Hadoop file system
+	bucket, key, err = parseS3Location("s3a://bucket/data/00000.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, "bucket", bucket)
+	assert.Equal(t, "data/00000.parquet", key)
+
+	// Test case 3: location outside of S3
+	_, _, err = parseS3Location("/tmp/00001.metadata.json")
+	assert.Error(t, err)
+
+	// Test case 4: location without a key
+	_, _, err = parseS3Location("s3://bucket/")
+	assert.Error(t, err)
+}
+
+func TestIcebergDataFiles(t *testing.T) {
+	// Test case 1: the data files of the current snapshot, without the removed and delete files
+	client := &mockS3Tables{objects: icebergTable(t)}
+	dataFiles, err := icebergDataFiles(context.Background(), client, "s3://table/metadata/00002.metadata.json", retryMaxRetries)
+	assert.NoError(t, err)
+	assert.Equal(t, []icebergDataFile{{location: "s3://table/data/00000.parquet", records: 2}, {location: "s3://table/data/00001.parquet", records: 1}}, dataFiles)
+
+	// Test case 2: a table without any snapshot has no data files
+	client = &mockS3Tables{objects: map[string][]byte{
+		"s3://table/metadata/00000.metadata.json": []byte(`{"format-version": 2, "current-snapshot-id": -1, "snapshots": []}`),
+	}}
+	dataFiles, err = icebergDataFiles(context.Background(), client, "s3://table/metadata/00000.metadata.json", retryMaxRetries)
+	assert.NoError(t, err)
+	assert.Empty(t, dataFiles)
+
+	// Test case 3: a format version 1 snapshot listing its manifests
+	objects := icebergTable(t)
+	objects["s3://table/metadata/00001.metadata.json"] = []byte(`{"format-version": 1, "current-snapshot-id": 1, "snapshots": [{"snapshot-id": 1, "manifests": ["s3://table/metadata/manifest-2.avro"]}]}`)
+	client = &mockS3Tables{objects: objects}
+	dataFiles, err = icebergDataFiles(context.Background(), client, "s3://table/metadata/00001.metadata.json", retryMaxRetries)
+	assert.NoError(t, err)
+	assert.Equal(t, []icebergDataFile{{location: "s3://table/data/00001.parquet", records: 1}}, dataFiles)
+
+	// Test case 4: data files in another format fail
+	objects = icebergTable(t)
+	objects["s3://table/metadata/manifest-2.avro"] = avroFile(t, icebergManifestSchema, manifestEntry(1, 0, "s3://table/data/00001.orc", "ORC", 1))
+	client = &mockS3Tables{objects: objects}
+	_, err = icebergDataFiles(context.Background(), client, "s3://table/metadata/00002.metadata.json", retryMaxRetries)
+	assert.Error(t, err)
+
+	// Test case 5: a missing metadata file fails
+	client = &mockS3Tables{objects: map[string][]byte{}}
+	_, err = icebergDataFiles(context.Background(), client, "s3://table/metadata/00002.metadata.json", retryMaxRetries)
+	assert.Error(t, err)
+}
+
+func TestValidateS3Tables(t *testing.T) {
+	// Test case 1: the records of every data file are counted
+	client := &mockS3Tables{objects: icebergTable(t)}
+	inputMap := newInputMap(2)
+	found, totals, err := validate_s3tables(context.Background(), client, "s3://table/metadata/00002.metadata.json", inputMap, &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, 2, totals.objects)
+	occurrences, _ := inputMap.get("10000001")
+	assert.Equal(t, 2, occurrences)
+
+	// Test case 2: data files last modified outside of the window are skipped
+	start := time.Unix(1639151837, 0)
+	client = &mockS3Tables{objects: icebergTable(t), lastModified: map[string]time.Time{"s3://table/data/00001.parquet": start.Add(-time.Hour)}}
+	found, totals, err = validate_s3tables(context.Background(), client, "s3://table/metadata/00002.metadata.json", newInputMap(2), &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		window:       TimeWindow{start: start},
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found)
+	assert.Equal(t, 1, totals.objects)
+
+	// Test case 3: a missing data file fails
+	objects := icebergTable(t)
+	delete(objects, "s3://table/data/00001.parquet")
+	client = &mockS3Tables{objects: objects}
+	_, _, err = validate_s3tables(context.Background(), client, "s3://table/metadata/00002.metadata.json", newInputMap(2), &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: 0,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// Hashed along with every record ID, so that the same records are sampled in every run
+const sampleSeed = "aws-for-fluent-bit-load-test"
+
+// Returns true if the record belongs to the sample of the given rate between 0 and 1.
+// The sample is deterministic, a record ID is either always or never sampled at a given rate,
+// and the sample of a lower rate is a subset of the sample of a higher one.
+func isSampled(recordId string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(sampleSeed))
+	hash.Write([]byte(recordId))
+	return float64(hash.Sum64()) < rate*math.MaxUint64
+}
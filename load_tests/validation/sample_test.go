@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSampled(t *testing.T) {
+	// Test case 1: every record at a rate of 1
+	assert.True(t, isSampled("10000000", 1))
+
+	// Test case 2: the sample is reproducible, close to the rate, and nested in the sample of a higher rate
+	sampled := 0
+	for i := 0; i < 100000; i++ {
+		recordId := strconv.Itoa(idCounterBase + i)
+		if isSampled(recordId, 0.1) {
+			sampled++
+			assert.True(t, isSampled(recordId, 0.1))
+			assert.True(t, isSampled(recordId, 0.5))
+		}
+	}
+	assert.InDelta(t, 10000, sampled, 500)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Creates the session shared by all the destination clients.
+// When ASSUME_ROLE_ARN is set, the default credentials are only used to assume that role,
+// so that destinations in another account can be validated.
+// When AWS_ENDPOINT_URL is set, every client targets that endpoint instead of AWS, e.g. LocalStack.
+func getSession(region string) (*session.Session, error) {
+	config := &aws.Config{
+		Region: aws.String(region),
+	}
+	if endpoint := os.Getenv(envEndpointUrl); endpoint != "" {
+		// Bucket names can not be resolved as subdomains of a custom endpoint
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+	transport, err := getTransport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		config.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	sess, err := session.NewSession(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	roleArn := os.Getenv(envRoleArn)
+	if roleArn == "" {
+		return sess, nil
+	}
+
+	credentials := stscreds.NewCredentials(sess, roleArn, func(provider *stscreds.AssumeRoleProvider) {
+		// A session name is generated when none is given
+		if sessionName := os.Getenv(envRoleSession); sessionName != "" {
+			provider.RoleSessionName = sessionName
+		}
+	})
+
+	return sess.Copy(&aws.Config{
+		Credentials: credentials,
+	}), nil
+}
+
+// Returns the transport of every client when CA_BUNDLE_FILE is set, e.g. behind a corporate proxy which re-signs the TLS traffic.
+// The certificates of the bundle are trusted in addition to the system ones, and HTTPS_PROXY is used unless NO_PROXY excludes the host.
+// Returns nil without a bundle, the default transport uses HTTPS_PROXY and NO_PROXY the same way.
+func getTransport() (*http.Transport, error) {
+	path := os.Getenv(envCABundle)
+	if path == "" {
+		return nil, nil
+	}
+	bundle, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no PEM encoded certificate found in the CA bundle %q", path)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return transport, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "session")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+	invalid := filepath.Join(dir, "invalid.pem")
+	assert.NoError(t, ioutil.WriteFile(invalid, []byte("not a certificate"), 0644))
+	defer os.Unsetenv(envCABundle)
+
+	// Test case 1: the default transport without a bundle, which does not trust the certificate of the server
+	os.Unsetenv(envCABundle)
+	transport, err := getTransport()
+	assert.NoError(t, err)
+	assert.Nil(t, transport)
+	_, err = http.Get(server.URL)
+	assert.Error(t, err)
+
+	// Test case 2: the certificates of the bundle are trusted
+	os.Setenv(envCABundle, bundle)
+	transport, err = getTransport()
+	assert.NoError(t, err)
+	response, err := (&http.Client{Transport: transport}).Get(server.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+
+	// Test case 3: a bundle which is missing or holds no certificate fails
+	os.Setenv(envCABundle, filepath.Join(dir, "missing.pem"))
+	_, err = getTransport()
+	assert.Error(t, err)
+	os.Setenv(envCABundle, invalid)
+	_, err = getTransport()
+	assert.Error(t, err)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/sirupsen/logrus"
+)
+
+// Most messages a single ReceiveMessage or DeleteMessageBatch call handles
+const sqsBatchSize = 10
+
+// Time a ReceiveMessage call waits for messages to arrive, the longest SQS allows.
+// A variable so that tests do not have to wait.
+var sqsWaitSeconds int64 = 20
+
+// Subset of the SQS API used for validation, so that it can be mocked in tests
+type sqsAPI interface {
+	ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageBatchWithContext(ctx aws.Context, input *sqs.DeleteMessageBatchInput, opts ...request.Option) (*sqs.DeleteMessageBatchOutput, error)
+	GetQueueAttributesWithContext(ctx aws.Context, input *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error)
+}
+
+// Creates a new SQS Client
+func getSQSClient(region string) (*sqs.SQS, error) {
+	sess, err := getSession(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sqs.New(sess), nil
+}
+
+// Validate logs in an SQS queue.
+// The queue is drained with long polling, sqsBatchSize messages at a time, until a receive returns no messages.
+// Similar logic as Kinesis validation, the body of each message holds the records and its sent time is the arrival.
+// Receiving is destructive, the messages are deleted once counted. With a peekTimeout they are kept instead,
+// hidden from every consumer for peekTimeout so that they are not received twice, and return to the queue after it.
+// Receiving stops before the first messages peeked may return, the messages left in the queue are then not counted.
+// Once ctx is done, the records found so far are returned.
+func validate_sqs(ctx context.Context, sqsClient sqsAPI, queueUrl string, peekTimeout time.Duration, inputMap *RecordMap, parser *RecordIdParser, delays *DelayStats) (int, error) {
+	sqsRecordCounter := 0
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueUrl),
+		MaxNumberOfMessages: aws.Int64(sqsBatchSize),
+		WaitTimeSeconds:     aws.Int64(sqsWaitSeconds),
+		AttributeNames:      []*string{aws.String(sqs.MessageSystemAttributeNameSentTimestamp)},
+	}
+	if peekTimeout > 0 {
+		input.VisibilityTimeout = aws.Int64(int64(peekTimeout.Seconds()))
+	}
+
+	// Time the first messages peeked return to the queue, unknown until any are received
+	var visibleAgain time.Time
+	for ctx.Err() == nil {
+		// A long poll ending after the messages returned would receive them again, counting them as duplicates
+		if !visibleAgain.IsZero() && time.Until(visibleAgain) <= time.Duration(sqsWaitSeconds)*time.Second {
+			logrus.Warnf("Stopped receiving the messages of queue %q before the first ones return to it after %s, the messages left are not counted. Set a longer peek timeout for environment variable- %s", queueUrl, peekTimeout, envSQSPeek)
+			break
+		}
+		receiveStart := time.Now()
+		var response *sqs.ReceiveMessageOutput
+		// retry for throttling exception and server side errors
+		err := retryWithBackoff(ctx, func() error {
+			var err error
+			response, err = sqsClient.ReceiveMessageWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return sqsRecordCounter, fmt.Errorf("error occured to receive the messages of queue %q: %w", queueUrl, err)
+		}
+		// The queue is drained once a long poll returns nothing
+		if len(response.Messages) == 0 {
+			break
+		}
+		if peekTimeout > 0 && visibleAgain.IsZero() {
+			visibleAgain = receiveStart.Add(peekTimeout)
+		}
+
+		logrus.Debugf("Received %d messages from queue %q", len(response.Messages), queueUrl)
+		for _, message := range response.Messages {
+			logs, err := parser.getLogs([]byte(aws.StringValue(message.Body)))
+			if err != nil {
+				return sqsRecordCounter, fmt.Errorf("error to parse message %q of queue %q: %w", aws.StringValue(message.MessageId), queueUrl, err)
+			}
+			arrived := sqsSentTime(message)
+			for _, log := range logs {
+				recordId, ok := parser.parse(log)
+				if !ok {
+					// Skip logs without a record ID (count them as lost logs)
+					continue
+				}
+				sqsRecordCounter += 1
+				// Counting the occurrences of this record in the destination
+				countRecord(inputMap, recordId, 1, parser)
+				if timestamp, ok := parser.timestamp(log); ok && !arrived.IsZero() {
+					delays.addRecord(recordTiming{recordId: recordId, produced: timestamp, arrived: arrived})
+				} else {
+					delays.addArrival(arrived)
+				}
+			}
+		}
+
+		if peekTimeout == 0 {
+			if err := deleteSQSMessages(ctx, sqsClient, queueUrl, response.Messages); err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				return sqsRecordCounter, err
+			}
+		}
+	}
+
+	return sqsRecordCounter, nil
+}
+
+// Returns the time SQS received a message, or the zero time if it is not known
+func sqsSentTime(message *sqs.Message) time.Time {
+	milliseconds, err := strconv.ParseInt(aws.StringValue(message.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, milliseconds*int64(time.Millisecond))
+}
+
+// Deletes the received messages from the queue with a single batch call
+func deleteSQSMessages(ctx context.Context, sqsClient sqsAPI, queueUrl string, messages []*sqs.Message) error {
+	entries := make([]*sqs.DeleteMessageBatchRequestEntry, 0, len(messages))
+	for i, message := range messages {
+		entries = append(entries, &sqs.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: message.ReceiptHandle,
+		})
+	}
+
+	var response *sqs.DeleteMessageBatchOutput
+	err := retryWithBackoff(ctx, func() error {
+		var err error
+		response, err = sqsClient.DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(queueUrl),
+			Entries:  entries,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error occured to delete the messages of queue %q: %w", queueUrl, err)
+	}
+	// A message which was not deleted is received again once visible, and counted as a duplicate
+	for _, failed := range response.Failed {
+		messageId := aws.StringValue(failed.Id)
+		if i, err := strconv.Atoi(messageId); err == nil && i < len(messages) {
+			messageId = aws.StringValue(messages[i].MessageId)
+		}
+		logrus.Warnf("Unable to delete message %s of queue %q, it may be counted twice: %s", messageId, queueUrl, aws.StringValue(failed.Message))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves the messages of a queue up to the requested number at a time, recording the deleted ones
+type mockSQS struct {
+	sqsAPI
+	messages []*sqs.Message
+	deleted  []string
+	// Visibility timeout of every receive call
+	visibilityTimeouts []int64
+	err                error
+}
+
+func (m *mockSQS) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	m.visibilityTimeouts = append(m.visibilityTimeouts, aws.Int64Value(input.VisibilityTimeout))
+	count := int(aws.Int64Value(input.MaxNumberOfMessages))
+	if count > len(m.messages) {
+		count = len(m.messages)
+	}
+	output := &sqs.ReceiveMessageOutput{Messages: m.messages[:count]}
+	m.messages = m.messages[count:]
+	return output, nil
+}
+
+func (m *mockSQS) DeleteMessageBatchWithContext(ctx aws.Context, input *sqs.DeleteMessageBatchInput, opts ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+	for _, entry := range input.Entries {
+		m.deleted = append(m.deleted, aws.StringValue(entry.ReceiptHandle))
+	}
+	return &sqs.DeleteMessageBatchOutput{}, nil
+}
+
+func (m *mockSQS) GetQueueAttributesWithContext(ctx aws.Context, input *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	return &sqs.GetQueueAttributesOutput{}, m.err
+}
+
+// Returns SQS messages holding one JSON log entry each, sent a second after the producer timestamp of the logs
+func sqsMessages(logs ...string) []*sqs.Message {
+	var messages []*sqs.Message
+	for i, log := range logs {
+		messages = append(messages, &sqs.Message{
+			MessageId:     aws.String(log),
+			ReceiptHandle: aws.String(string(rune('a' + i))),
+			Body:          aws.String(`{"log":"` + log + `"}`),
+			Attributes:    map[string]*string{sqs.MessageSystemAttributeNameSentTimestamp: aws.String("1639151828578")},
+		})
+	}
+	return messages
+}
+
+func TestValidateSQS(t *testing.T) {
+	logs := producerLogs("10000000", "10000001", "10000001", "10000003", "10000000", "10000001", "10000000", "10000001", "10000000", "10000001", "10000000")
+
+	// Test case 1: the queue is drained ten messages at a time, deleting them
+	client := &mockSQS{messages: sqsMessages(logs...)}
+	inputMap := newInputMap(3)
+	parser := newRecordIdParser(defaultRecordIdLength)
+	parser.minId, parser.maxId = idCounterBase, idCounterBase+3
+	delays := &DelayStats{}
+	found, err := validate_sqs(context.Background(), client, "queue", 0, inputMap, parser, delays)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, found)
+	assert.Equal(t, map[string]int{"10000000": 5, "10000001": 5, "10000002": 0}, inputMap.toMap())
+	assert.Equal(t, 1, parser.foreignCount())
+	assert.Len(t, client.deleted, 11)
+	assert.Equal(t, []int64{0, 0, 0}, client.visibilityTimeouts)
+	assert.Equal(t, 10, delays.count)
+	assert.Equal(t, time.Second, delays.max)
+
+	// Test case 2: peeking hides the messages instead of deleting them
+	client = &mockSQS{messages: sqsMessages(logs[:2]...)}
+	inputMap = newInputMap(3)
+	found, err = validate_sqs(context.Background(), client, "queue", 5*time.Minute, inputMap, newRecordIdParser(defaultRecordIdLength), &DelayStats{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found)
+	assert.Empty(t, client.deleted)
+	assert.Equal(t, []int64{300, 300}, client.visibilityTimeouts)
+
+	// Test case 3: receiving stops before the messages peeked first are visible again
+	client = &mockSQS{messages: sqsMessages(logs...)}
+	found, err = validate_sqs(context.Background(), client, "queue", time.Duration(sqsWaitSeconds)*time.Second, newInputMap(3), newRecordIdParser(defaultRecordIdLength), &DelayStats{})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, found)
+	assert.Len(t, client.visibilityTimeouts, 1)
+}
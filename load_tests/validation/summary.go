@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Value of SUMMARY_LINE printing the summary line to stdout rather than writing it to a file
+const summaryStdout = "stdout"
+
+// Allowed results of a run, which fails when any destination is outside of them
+type thresholds struct {
+	maxLossPercent float64
+	// Duplicates are not checked if negative
+	maxDuplicates int
+	// The number of S3 objects is not checked if negative
+	expectedObjects int
+	objectTolerance float64
+}
+
+// Returns why the results of a destination are outside of the thresholds, nothing if they are within
+func (t thresholds) failures(result Results) []string {
+	in := ""
+	if result.Destination != "" {
+		in = " in " + result.Destination
+	}
+	var failures []string
+	if result.PercentLoss > t.maxLossPercent {
+		failures = append(failures, fmt.Sprintf("Log loss of %s%%%s exceeds the allowed %v%%", formatPercent(result.PercentLoss), in, t.maxLossPercent))
+	}
+	if t.maxDuplicates >= 0 && result.Duplicate > t.maxDuplicates {
+		failures = append(failures, fmt.Sprintf("%d duplicate records%s exceed the allowed %d", result.Duplicate, in, t.maxDuplicates))
+	}
+	// A wildly different number of objects points at a buffering misconfiguration, even without any loss
+	if t.expectedObjects >= 0 && result.S3Objects != nil {
+		if deviation := percentDeviation(*result.S3Objects, t.expectedObjects); deviation > t.objectTolerance {
+			failures = append(failures, fmt.Sprintf("%d S3 objects%s deviate %.1f%% from the expected %d, more than the allowed %v%%", *result.S3Objects, in, deviation, t.expectedObjects, t.objectTolerance))
+		}
+	}
+	return failures
+}
+
+// Returns why the duplication results of a destination are outside of the thresholds, nothing if they are within
+func (t thresholds) duplicateFailures(result DuplicateResults) []string {
+	if t.maxDuplicates < 0 || result.Duplicate <= t.maxDuplicates {
+		return nil
+	}
+	in := ""
+	if result.Destination != "" {
+		in = " in " + result.Destination
+	}
+	return []string{fmt.Sprintf("%d duplicate records%s exceed the allowed %d", result.Duplicate, in, t.maxDuplicates)}
+}
+
+// Returns the results of a run as a single line for chat notifications, e.g. "PASS s3 5000000/5000000 loss=0.00% dup=1203 p99=2.4s".
+// The results of several destinations are separated by commas, results without a destination are labelled with the given one.
+func summaryLine(passed bool, destination string, results []Results, duplicateResults []DuplicateResults) string {
+	status := "PASS"
+	if !passed {
+		status = "FAIL"
+	}
+	label := func(resultDestination string) string {
+		if resultDestination != "" {
+			return resultDestination
+		}
+		return destination
+	}
+
+	var parts []string
+	for _, result := range results {
+		p99 := time.Duration(result.DelayP99Ms) * time.Millisecond
+		parts = append(parts, fmt.Sprintf("%s %d/%d loss=%s%% dup=%d p99=%s", label(result.Destination), result.Unique, result.TotalInput, formatPercent(result.PercentLoss), result.Duplicate, p99))
+	}
+	// Duplicates only runs know nothing about the loss
+	for _, result := range duplicateResults {
+		parts = append(parts, fmt.Sprintf("%s unique=%d dup=%d", label(result.Destination), result.Unique, result.Duplicate))
+	}
+	return status + " " + strings.Join(parts, ", ")
+}
+
+// Prints the summary line to stdout, or writes it to the file at path
+func writeSummaryLine(path string, line string) error {
+	if path == summaryStdout {
+		fmt.Println(line)
+		return nil
+	}
+	return ioutil.WriteFile(path, []byte(line+"\n"), 0644)
+}
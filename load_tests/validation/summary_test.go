@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThresholds(t *testing.T) {
+	objects := 15
+	result := Results{Destination: "s3", PercentLoss: 0.5, Duplicate: 10, S3Objects: &objects}
+
+	// Test case 1: results within the thresholds
+	limits := thresholds{maxLossPercent: 1, maxDuplicates: -1, expectedObjects: -1, objectTolerance: defaultObjectCountTolerance}
+	assert.Empty(t, limits.failures(result))
+	assert.Empty(t, limits.duplicateFailures(DuplicateResults{Duplicate: 10}))
+
+	// Test case 2: every threshold which is exceeded fails
+	limits = thresholds{maxLossPercent: 0, maxDuplicates: 5, expectedObjects: 10, objectTolerance: defaultObjectCountTolerance}
+	assert.Equal(t, []string{
+		"Log loss of 0.50% in s3 exceeds the allowed 0%",
+		"10 duplicate records in s3 exceed the allowed 5",
+		"15 S3 objects in s3 deviate 50.0% from the expected 10, more than the allowed 10%",
+	}, limits.failures(result))
+	assert.Equal(t, []string{"10 duplicate records exceed the allowed 5"}, limits.duplicateFailures(DuplicateResults{Duplicate: 10}))
+}
+
+func TestSummaryLine(t *testing.T) {
+	results := []Results{{TotalInput: 5000000, Unique: 5000000, Duplicate: 1203, DelayP99Ms: 2400}}
+
+	// Test case 1: a single destination is labelled with DESTINATION
+	assert.Equal(t, "PASS s3 5000000/5000000 loss=0.00% dup=1203 p99=2.4s", summaryLine(true, "s3", results, nil))
+
+	// Test case 2: several destinations are separated by commas
+	results = []Results{
+		{Destination: "s3", TotalInput: 100, Unique: 100, DelayP99Ms: 500},
+		{Destination: "cloudwatch", TotalInput: 100, Unique: 90, PercentLoss: 10, Duplicate: 2, DelayP99Ms: 61000},
+	}
+	assert.Equal(t, "FAIL s3 100/100 loss=0.00% dup=0 p99=500ms, cloudwatch 90/100 loss=10.00% dup=2 p99=1m1s", summaryLine(false, "s3,cloudwatch", results, nil))
+
+	// Test case 3: duplicates only runs
+	assert.Equal(t, "PASS s3 unique=100 dup=3", summaryLine(true, "s3", nil, []DuplicateResults{{Unique: 100, Duplicate: 3}}))
+}
+
+func TestWriteSummaryLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "summary")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Test case 1: the line is written to the file
+	path := filepath.Join(dir, "summary.txt")
+	assert.NoError(t, writeSummaryLine(path, "PASS s3 1/1 loss=0.00% dup=0 p99=1s"))
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "PASS s3 1/1 loss=0.00% dup=0 p99=1s\n", string(content))
+
+	// Test case 2: a file which cannot be written fails
+	assert.Error(t, writeSummaryLine(filepath.Join(dir, "missing", "summary.txt"), "PASS"))
+}
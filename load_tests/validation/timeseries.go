@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Length of the windows of the time series
+const timeSeriesWindow = time.Second
+
+// Number of records produced in a window of producer time, and how many of them were delivered
+type TimeSeriesWindow struct {
+	Start     time.Time
+	Produced  int
+	Delivered int
+}
+
+// Producer timestamp of a record ID, used to estimate the timestamps of the records which were never found
+type producedPoint struct {
+	id       int
+	produced time.Time
+}
+
+// Buckets the input records by their producer timestamp into windows of the given length, in order of time.
+// Records which were never found have no known timestamp, so theirs is interpolated between the records
+// with the closest IDs which were found, as the producer sends the IDs in order.
+// Records whose timestamp can not be estimated, e.g. when no record has a timestamp, are left out.
+func timeSeries(recordMap *RecordMap, produced map[string]time.Time, window time.Duration) []TimeSeriesWindow {
+	points := make([]producedPoint, 0, len(produced))
+	for recordId, timestamp := range produced {
+		if id, err := strconv.Atoi(recordId); err == nil {
+			points = append(points, producedPoint{id: id, produced: timestamp})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].id < points[j].id })
+
+	windows := make(map[int64]*TimeSeriesWindow)
+	skipped := 0
+	recordMap.each(func(recordId string, occurrences int) {
+		timestamp, ok := produced[recordId]
+		if !ok {
+			timestamp, ok = estimateProduced(recordId, points)
+		}
+		if !ok {
+			skipped++
+			return
+		}
+
+		start := timestamp.Truncate(window)
+		w, ok := windows[start.UnixNano()]
+		if !ok {
+			w = &TimeSeriesWindow{Start: start}
+			windows[start.UnixNano()] = w
+		}
+		w.Produced++
+		if occurrences > 0 {
+			w.Delivered++
+		}
+	})
+	if skipped > 0 {
+		logrus.Warnf("Left %d records without a known or estimated producer timestamp out of the time series", skipped)
+	}
+
+	series := make([]TimeSeriesWindow, 0, len(windows))
+	for _, w := range windows {
+		series = append(series, *w)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Start.Before(series[j].Start) })
+	return series
+}
+
+// Interpolates the producer timestamp of a record ID between the closest IDs with a known timestamp.
+// Before the first or after the last known ID, the timestamp of that ID is used.
+func estimateProduced(recordId string, points []producedPoint) (time.Time, bool) {
+	id, err := strconv.Atoi(recordId)
+	if err != nil || len(points) == 0 {
+		return time.Time{}, false
+	}
+
+	i := sort.Search(len(points), func(i int) bool { return points[i].id >= id })
+	if i == 0 {
+		return points[0].produced, true
+	}
+	if i == len(points) {
+		return points[len(points)-1].produced, true
+	}
+	before, after := points[i-1], points[i]
+	span := after.produced.Sub(before.produced)
+	offset := time.Duration(float64(span) * float64(id-before.id) / float64(after.id-before.id))
+	return before.produced.Add(offset), true
+}
+
+// Writes the time series to a CSV file, with a line per window
+func writeTimeSeries(path string, series []TimeSeriesWindow) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if _, err := writer.WriteString("window_start,produced,delivered,missing\n"); err != nil {
+		return err
+	}
+	for _, w := range series {
+		line := fmt.Sprintf("%s,%d,%d,%d\n", w.Start.UTC().Format(arrivalLayout), w.Produced, w.Delivered, w.Produced-w.Delivered)
+		if _, err := writer.WriteString(line); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeSeries(t *testing.T) {
+	start := time.Unix(1639151827, 0)
+
+	// Test case 1: missing records are placed between the records with the closest IDs
+	recordMap := recordMapOf(map[string]int{"10000000": 1, "10000001": 0, "10000002": 2, "10000003": 0, "10000004": 1})
+	produced := map[string]time.Time{
+		"10000000": start,
+		"10000002": start.Add(1500 * time.Millisecond),
+		"10000004": start.Add(2500 * time.Millisecond),
+	}
+	assert.Equal(t, []TimeSeriesWindow{
+		{Start: start, Produced: 2, Delivered: 1},
+		{Start: start.Add(time.Second), Produced: 1, Delivered: 1},
+		{Start: start.Add(2 * time.Second), Produced: 2, Delivered: 1},
+	}, timeSeries(recordMap, produced, time.Second))
+
+	// Test case 2: missing records before the first or after the last known ID take its timestamp
+	recordMap = recordMapOf(map[string]int{"10000000": 0, "10000001": 1, "10000002": 0})
+	produced = map[string]time.Time{"10000001": start.Add(time.Second)}
+	assert.Equal(t, []TimeSeriesWindow{{Start: start.Add(time.Second), Produced: 3, Delivered: 1}}, timeSeries(recordMap, produced, time.Second))
+
+	// Test case 3: nothing can be estimated without a timestamp
+	assert.Empty(t, timeSeries(recordMapOf(map[string]int{"10000000": 0}), map[string]time.Time{}, time.Second))
+}
+
+func TestTimeSeriesFromS3(t *testing.T) {
+	client := &mockS3{
+		pages:   [][]string{{"a"}},
+		objects: map[string][]string{"a": producerLogs("10000000", "10000002")},
+	}
+	inputMap := newInputMap(3)
+	delays := &DelayStats{produced: make(map[string]time.Time)}
+	_, _, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, inputMap, &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       delays,
+	}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, delays.produced, 2)
+
+	series := timeSeries(inputMap, delays.produced, time.Hour)
+	produced, delivered := 0, 0
+	for _, w := range series {
+		produced += w.Produced
+		delivered += w.Delivered
+	}
+	assert.Equal(t, 3, produced)
+	assert.Equal(t, 2, delivered)
+}
+
+func TestWriteTimeSeries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timeseries")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "timeseries.csv")
+	start := time.Unix(1639151827, 0)
+	assert.NoError(t, writeTimeSeries(path, []TimeSeriesWindow{
+		{Start: start, Produced: 2, Delivered: 1},
+		{Start: start.Add(time.Second), Produced: 1, Delivered: 1},
+	}))
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "window_start,produced,delivered,missing\n2021-12-10T15:57:07.000Z,2,1,1\n2021-12-10T15:57:08.000Z,1,1,0\n", string(data))
+}
@@ -1,18 +1,33 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"math"
 	"os"
+	"os/signal"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -21,181 +36,1922 @@ const (
 	envCWLogGroup  = "CW_LOG_GROUP_NAME"
 	envLogPrefix   = "LOG_PREFIX"
 	envDestination = "DESTINATION"
+	envWorkerCount = "WORKER_COUNT"
+	envKinesisName = "KINESIS_STREAM_NAME"
+	envOSEndpoint  = "OPENSEARCH_ENDPOINT"
+	envOSIndex     = "OPENSEARCH_INDEX"
+	envOutput      = "OUTPUT_FORMAT"
+	envMaxLoss     = "MAX_ALLOWED_LOSS_PERCENT"
+	envMaxDup      = "MAX_ALLOWED_DUPLICATES"
+	envIdLength    = "RECORD_ID_LENGTH"
+	envIdRegex     = "RECORD_ID_REGEX"
+	envRunTimeout  = "RUN_TIMEOUT"
+	envCWStreams   = "CW_LOG_STREAM_NAMES"
+	envCWPrefix    = "CW_LOG_STREAM_PREFIX"
+	envCWMode      = "CW_VALIDATION_MODE"
+	envCheckOrder  = "CHECK_ORDERING"
+	envMissingFile = "MISSING_RECORDS_FILE"
+	envTimeSeries  = "TIMESERIES_FILE"
+	envS3Retries   = "S3_MAX_RETRIES"
+	envLogLevel    = "LOG_LEVEL"
+	envProgress    = "SHOW_PROGRESS"
+	envEstimate    = "ESTIMATE_ONLY"
+	envRoleArn     = "ASSUME_ROLE_ARN"
+	envRoleSession = "ASSUME_ROLE_SESSION_NAME"
+	envEndpointUrl = "AWS_ENDPOINT_URL"
+	envCABundle    = "CA_BUNDLE_FILE"
+	envStrictParse = "STRICT_PARSE"
+	envLogFormat   = "LOG_RECORD_FORMAT"
+	envLogField    = "LOG_FIELD_NAME"
+	envLogPath     = "LOG_FIELD_PATH"
+	envStartTime   = "START_TIME"
+	envEndTime     = "END_TIME"
+	envS3Mode      = "S3_VALIDATION_MODE"
+	envDelimiter   = "RECORD_DELIMITER"
+	envDiscover    = "DISCOVER_PREFIXES"
+	envCombine     = "COMBINE_DESTINATIONS"
+	envCheckpoint  = "CHECKPOINT_FILE"
+	envExpectObjs  = "EXPECTED_OBJECT_COUNT"
+	envObjTolerate = "OBJECT_COUNT_TOLERANCE"
+	envFHLayout    = "FIREHOSE_PARTITION_LAYOUT"
+	envFHEncoding  = "FIREHOSE_RECORD_ENCODING"
+	envFHKeys      = "FIREHOSE_PARTITION_KEYS"
+	envDynamoTable = "DYNAMO_TABLE_NAME"
+	envDynamoAttr  = "DYNAMO_ID_ATTRIBUTE"
+	envSQSQueueUrl = "SQS_QUEUE_URL"
+	envSQSPeek     = "SQS_PEEK_TIMEOUT"
+	envQueryURL    = "VALIDATION_QUERY_URL"
+	envQueryToken  = "VALIDATION_QUERY_TOKEN"
+	envMetricsFile = "METRICS_FILE"
+	envCWRateLimit = "CW_RATE_LIMIT"
+	envS3PageSize  = "S3_PAGE_SIZE"
+	envCWLimit     = "CW_LIMIT"
+	envSampleRate  = "SAMPLE_RATE"
+	envErrorBucket = "ERROR_S3_BUCKET"
+	envErrorPrefix = "ERROR_S3_PREFIX"
+	envAuditFile   = "AUDIT_FILE"
+	envS3Region    = "S3_REGION"
+	envCWRegion    = "CW_REGION"
+	envPollPeriod  = "POLL_INTERVAL"
+	envPollTimeout = "POLL_TIMEOUT"
+	envExpectedIds = "EXPECTED_IDS_FILE"
+	envFailFast    = "FAIL_FAST"
+	envMode        = "VALIDATION_MODE"
+	envSkipPreflt  = "SKIP_PREFLIGHT"
+	envVerifyPayld = "VERIFY_PAYLOAD"
+	envS3Versions  = "USE_VERSIONS"
+	envS3Order     = "S3_OBJECT_ORDER"
+	envIcebergMeta = "ICEBERG_METADATA_LOCATION"
+	envResultMap   = "RESULT_MAP_FILE"
+	envExpectedLen = "EXPECTED_LENGTH"
+	envLocalDir    = "LOCAL_DIR"
+	envConcurrent  = "CONCURRENT_DESTINATIONS"
+	envInitialWait = "INITIAL_WAIT"
+	envSkipCorrupt = "SKIP_CORRUPT_OBJECTS"
+	envSummary     = "SUMMARY_LINE"
+	envDelaySample = "DELAY_SAMPLE_SIZE"
 	idCounterBase  = 10000000
+
+	defaultWorkerCount = 10
+	// Allowed deviation of the number of S3 objects from the expected count, in percent
+	defaultObjectCountTolerance = 10.0
+	// Records parsed by a S3 worker before they are applied to the shared results
+	s3BatchSize = 1000
+	// Most keys returned by a single ListObjectsV2 call
+	s3MaxPageSize = 1000
+	// Most events returned by a single GetLogEvents call
+	cwMaxLimit = 10000
+
+	// Exit code when the run timed out, distinct from the exit code 1 of failed runs
+	exitCodeTimeout = 2
+	// Exit code when the run was interrupted by a signal, as reported by shells for SIGINT
+	exitCodeInterrupted = 130
+	// Log delay passed by the load test when the producer does not report its run time
+	logDelayNotSupported = "not supported"
+	// Most characters of a bar of the delay histogram in the text output
+	histogramWidth = 40
+	// RFC 3339 with milliseconds, the precision of the destination timestamps
+	arrivalLayout = "2006-01-02T15:04:05.000Z07:00"
 )
 
-type Message struct {
-	Log string
+// Pause before every GetLogEvents call, a variable so that tests do not have to wait
+var cwRequestPeriod = 1 * time.Second
+
+// Benchmark results of a validation run, printed by get_results
+type Results struct {
+	// Only set when several destinations are validated
+	Destination      string `json:"destination,omitempty"`
+	TotalInput       int    `json:"total_input"`
+	TotalDestination int    `json:"total_destination"`
+	Unique           int    `json:"unique"`
+	Duplicate        int    `json:"duplicate"`
+	Delay            string `json:"delay"`
+	DelaySamples     int    `json:"delay_samples"`
+	DelayMinMs       int64  `json:"delay_min_ms"`
+	DelayAvgMs       int64  `json:"delay_avg_ms"`
+	DelayP50Ms       int64  `json:"delay_p50_ms"`
+	DelayP90Ms       int64  `json:"delay_p90_ms"`
+	DelayP99Ms       int64  `json:"delay_p99_ms"`
+	DelayMaxMs       int64  `json:"delay_max_ms"`
+	// Only set when DELAY_SAMPLE_SIZE is, and more records were found, the percentiles and the jitter are then estimated from a sample
+	DelaySampled bool    `json:"delay_sampled,omitempty"`
+	PercentLoss  float64 `json:"percent_loss"`
+	Missing      int     `json:"missing"`
+	// Number of input records found exactly once, twice or more often, and the most occurrences of a single record
+	DeliveredOnce      int `json:"delivered_once"`
+	DeliveredTwice     int `json:"delivered_twice"`
+	DeliveredThreePlus int `json:"delivered_3_plus"`
+	MaxDeliveries      int `json:"max_deliveries"`
+	// Logs found in the destination without a record ID, e.g. truncated lines
+	Unparseable int `json:"unparseable"`
+	// Lines found in the destination which are not JSON log entries, e.g. trailer metadata
+	Malformed int `json:"malformed"`
+	// Records found in the destination with an ID which is not one of the input records, not counted as found
+	Foreign int `json:"foreign"`
+	// Records found per second of the span between the earliest and latest producer timestamps
+	ThroughputSpanMs     int64   `json:"throughput_span_ms"`
+	ThroughputRecordsSec float64 `json:"throughput_records_per_sec"`
+	// Retries of throttled or failed API calls and the time slept in backoff before them
+	Retries        int   `json:"retries"`
+	RetryBackoffMs int64 `json:"retry_backoff_ms"`
+	// Standard deviation of the time between the arrivals of consecutive records in producer order
+	DelayJitterMs float64 `json:"delay_jitter_ms"`
+	// Number of records per range of delivery delays
+	DelayHistogram []DelayBucket `json:"delay_histogram"`
+	// Records which arrived before their producer timestamp, and how early they arrived, left out of the delays
+	ClockSkewRecords int   `json:"clock_skew_records"`
+	ClockSkewAvgMs   int64 `json:"clock_skew_avg_ms"`
+	ClockSkewMaxMs   int64 `json:"clock_skew_max_ms"`
+	// Time the first and the last record arrived in the destination, empty if no arrival time is known
+	FirstArrival string `json:"first_arrival,omitempty"`
+	LastArrival  string `json:"last_arrival,omitempty"`
+	// Only set when the ordering check is enabled
+	OutOfOrder *int `json:"out_of_order,omitempty"`
+	// Only set when records were found out of order, number of them in each log stream or shard with any
+	OutOfOrderStreams []StreamOrder `json:"out_of_order_streams,omitempty"`
+	// Only set for S3 and Firehose, number of objects validated
+	S3Objects *int `json:"s3_objects,omitempty"`
+	// Only set when corrupt objects are skipped and any were found, locations of the compressed objects with a corrupt gzip stream
+	S3CorruptObjects *int     `json:"s3_corrupt_objects,omitempty"`
+	S3CorruptKeys    []string `json:"s3_corrupt_keys,omitempty"`
+	// Only set for S3 and Firehose, total and average stored size of the objects validated
+	S3Bytes          *int64 `json:"s3_bytes,omitempty"`
+	S3AvgObjectBytes *int64 `json:"s3_avg_object_bytes,omitempty"`
+	// Only set for S3 and Firehose read with GetObject, number of objects compressed with gzip and not compressed
+	S3GzipObjects  *int `json:"s3_gzip_objects,omitempty"`
+	S3PlainObjects *int `json:"s3_plain_objects,omitempty"`
+	// Only set for S3 and Firehose, fewest, most and average records found per object and the objects per range of records
+	S3ObjectRecordsMin       *int                 `json:"s3_object_records_min,omitempty"`
+	S3ObjectRecordsMax       *int                 `json:"s3_object_records_max,omitempty"`
+	S3ObjectRecordsAvg       *float64             `json:"s3_object_records_avg,omitempty"`
+	S3ObjectRecordsHistogram []ObjectRecordBucket `json:"s3_object_records_histogram,omitempty"`
+	// Only set when several buckets are validated, number of objects validated in each of them
+	S3Buckets []BucketObjects `json:"s3_buckets,omitempty"`
+	// Only set when the object versions are validated, records found in every version of the keys with several of them
+	S3Versions []ObjectVersionRecords `json:"s3_versions,omitempty"`
+	// Only set when several log groups are validated, number of records found in each of them
+	CWLogGroups []LogGroupRecords `json:"cw_log_groups,omitempty"`
+	// Content read per stored byte, above 1 for compressed objects. Only set when the content size is known
+	S3CompressionRatio *float64 `json:"s3_compression_ratio,omitempty"`
+	// Only set when a sample of the records is validated, the counts of the input records are then extrapolated from it
+	SampleRate float64 `json:"sample_rate,omitempty"`
+	// Only set when the error output of the destination is validated, number of input records found there
+	ErrorDestination *int `json:"error_destination,omitempty"`
+	// Only set when the payloads or their length are verified, logs delivered cut short or otherwise different from the payload sent
+	PayloadTruncated *int `json:"payload_truncated,omitempty"`
+	PayloadCorrupted *int `json:"payload_corrupted,omitempty"`
+	// Only set when polling and every input record was found, time from the start of the first pass until then
+	CompletionMs *int64 `json:"completion_ms,omitempty"`
+	// Only set when the run timed out or was interrupted before every record was read
+	Partial bool `json:"partial,omitempty"`
+	// Only set when the caller identity was checked, AWS account and region the destination was validated in
+	Account string `json:"account,omitempty"`
+	Region  string `json:"region,omitempty"`
 }
 
 func main() {
-	region := os.Getenv(envAWSRegion)
-	if region == "" {
+	configPath := flag.String("config", "", "Path to a YAML or JSON file with the environment variables to use, the environment takes precedence")
+	totalRecordsFlag := flag.Int("total-records", 0, "Number of records sent by the producer")
+	logDelayFlag := flag.String("log-delay", "", "Delay between the logs sent by the producer, reported as is")
+	baselinePath := flag.String("compare-baseline", "", "Results of a baseline run saved with the JSON output format, compared to --compare-candidate instead of validating")
+	candidatePath := flag.String("compare-candidate", "", "Results of a candidate run saved with the JSON output format, compared to --compare-baseline instead of validating")
+	regressionTolerance := flag.Float64("regression-tolerance", defaultRegressionTolerance, "Allowed increase in percent of any compared metric over the baseline")
+	flag.Parse()
+
+	// Diagnostics go to stderr, stdout is reserved for the results
+	logrus.SetOutput(os.Stderr)
+	logrus.SetLevel(logrus.InfoLevel)
+
+	config := loadConfigFile(*configPath)
+	outputFormat, summaryPath := parseOutput()
+
+	// Comparing the results of two earlier runs does not need any destination
+	if *baselinePath != "" || *candidatePath != "" {
+		compareRuns(*baselinePath, *candidatePath, *regressionTolerance, outputFormat)
+		return
+	}
+
+	r := &runSettings{summaryPath: summaryPath}
+	r.outputFormat = outputFormat
+	r.parseDestinations()
+	r.parseInputRecords(config, *totalRecordsFlag)
+	r.parseRecordParser()
+	r.parseSampling()
+	r.parseLogDelay(config, *logDelayFlag)
+	r.parseThresholds()
+	r.parseLimits()
+	r.parseOptions()
+
+	ctx, cancel, interruptedBy := r.runContext()
+	defer cancel()
+
+	identities := r.preflight(ctx)
+	// Waited after the preflight checks, so that a misconfigured run fails right away. The wait counts against the run timeout.
+	waitInitially(ctx, r.initialWait)
+
+	destinationResults := r.validateAll(ctx)
+	if len(destinationResults) == 0 {
+		return
+	}
+	results, duplicateResults := r.report(ctx, destinationResults, identities)
+	r.finish(ctx, results, duplicateResults, interruptedBy())
+}
+
+// Settings of a validation run, parsed from the flags, the config file and the environment variables
+type runSettings struct {
+	// Shared by every destination, each of them is validated with a copy holding its own prefix, parser and counters
+	validatorSettings
+	// DESTINATION may be a comma separated list to validate a pipeline writing to several destinations
+	destinations []string
+	// Local directories are read without any AWS call, the AWS settings are only required by the other destinations
+	offline bool
+	// The results of several destinations are reported separately unless they are combined
+	combineMode string
+	concurrent  bool
+	// Only set when the IDs sent by the producer are read from a file
+	expectedIds []string
+	// Smallest ID of the producer, which counts the IDs up from it
+	idBase     int
+	sampleRate float64
+	// Occurrences of each input record, copied for every additional destination
+	inputMap *RecordMap
+	logDelay string
+	// Fail the run when the results of any destination are outside of the allowed thresholds
+	limits thresholds
+	// No deadline unless set
+	runTimeout    time.Duration
+	checkOrdering bool
+	// Polling is disabled unless pollInterval is set
+	pollInterval time.Duration
+	pollTimeout  time.Duration
+	initialWait  time.Duration
+	// Reading a destination stops once every record was found, and the run once the loss of a destination is too high
+	stopWhenFound bool
+	summaryPath   string
+}
+
+// Applies the config file to the environment and sets the log level, returns the settings of the config file
+func loadConfigFile(path string) map[string]string {
+	// The config file is applied first so that every setting below can come from it
+	config := make(map[string]string)
+	var overridden []string
+	if path != "" {
+		var err error
+		config, err = loadConfig(path)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to load the config file. Error: %v", err)
+		}
+		overridden, err = applyConfig(config)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to apply the config file. Error: %v", err)
+		}
+	}
+
+	if value := os.Getenv(envLogLevel); value != "" {
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid log level %q. Set \"debug\", \"info\", \"warn\" or \"error\" for environment variable- %s", value, envLogLevel)
+		}
+		logrus.SetLevel(level)
+	}
+	if len(overridden) > 0 {
+		logrus.Infof("Environment variables %s take precedence over config file %q", strings.Join(overridden, ", "), path)
+	}
+	return config
+}
+
+// Returns the output format of the results, and where the summary line goes if anywhere
+func parseOutput() (string, string) {
+	outputFormat := os.Getenv(envOutput)
+	if outputFormat == "" {
+		outputFormat = "text"
+	} else if outputFormat != "text" && outputFormat != "json" {
+		exitErrorf("[TEST FAILURE] Invalid output format %q. Set \"text\" or \"json\" for environment variable- %s", outputFormat, envOutput)
+	}
+	// The summary line would break the JSON output on stdout
+	summaryPath := os.Getenv(envSummary)
+	if summaryPath == summaryStdout && outputFormat == "json" {
+		exitErrorf("[TEST FAILURE] Summary line cannot be printed with the JSON output. Set a file path for environment variable- %s", envSummary)
+	}
+	return outputFormat, summaryPath
+}
+
+// Compares the results of two earlier runs, exits if any metric of the candidate regressed
+func compareRuns(baselinePath string, candidatePath string, tolerance float64, outputFormat string) {
+	if baselinePath == "" || candidatePath == "" {
+		exitErrorf("[TEST FAILURE] Both results to compare required. Set the --compare-baseline and --compare-candidate flags")
+	}
+	baseline, err := readResults(baselinePath)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to read the baseline results: %v", err)
+	}
+	candidate, err := readResults(candidatePath)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to read the candidate results: %v", err)
+	}
+	comparisons, err := compareResults(baseline, candidate, tolerance)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] %v", err)
+	}
+	print_comparisons(comparisons, outputFormat)
+
+	for _, comparison := range comparisons {
+		if comparison.Regressed {
+			exitErrorf("[TEST FAILURE] %s regressed from %v to %v, more than the allowed %v%%", comparison.Metric, comparison.Baseline, comparison.Candidate, tolerance)
+		}
+	}
+}
+
+// Parses the destinations and where they are located
+func (r *runSettings) parseDestinations() {
+	destination := os.Getenv(envDestination)
+	if destination == "" {
+		exitErrorf("[TEST FAILURE] Log destination for validation required. Set the value for environment variable- %s", envDestination)
+	}
+	r.destinations = splitList(destination)
+	for _, destination := range r.destinations {
+		if _, ok := validators[destination]; !ok {
+			exitErrorf("[TEST FAILURE] Invalid log destination %q. Set %s for environment variable- %s", destination, validatorNames(), envDestination)
+		}
+	}
+	r.offline = true
+	for _, destination := range r.destinations {
+		if destination != "localdir" {
+			r.offline = false
+		}
+	}
+
+	r.region, r.s3Region, r.cwRegion = getRegions()
+	if r.region == "" && !r.offline {
 		exitErrorf("[TEST FAILURE] AWS Region required. Set the value for environment variable- %s", envAWSRegion)
 	}
 
-	bucket := os.Getenv(envS3Bucket)
-	if bucket == "" {
+	// The S3 destination may be a comma separated list of buckets, e.g. for a fan out test. Every other use takes a single one
+	r.buckets = splitList(os.Getenv(envS3Bucket))
+	if len(r.buckets) == 0 && !r.offline {
 		exitErrorf("[TEST FAILURE] Bucket name required. Set the value for environment variable- %s", envS3Bucket)
 	}
 
-	logGroup := os.Getenv(envCWLogGroup)
-	if logGroup == "" {
+	// The CloudWatch destination may be a comma separated list of log groups, e.g. when tags are routed to several of them
+	r.logGroups = splitList(os.Getenv(envCWLogGroup))
+	if len(r.logGroups) == 0 && !r.offline {
 		exitErrorf("[TEST FAILURE] Log group name required. Set the value for environment variable- %s", envCWLogGroup)
 	}
 
-	prefix := os.Getenv(envLogPrefix)
-	if prefix == "" {
-		exitErrorf("[TEST FAILURE] Object prefix required. Set the value for environment variable- %s", envLogPrefix)
+	r.combineMode = os.Getenv(envCombine)
+	if r.combineMode != "" && r.combineMode != combineAny && r.combineMode != combineAll {
+		exitErrorf("[TEST FAILURE] Invalid destination combination %q. Set \"any\" or \"all\" for environment variable- %s", r.combineMode, envCombine)
+	}
+	// Several destinations are validated at the same time on request, e.g. a fan-out in which every destination receives every record
+	if value := os.Getenv(envConcurrent); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid concurrent destinations setting %q. Set \"true\" or \"false\" for environment variable- %s", value, envConcurrent)
+		}
+		r.concurrent = enabled && len(r.destinations) > 1
+	}
+
+	// With prefix discovery, LOG_PREFIX is optional and holds the parents of the discovered prefixes
+	r.discoverMode = os.Getenv(envDiscover)
+}
+
+// Parses the number of records sent by the producer, or the IDs it sent
+func (r *runSettings) parseInputRecords(config map[string]string, totalRecordsFlag int) {
+	// The named flags take precedence over the positional arguments, which take precedence over the config file
+	if flag.NArg() > 0 {
+		logrus.Warnf("Positional arguments are deprecated and will be removed in the next release. Use the --total-records and --log-delay flags instead")
+	}
+
+	// The IDs sent by the producer are read from a file on request, e.g. for producers whose IDs are not sequential
+	if path := os.Getenv(envExpectedIds); path != "" {
+		var err error
+		r.expectedIds, err = readExpectedIds(path)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to read the expected record IDs from %s: %v", path, err)
+		}
+		if len(r.expectedIds) == 0 {
+			exitErrorf("[TEST FAILURE] No record IDs found in %s. Set a file with one ID per line for environment variable- %s", path, envExpectedIds)
+		}
+	}
+
+	r.totalInputRecord = totalRecordsFlag
+	if r.expectedIds != nil {
+		if isFlagSet(flag.CommandLine, "total-records") && r.totalInputRecord != len(r.expectedIds) {
+			logrus.Warnf("Ignoring the total of %d records, %s holds %d record IDs", r.totalInputRecord, envExpectedIds, len(r.expectedIds))
+		}
+		r.totalInputRecord = len(r.expectedIds)
+	} else if !isFlagSet(flag.CommandLine, "total-records") {
+		inputRecord := positionalArg(flag.Args(), 0, config, configTotalRecords)
+		if inputRecord == "" {
+			exitErrorf("[TEST FAILURE] Total input record number required. Set the --total-records flag, %s in the config file or the environment variable- %s", configTotalRecords, envExpectedIds)
+		}
+		var err error
+		r.totalInputRecord, err = strconv.Atoi(inputRecord)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid total input record number %q. Set an integer for the --total-records flag or %s in the config file", inputRecord, configTotalRecords)
+		}
+	}
+	// The loss is a percentage of the input records
+	if r.totalInputRecord <= 0 {
+		exitErrorf("[TEST FAILURE] Invalid total input record number %d. Set a positive value for the --total-records flag", r.totalInputRecord)
+	}
+}
+
+// Parses how the record IDs are found in the logs and which of them are input records
+func (r *runSettings) parseRecordParser() {
+	recordIdLength := defaultRecordIdLength
+	if value := os.Getenv(envIdLength); value != "" {
+		length, err := strconv.Atoi(value)
+		// IDs longer than 18 digits would overflow the counter
+		if err != nil || length < 1 || length > 18 {
+			exitErrorf("[TEST FAILURE] Invalid record ID length %q. Set an integer between 1 and 18 for environment variable- %s", value, envIdLength)
+		}
+		recordIdLength = length
+	}
+	parser := newRecordIdParser(recordIdLength)
+
+	// Compiled once up front instead of for every record
+	if value := os.Getenv(envIdRegex); value != "" {
+		regex, err := regexp.Compile(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid record ID expression %q for environment variable- %s: %v", value, envIdRegex, err)
+		}
+		parser, err = newRegexRecordIdParser(regex)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid record ID expression for environment variable- %s: %v", envIdRegex, err)
+		}
+	}
+	r.parser = parser
+
+	// Lines which are not JSON log entries are skipped and counted unless parsing is strict
+	if value := os.Getenv(envStrictParse); value != "" {
+		strict, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid strict parse setting %q. Set \"true\" or \"false\" for environment variable- %s", value, envStrictParse)
+		}
+		parser.strict = strict
+	}
+	// A compressed object which fails to decompress fails the run unless it is skipped, which tells corrupt objects apart from lost records.
+	// The Parquet data files of a table are not compressed with gzip, so none of them is skipped.
+	if value := os.Getenv(envSkipCorrupt); value != "" {
+		skip, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid corrupt objects setting %q. Set \"true\" or \"false\" for environment variable- %s", value, envSkipCorrupt)
+		}
+		for _, destination := range r.destinations {
+			if skip && destination != "s3" && destination != "firehose" && destination != "localdir" {
+				exitErrorf("[TEST FAILURE] Skipping corrupt objects is not supported for destination %q. Unset the environment variable- %s", destination, envSkipCorrupt)
+			}
+		}
+		parser.skipCorrupt = skip
+	}
+
+	// Records are JSON log entries unless the destination receives the raw log lines, or converts the records to Parquet
+	switch format := os.Getenv(envLogFormat); format {
+	case "", "json":
+	case "raw":
+		parser.raw = true
+	case "parquet":
+		for _, destination := range r.destinations {
+			if destination != "s3" && destination != "firehose" && destination != "s3tables" && destination != "localdir" {
+				exitErrorf("[TEST FAILURE] Parquet records are not supported for destination %q. Unset the environment variable- %s", destination, envLogFormat)
+			}
+		}
+		parser.parquet = true
+	default:
+		exitErrorf("[TEST FAILURE] Invalid log record format %q. Set \"json\", \"raw\" or \"parquet\" for environment variable- %s", format, envLogFormat)
+	}
+	parser.field = os.Getenv(envLogField)
+	// The log may be nested in the JSON log entries, e.g. {"data":{"log":"..."}} after a transformation, given as "data.log"
+	if value := os.Getenv(envLogPath); value != "" {
+		if parser.field != "" {
+			exitErrorf("[TEST FAILURE] Log field name and path are exclusive. Unset one of the environment variables- %s, %s", envLogField, envLogPath)
+		}
+		parser.path = strings.Split(value, ".")
+		for _, name := range parser.path {
+			if name == "" {
+				exitErrorf("[TEST FAILURE] Invalid log field path %q. Set dot separated field names for environment variable- %s", value, envLogPath)
+			}
+		}
+	}
+
+	// Records are newline delimited unless the destination concatenates them, e.g. Firehose without the appended newline
+	switch value := os.Getenv(envDelimiter); value {
+	case "", "\n", "\\n":
+	case recordDelimiterJSON:
+		if parser.raw {
+			exitErrorf("[TEST FAILURE] Concatenated records require JSON log records. Unset the environment variable- %s", envLogFormat)
+		}
+		parser.concatenated = true
+	default:
+		// Escape sequences such as \r\n or \x1e are interpreted
+		delimiter, err := strconv.Unquote("\"" + value + "\"")
+		if err != nil || delimiter == "" {
+			exitErrorf("[TEST FAILURE] Invalid record delimiter %q. Set a string, optionally with escape sequences, or %q for environment variable- %s", value, recordDelimiterJSON, envDelimiter)
+		}
+		parser.delimiter = delimiter
+	}
+	if parser.parquet && (parser.concatenated || parser.delimiter != "") {
+		exitErrorf("[TEST FAILURE] Parquet records are read by row, not by delimiter. Unset the environment variable- %s", envDelimiter)
+	}
+
+	// The producer counts IDs up from the smallest number with the configured amount of digits,
+	// which is idCounterBase for the default 8 character IDs
+	r.idBase = 1
+	for i := 1; i < recordIdLength; i++ {
+		r.idBase *= 10
+	}
+	// The expected IDs file holds the full logs sent by the producer on request, the delivered logs are compared to them
+	if value := os.Getenv(envVerifyPayld); value != "" {
+		verify, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid payload verification setting %q. Set \"true\" or \"false\" for environment variable- %s", value, envVerifyPayld)
+		}
+		if verify {
+			if r.expectedIds == nil {
+				exitErrorf("[TEST FAILURE] Payload verification requires the expected payloads. Set a file with one log per line for environment variable- %s", envExpectedIds)
+			}
+			// The counts of truncated and corrupted logs are not saved with the checkpoint
+			if os.Getenv(envCheckpoint) != "" {
+				exitErrorf("[TEST FAILURE] Checkpoints are not supported with payload verification. Unset the environment variable- %s", envCheckpoint)
+			}
+			r.expectedIds, parser.payloads, err = expectedPayloads(r.expectedIds, parser)
+			if err != nil {
+				exitErrorf("[TEST FAILURE] Invalid expected payloads in %s for environment variable- %s: %v", os.Getenv(envExpectedIds), envVerifyPayld, err)
+			}
+			r.totalInputRecord = len(r.expectedIds)
+		}
+	}
+	// Producers sending logs of a fixed size, e.g. a RandomString of a given length, need no payloads to tell truncated logs apart
+	if value := os.Getenv(envExpectedLen); value != "" {
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 1 {
+			exitErrorf("[TEST FAILURE] Invalid expected log length %q. Set a positive integer for environment variable- %s", value, envExpectedLen)
+		}
+		if parser.payloads != nil {
+			exitErrorf("[TEST FAILURE] The expected payloads are verified including their length. Unset the environment variable- %s", envExpectedLen)
+		}
+		// The counts of truncated and corrupted logs are not saved with the checkpoint
+		if os.Getenv(envCheckpoint) != "" {
+			exitErrorf("[TEST FAILURE] Checkpoints are not supported with the expected log length. Unset the environment variable- %s", envCheckpoint)
+		}
+		parser.expectedLength = length
+	}
+
+	// Records outside of the IDs of this run are foreign, e.g. left over from other tests sharing the destination
+	if r.expectedIds != nil {
+		parser.expectedIds = make(map[string]bool, len(r.expectedIds))
+		for _, recordId := range r.expectedIds {
+			parser.expectedIds[recordId] = true
+		}
+	} else {
+		parser.minId = r.idBase
+		parser.maxId = r.idBase + r.totalInputRecord
+	}
+
+	// Only the duplicates are validated on request, without a map entry per input record up front to save memory.
+	// Every option relying on the input records is rejected, as records which were never found are not known.
+	switch mode := os.Getenv(envMode); mode {
+	case "", "full":
+	case "duplicates-only":
+		parser.duplicatesOnly = true
+		for _, name := range []string{envSampleRate, envCheckpoint, envFailFast, envCombine, envPollPeriod, envMissingFile, envResultMap, envTimeSeries, envErrorBucket, envMetricsFile} {
+			if os.Getenv(name) != "" {
+				exitErrorf("[TEST FAILURE] Only validating duplicates does not track the input records. Unset the environment variable- %s", name)
+			}
+		}
+	default:
+		exitErrorf("[TEST FAILURE] Invalid validation mode %q. Set \"full\" or \"duplicates-only\" for environment variable- %s", mode, envMode)
+	}
+}
+
+// Parses which input records are tracked and creates the map counting their occurrences
+func (r *runSettings) parseSampling() {
+	// Only a sample of the input records is tracked on request, for a quick check of huge runs
+	r.sampleRate = 1.0
+	if value := os.Getenv(envSampleRate); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			exitErrorf("[TEST FAILURE] Invalid sample rate %q. Set a number greater than 0 and at most 1 for environment variable- %s", value, envSampleRate)
+		}
+		r.sampleRate = rate
+	}
+
+	// Number of objects, log streams or sampled input records processed concurrently
+	r.workerCount = defaultWorkerCount
+	if value := os.Getenv(envWorkerCount); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 1 {
+			exitErrorf("[TEST FAILURE] Invalid worker count %q. Set a positive integer for environment variable- %s", value, envWorkerCount)
+		}
+		r.workerCount = count
+	}
+
+	// Map for counting the occurrences of each input record in corresponding destination.
+	// The sequential IDs of the producer are counted by their position, only other IDs need a key per record.
+	var sampled func(recordId string) bool
+	if r.sampleRate < 1 {
+		sampled = func(recordId string) bool { return isSampled(recordId, r.sampleRate) }
+	}
+	switch {
+	case r.parser.duplicatesOnly:
+		r.inputMap = newKeyedRecordMap(nil)
+	case r.expectedIds != nil:
+		sampledIds := r.expectedIds
+		if sampled != nil {
+			sampledIds = nil
+			for _, recordId := range r.expectedIds {
+				if sampled(recordId) {
+					sampledIds = append(sampledIds, recordId)
+				}
+			}
+		}
+		r.inputMap = newKeyedRecordMap(sampledIds)
+	default:
+		r.inputMap = newSequentialRecordMap(r.idBase, r.totalInputRecord, sampled, r.workerCount)
+	}
+	if r.sampleRate < 1 {
+		if r.inputMap.len() == 0 {
+			exitErrorf("[TEST FAILURE] No records sampled out of %d at sample rate %v. Set a higher value for environment variable- %s", r.totalInputRecord, r.sampleRate, envSampleRate)
+		}
+		logrus.Infof("Validating a sample of %d out of %d records", r.inputMap.len(), r.totalInputRecord)
+	}
+}
+
+// Parses the delay between the logs sent by the producer, which is reported as is
+func (r *runSettings) parseLogDelay(config map[string]string, logDelayFlag string) {
+	r.logDelay = logDelayFlag
+	if r.logDelay == "" {
+		r.logDelay = positionalArg(flag.Args(), 1, config, configLogDelay)
+	}
+	if r.logDelay == "" {
+		exitErrorf("[TEST FAILURE] Log delay required. Set the --log-delay flag or %s in the config file", configLogDelay)
+	}
+	if !isValidLogDelay(r.logDelay) {
+		exitErrorf("[TEST FAILURE] Invalid log delay %q. Set a duration (e.g. \"01m30s\"), a number or %q for the --log-delay flag", r.logDelay, logDelayNotSupported)
+	}
+}
+
+// Parses the allowed results of the run
+func (r *runSettings) parseThresholds() {
+	r.limits = thresholds{maxLossPercent: 0, maxDuplicates: -1, expectedObjects: -1, objectTolerance: defaultObjectCountTolerance}
+	if value := os.Getenv(envMaxLoss); value != "" {
+		percent, err := strconv.ParseFloat(value, 64)
+		if err != nil || percent < 0 {
+			exitErrorf("[TEST FAILURE] Invalid max allowed loss %q. Set a non-negative percentage for environment variable- %s", value, envMaxLoss)
+		}
+		r.limits.maxLossPercent = percent
+	}
+
+	// A negative value means duplicates are not checked
+	if value := os.Getenv(envMaxDup); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			exitErrorf("[TEST FAILURE] Invalid max allowed duplicates %q. Set a non-negative integer for environment variable- %s", value, envMaxDup)
+		}
+		r.limits.maxDuplicates = count
+	}
+
+	// A negative value means the number of S3 objects is not checked
+	if value := os.Getenv(envExpectObjs); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			exitErrorf("[TEST FAILURE] Invalid expected object count %q. Set a non-negative integer for environment variable- %s", value, envExpectObjs)
+		}
+		r.limits.expectedObjects = count
+	}
+
+	if value := os.Getenv(envObjTolerate); value != "" {
+		percent, err := strconv.ParseFloat(value, 64)
+		if err != nil || percent < 0 {
+			exitErrorf("[TEST FAILURE] Invalid object count tolerance %q. Set a non-negative percentage for environment variable- %s", value, envObjTolerate)
+		}
+		r.limits.objectTolerance = percent
+	}
+}
+
+// Parses the limits of the API calls and the run
+func (r *runSettings) parseLimits() {
+	// GetLogEvents calls are only limited on request, shared by all the log streams so that parallel validators can
+	// split the account limit between them. A nil limiter does not limit anything.
+	if value := os.Getenv(envCWRateLimit); value != "" {
+		limit, err := strconv.ParseFloat(value, 64)
+		if err != nil || limit <= 0 {
+			exitErrorf("[TEST FAILURE] Invalid CloudWatch rate limit %q. Set a positive number of requests per second for environment variable- %s", value, envCWRateLimit)
+		}
+		r.cwLimiter = rate.NewLimiter(rate.Limit(limit), 1)
+	}
+
+	// Zero leaves the page sizes to the APIs, which return as much as they allow
+	if value := os.Getenv(envS3PageSize); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 1 || size > s3MaxPageSize {
+			exitErrorf("[TEST FAILURE] Invalid S3 page size %q. Set an integer between 1 and %d for environment variable- %s", value, s3MaxPageSize, envS3PageSize)
+		}
+		r.s3PageSize = size
+	}
+	if value := os.Getenv(envCWLimit); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > cwMaxLimit {
+			exitErrorf("[TEST FAILURE] Invalid CloudWatch limit %q. Set an integer between 1 and %d for environment variable- %s", value, cwMaxLimit, envCWLimit)
+		}
+		r.cwLimit = limit
+	}
+
+	// The delays and arrivals of every record are kept unless a sample size is set, for huge runs which would not fit in memory
+	if value := os.Getenv(envDelaySample); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 3 {
+			exitErrorf("[TEST FAILURE] Invalid delay sample size %q. Set an integer of at least 3 for environment variable- %s", value, envDelaySample)
+		}
+		delaySampleSize = size
+	}
+
+	r.s3MaxRetries = retryMaxRetries
+	if value := os.Getenv(envS3Retries); value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil || retries < 0 {
+			exitErrorf("[TEST FAILURE] Invalid S3 max retries %q. Set a non-negative integer for environment variable- %s", value, envS3Retries)
+		}
+		r.s3MaxRetries = retries
+	}
+
+	if value := os.Getenv(envRunTimeout); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			exitErrorf("[TEST FAILURE] Invalid run timeout %q. Set a positive duration such as \"15m\" for environment variable- %s", value, envRunTimeout)
+		}
+		r.runTimeout = timeout
+	}
+}
+
+// Parses the options of the validation and rejects the ones the destinations do not support
+func (r *runSettings) parseOptions() {
+	// Ordering is only checked on request since most destinations do not guarantee it
+	if value := os.Getenv(envCheckOrder); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid ordering check %q. Set \"true\" or \"false\" for environment variable- %s", value, envCheckOrder)
+		}
+		r.checkOrdering = enabled
+	}
+
+	// Only the records of a single run are validated when the destination is shared with other runs
+	windowStart, err := parseWindowTime(os.Getenv(envStartTime))
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Invalid start time for environment variable- %s: %v", envStartTime, err)
+	}
+	windowEnd, err := parseWindowTime(os.Getenv(envEndTime))
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Invalid end time for environment variable- %s: %v", envEndTime, err)
+	}
+	r.window = TimeWindow{start: windowStart, end: windowEnd}
+	if !r.window.start.IsZero() && !r.window.end.IsZero() && r.window.end.Before(r.window.start) {
+		exitErrorf("[TEST FAILURE] End time %s is before start time %s. Set the values for environment variables- %s and %s", r.window.end, r.window.start, envEndTime, envStartTime)
+	}
+
+	// Progress is only reported on request to keep the CI logs quiet
+	if value := os.Getenv(envProgress); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid progress setting %q. Set \"true\" or \"false\" for environment variable- %s", value, envProgress)
+		}
+		r.showProgress = enabled
+	}
+
+	// Only the size of the destination is reported in estimate only mode, nothing is downloaded
+	if value := os.Getenv(envEstimate); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid estimate only setting %q. Set \"true\" or \"false\" for environment variable- %s", value, envEstimate)
+		}
+		for _, destination := range r.destinations {
+			if enabled && destination != "s3" && destination != "cloudwatch" {
+				exitErrorf("[TEST FAILURE] Estimate only mode is not supported for destination %q. Unset the environment variable- %s", destination, envEstimate)
+			}
+		}
+		r.estimateOnly = enabled
+	}
+
+	// Every version of the objects is validated on request, for versioned buckets where a retry overwrites an object
+	if value := os.Getenv(envS3Versions); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid object versions setting %q. Set \"true\" or \"false\" for environment variable- %s", value, envS3Versions)
+		}
+		for _, destination := range r.destinations {
+			if enabled && destination != "s3" {
+				exitErrorf("[TEST FAILURE] Object versions are not supported for destination %q. Unset the environment variable- %s", destination, envS3Versions)
+			}
+		}
+		// Only the latest versions are estimated
+		if enabled && r.estimateOnly {
+			exitErrorf("[TEST FAILURE] Estimate only mode is not supported with object versions. Unset the environment variable- %s", envEstimate)
+		}
+		// The versions are listed with key markers, which the checkpoint does not save
+		if enabled && os.Getenv(envCheckpoint) != "" {
+			exitErrorf("[TEST FAILURE] Checkpoints are not supported with object versions. Unset the environment variable- %s", envCheckpoint)
+		}
+		r.useVersions = enabled
+	}
+
+	// The objects are streamed to the workers as listed unless they are sorted by time on request,
+	// e.g. for the first and last arrivals and the time series, which needs every key to be listed first
+	r.objectOrder = os.Getenv(envS3Order)
+	switch r.objectOrder {
+	case "", s3OrderListing:
+	case s3OrderModified, s3OrderKeyTime:
+		for _, destination := range r.destinations {
+			if destination != "s3" && destination != "firehose" {
+				exitErrorf("[TEST FAILURE] Object order is not supported for destination %q. Unset the environment variable- %s", destination, envS3Order)
+			}
+		}
+		// The listing is saved while the objects are not validated yet
+		if os.Getenv(envCheckpoint) != "" {
+			exitErrorf("[TEST FAILURE] Checkpoints are not supported with sorted objects. Unset the environment variable- %s", envCheckpoint)
+		}
+	default:
+		exitErrorf("[TEST FAILURE] Invalid object order %q. Set %q, %q or %q for environment variable- %s", r.objectOrder, s3OrderListing, s3OrderModified, s3OrderKeyTime, envS3Order)
+	}
+
+	r.checkLocations()
+	r.parsePolling()
+
+	// Reading a destination stops once every record was found on request, for a quick smoke test.
+	// The destinations left are not validated either once the loss of one of them can no longer pass.
+	if value := os.Getenv(envFailFast); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid fail fast setting %q. Set \"true\" or \"false\" for environment variable- %s", value, envFailFast)
+		}
+		for _, destination := range r.destinations {
+			if enabled && destination != "s3" && destination != "firehose" && destination != "cloudwatch" {
+				exitErrorf("[TEST FAILURE] Fail fast mode is not supported for destination %q. Unset the environment variable- %s", destination, envFailFast)
+			}
+		}
+		r.stopWhenFound = enabled
+	}
+
+	// Every record found is traced to its location on request, which writes a line per record
+	if path := os.Getenv(envAuditFile); path != "" {
+		r.audit, err = newAuditLog(path)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to create the audit log: %v", err)
+		}
+	}
+}
+
+// Rejects the options which are not supported with several buckets or log groups, or by the destinations
+func (r *runSettings) checkLocations() {
+	if len(r.buckets) > 1 {
+		for _, destination := range r.destinations {
+			if destination == "firehose" {
+				exitErrorf("[TEST FAILURE] Several buckets are not supported for destination %q. Set a single bucket for environment variable- %s", destination, envS3Bucket)
+			}
+		}
+		if os.Getenv(envErrorPrefix) != "" && os.Getenv(envErrorBucket) == "" {
+			exitErrorf("[TEST FAILURE] Error output bucket required with several buckets. Set the value for environment variable- %s", envErrorBucket)
+		}
+		if r.discoverMode != "" {
+			exitErrorf("[TEST FAILURE] Prefix discovery is not supported for several buckets. Unset the environment variable- %s", envDiscover)
+		}
+		if r.estimateOnly {
+			exitErrorf("[TEST FAILURE] Estimate only mode is not supported for several buckets. Unset the environment variable- %s", envEstimate)
+		}
+		if os.Getenv(envCheckpoint) != "" {
+			exitErrorf("[TEST FAILURE] Checkpoints are not supported for several buckets. Unset the environment variable- %s", envCheckpoint)
+		}
+	}
+	validatesCloudWatch := false
+	for _, destination := range r.destinations {
+		validatesCloudWatch = validatesCloudWatch || destination == "cloudwatch"
+	}
+	if len(r.logGroups) > 1 && validatesCloudWatch {
+		if r.estimateOnly {
+			exitErrorf("[TEST FAILURE] Estimate only mode is not supported for several log groups. Unset the environment variable- %s", envEstimate)
+		}
+		// Log streams of different log groups may have the same name, which the checkpoint can not tell apart
+		if os.Getenv(envCheckpoint) != "" {
+			exitErrorf("[TEST FAILURE] Checkpoints are not supported for several log groups. Unset the environment variable- %s", envCheckpoint)
+		}
+	}
+
+	if os.Getenv(envErrorPrefix) != "" {
+		validatesOpenSearch := false
+		for _, destination := range r.destinations {
+			validatesOpenSearch = validatesOpenSearch || destination == "opensearch"
+		}
+		if !validatesOpenSearch {
+			exitErrorf("[TEST FAILURE] The error output is only validated for destination \"opensearch\". Unset the environment variable- %s", envErrorPrefix)
+		}
+	}
+	for _, destination := range r.destinations {
+		if r.discoverMode != "" && destination != "s3" {
+			exitErrorf("[TEST FAILURE] Prefix discovery is not supported for destination %q. Unset the environment variable- %s", destination, envDiscover)
+		}
+		if os.Getenv(envCheckpoint) != "" && destination != "s3" && destination != "cloudwatch" && destination != "firehose" {
+			exitErrorf("[TEST FAILURE] Checkpoints are not supported for destination %q. Unset the environment variable- %s", destination, envCheckpoint)
+		}
+	}
+}
+
+// Parses when the destinations are read, once after the initial wait or until every record arrived
+func (r *runSettings) parsePolling() {
+	// The destinations are validated again until every record arrived on request, e.g. for near real time pipelines
+	if value := os.Getenv(envPollPeriod); value != "" {
+		var err error
+		r.pollInterval, err = time.ParseDuration(value)
+		if err != nil || r.pollInterval <= 0 {
+			exitErrorf("[TEST FAILURE] Invalid poll interval %q. Set a positive duration such as \"30s\" for environment variable- %s", value, envPollPeriod)
+		}
+		value = os.Getenv(envPollTimeout)
+		r.pollTimeout, err = time.ParseDuration(value)
+		if err != nil || r.pollTimeout <= 0 {
+			exitErrorf("[TEST FAILURE] Invalid poll timeout %q. Set a positive duration such as \"10m\" for environment variable- %s", value, envPollTimeout)
+		}
+		// Every pass validates the destination again, which neither a checkpoint nor the audit log can tell apart
+		if os.Getenv(envCheckpoint) != "" {
+			exitErrorf("[TEST FAILURE] Checkpoints are not supported when polling. Unset the environment variable- %s", envCheckpoint)
+		}
+		if os.Getenv(envAuditFile) != "" {
+			exitErrorf("[TEST FAILURE] The audit log is not supported when polling. Unset the environment variable- %s", envAuditFile)
+		}
+		// Messages of a queue can only be received once per pass
+		for _, destination := range r.destinations {
+			if destination == "sqs" {
+				exitErrorf("[TEST FAILURE] Polling is not supported for destination %q. Unset the environment variable- %s", destination, envPollPeriod)
+			}
+		}
+	} else if os.Getenv(envPollTimeout) != "" {
+		exitErrorf("[TEST FAILURE] Poll interval required for the poll timeout. Set the value for environment variable- %s", envPollPeriod)
+	}
+	// Delivery lags production, so the destinations are only read once the pipeline had time to flush the records in flight.
+	// Either a fixed wait long enough for every record, or a shorter one followed by polling until every record arrived.
+	var err error
+	r.initialWait, err = parseInitialWait(os.Getenv(envInitialWait))
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Invalid initial wait %q. Set a duration such as \"2m\" for environment variable- %s", os.Getenv(envInitialWait), envInitialWait)
+	}
+}
+
+// Returns the context of the run, done once the run timed out or was interrupted, and the signal which interrupted it if any
+func (r *runSettings) runContext() (context.Context, context.CancelFunc, func() os.Signal) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if r.runTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.runTimeout)
+	}
+
+	// SIGINT and SIGTERM stop the validation like the timeout, so that the records found so far are still reported.
+	// A second signal terminates the run right away.
+	ctx, interrupt := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	var interruptedBy os.Signal
+	go func() {
+		select {
+		case sig := <-signals:
+			logrus.Warnf("Received %s, stopping the validation to report the partial results", sig)
+			interruptedBy = sig
+			signal.Stop(signals)
+			interrupt()
+		case <-ctx.Done():
+		}
+	}()
+	stop := func() {
+		interrupt()
+		cancel()
+	}
+	return ctx, stop, func() os.Signal { return interruptedBy }
+}
+
+// Validates a single destination with its own copy of the input records and counters.
+// Returns nil if only an estimate or the discovered prefixes were printed.
+func (r *runSettings) validateDestination(ctx context.Context, destination string, inputMap *RecordMap) *destinationResult {
+	settings := r.validatorSettings
+	settings.destination = destination
+	settings.parser = r.parser.clone()
+	// Delivery delays measured from the producer timestamp embedded in each record
+	settings.delays = &DelayStats{}
+	if os.Getenv(envTimeSeries) != "" {
+		settings.delays.produced = make(map[string]time.Time, inputMap.len())
+	}
+	if r.checkOrdering {
+		settings.ordering = newOrderStats()
+	}
+
+	// Each destination may have its own prefix, e.g. S3_LOG_PREFIX and CLOUDWATCH_LOG_PREFIX.
+	// The data files of a table are found from its metadata instead, and the files of a local directory by walking it.
+	settings.prefix = destinationEnv(destination, envLogPrefix)
+	if settings.prefix == "" && r.discoverMode == "" && destination != "s3tables" && destination != "localdir" {
+		exitErrorf("[TEST FAILURE] Object prefix required. Set the value for environment variable- %s or %s_%s", envLogPrefix, strings.ToUpper(destination), envLogPrefix)
+	}
+
+	// A run which failed part way resumes from its checkpoint instead of starting over
+	if path := os.Getenv(envCheckpoint); path != "" {
+		if len(r.destinations) > 1 {
+			path += "." + destination
+		}
+		var err error
+		settings.checkpoint, err = newCheckpointer(path, destination)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to load the checkpoint: %v", err)
+		}
+		if settings.checkpoint.resuming() {
+			logrus.Infof("Resuming from checkpoint %s with %d records found", path, settings.checkpoint.resumedFound())
+			settings.checkpoint.restore(inputMap, settings.parser)
+		}
+	}
+
+	// Only the validation of this destination stops once every record was found, the run goes on
+	validationCtx := ctx
+	if r.stopWhenFound {
+		var stop context.CancelFunc
+		validationCtx, stop = context.WithCancel(ctx)
+		defer stop()
+		settings.failFast = newFailFast(inputMap, stop)
+	}
+
+	logrus.Infof("Validating %d records in %s", r.totalInputRecord, destination)
+	validationStart := time.Now()
+
+	validator := validators[destination](ctx, &settings)
+	if validator == nil {
+		return nil
+	}
+	totalRecordFound, validationErr := validator.Validate(validationCtx, inputMap)
+
+	if settings.failFast.complete() {
+		logrus.Warnf("Stopped reading %s once every record was found, duplicates in the rest of it are not counted", destination)
+	}
+
+	if validationErr != nil {
+		exitErrorf("[TEST FAILURE] %v", validationErr)
+	}
+	totalRecordFound += settings.checkpoint.resumedFound()
+	// A partial run keeps its checkpoint to resume from
+	if ctx.Err() == nil {
+		if err := settings.checkpoint.remove(); err != nil {
+			logrus.Warnf("Unable to remove the checkpoint: %v", err)
+		}
+	}
+	logrus.Infof("Found %d records in %s in %s", totalRecordFound, destination, time.Since(validationStart).Round(time.Millisecond))
+
+	result := &destinationResult{
+		destination: destination,
+		found:       totalRecordFound,
+		inputMap:    inputMap,
+		parser:      settings.parser,
+		delays:      settings.delays,
+		ordering:    settings.ordering,
+	}
+	if reporter, ok := validator.(resultReporter); ok {
+		reporter.report(result)
+	}
+	if searcher, ok := validator.(recordSearcher); ok {
+		result.searched = searcher.searchesRecords()
+	}
+	return result
+}
+
+// Checks the credentials and permissions with a cheap call per destination up front, rather than deep into the run.
+// Returns the account and region each destination read from AWS is validated in.
+func (r *runSettings) preflight(ctx context.Context) map[string]*AWSIdentity {
+	skipPreflight := false
+	if value := os.Getenv(envSkipPreflt); value != "" {
+		skip, err := strconv.ParseBool(value)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Invalid preflight setting %q. Set \"true\" or \"false\" for environment variable- %s", value, envSkipPreflt)
+		}
+		skipPreflight = skip
+	}
+	// Results of the destinations read from AWS are labelled with the account and region they were validated in,
+	// so that a run against the wrong environment stands out
+	identities := make(map[string]*AWSIdentity)
+	if skipPreflight {
+		return identities
+	}
+	if !r.offline {
+		stsClient, err := getSTSClient(r.region)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to create new STS client: %v", err)
+		}
+		account, arn, err := preflightIdentity(ctx, stsClient)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Preflight check of the AWS credentials failed, %v. Set \"true\" for environment variable- %s to skip it", err, envSkipPreflt)
+		}
+		for _, destination := range r.destinations {
+			if destinationRegion := destinationRegion(destination, r.region, r.s3Region, r.cwRegion); destinationRegion != "" {
+				identities[destination] = &AWSIdentity{Account: account, Region: destinationRegion}
+				logrus.Infof("Validating %s in account %s and region %s as %s", destination, account, destinationRegion, arn)
+			}
+		}
+	}
+	for _, destination := range r.destinations {
+		var err error
+		switch destination {
+		case "s3", "firehose":
+			s3Client, clientErr := getS3Client(r.s3Region)
+			if clientErr != nil {
+				exitErrorf("[TEST FAILURE] Unable to create new S3 client: %v", clientErr)
+			}
+			for _, bucket := range r.buckets {
+				if err = preflightS3(ctx, s3Client, bucket); err != nil {
+					break
+				}
+			}
+		case "cloudwatch":
+			cwClient, clientErr := getCWClient(r.cwRegion)
+			if clientErr != nil {
+				exitErrorf("[TEST FAILURE] Unable to create new CloudWatch client: %v", clientErr)
+			}
+			for _, logGroup := range r.logGroups {
+				if err = preflightCloudWatch(ctx, cwClient, logGroup); err != nil {
+					break
+				}
+			}
+		case "dynamodb":
+			// A missing table name is reported by the validation itself
+			if table := os.Getenv(envDynamoTable); table != "" {
+				dynamoClient, clientErr := getDynamoClient(r.region)
+				if clientErr != nil {
+					exitErrorf("[TEST FAILURE] Unable to create new DynamoDB client: %v", clientErr)
+				}
+				err = preflightDynamo(ctx, dynamoClient, table)
+			}
+		case "sqs":
+			// A missing queue URL is reported by the validation itself
+			if queueUrl := os.Getenv(envSQSQueueUrl); queueUrl != "" {
+				sqsClient, clientErr := getSQSClient(r.region)
+				if clientErr != nil {
+					exitErrorf("[TEST FAILURE] Unable to create new SQS client: %v", clientErr)
+				}
+				err = preflightSQS(ctx, sqsClient, queueUrl)
+			}
+		}
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Preflight check of destination %q failed, %v. Set \"true\" for environment variable- %s to skip it", destination, err, envSkipPreflt)
+		}
+	}
+	return identities
+}
+
+// Validates every destination, one after the other or concurrently.
+// Returns the results of the destinations which were validated, in the order of the destinations.
+func (r *runSettings) validateAll(ctx context.Context) []*destinationResult {
+	// The input records are only copied for the additional destinations, before any of them is validated
+	records := make([]*RecordMap, len(r.destinations))
+	for i := range r.destinations {
+		records[i] = r.inputMap
+		if i > 0 {
+			records[i] = r.inputMap.reset()
+		}
+	}
+	validated := make([]*destinationResult, len(r.destinations))
+	validateAt := func(i int, destination string) {
+		var result *destinationResult
+		// The retries since the start are those of this destination when the destinations are validated one after the other.
+		// Concurrent destinations share the retries of the run, which are reported with each of them.
+		retriesStart := retryTotals.snapshot()
+		if r.pollInterval > 0 {
+			result = pollDestination(ctx, r.pollInterval, r.pollTimeout, records[i], func(inputMap *RecordMap) *destinationResult {
+				return r.validateDestination(ctx, destination, inputMap)
+			})
+		} else {
+			result = r.validateDestination(ctx, destination, records[i])
+		}
+		if result != nil {
+			result.retries = retryTotals.snapshot().since(retriesStart)
+			// The loss of an empty destination is more likely a mistake in the configuration than lost records
+			if result.empty() {
+				logrus.Warnf("Destination %s is empty, no objects or events were found. Check that the environment variables- %s point at where the test delivers its logs, or that the test has delivered any yet", destination, strings.Join(destinationLocationEnvs(destination), ", "))
+			}
+			validated[i] = result
+		}
+	}
+	if r.concurrent {
+		// Every destination counts the records with its own copy of them, they are only compared once all are done
+		var wg sync.WaitGroup
+		for i, destination := range r.destinations {
+			wg.Add(1)
+			go func(i int, destination string) {
+				defer wg.Done()
+				validateAt(i, destination)
+			}(i, destination)
+		}
+		wg.Wait()
+	} else {
+		for i, destination := range r.destinations {
+			validateAt(i, destination)
+			if i < len(r.destinations)-1 && r.cannotPass(ctx, validated[i]) {
+				logrus.Warnf("Not validating destinations %s, the run can not pass anymore", strings.Join(r.destinations[i+1:], ", "))
+				break
+			}
+		}
+	}
+	var destinationResults []*destinationResult
+	for _, result := range validated {
+		if result != nil {
+			destinationResults = append(destinationResults, result)
+		}
+	}
+	if err := r.audit.close(); err != nil {
+		exitErrorf("[TEST FAILURE] Unable to write the audit log: %v", err)
+	}
+	return destinationResults
+}
+
+// Returns true if fail fast mode is enabled and the loss of a destination read in full exceeds the allowed loss.
+// Only the loss of destinations reported on their own fails the run, combined destinations may make up for each other.
+func (r *runSettings) cannotPass(ctx context.Context, result *destinationResult) bool {
+	if !r.stopWhenFound || result == nil || ctx.Err() != nil || r.parser.duplicatesOnly || (r.combineMode != "" && len(r.destinations) > 1) {
+		return false
+	}
+	percent, exceeded := lossExceeded(result.inputMap, r.limits.maxLossPercent)
+	if exceeded {
+		logrus.Warnf("Log loss of %s%% in %s exceeds the allowed %v%%", formatPercent(percent), result.destination, r.limits.maxLossPercent)
+	}
+	return exceeded
+}
+
+// Prints the results of every destination and writes the files requested along with them
+func (r *runSettings) report(ctx context.Context, destinationResults []*destinationResult, identities map[string]*AWSIdentity) ([]Results, []DuplicateResults) {
+	// Destinations validated together are compared before they may be combined, which would hide which of them missed a record
+	var reconciliation *Reconciliation
+	if r.concurrent && len(destinationResults) > 1 && !r.parser.duplicatesOnly {
+		compared, delivered := reconcile(destinationResults)
+		reconciliation = &compared
+		if path := os.Getenv(envMissingFile); path != "" {
+			path += ".all"
+			if err := writeMissingRecords(path, delivered); err != nil {
+				exitErrorf("[TEST FAILURE] Unable to write the missing records to %s: %v", path, err)
+			}
+		}
+	}
+	if r.combineMode != "" && len(destinationResults) > 1 {
+		destinationResults = []*destinationResult{combineResults(destinationResults, r.combineMode)}
+	}
+
+	var results []Results
+	var metricResults []MetricResults
+	var duplicateResults []DuplicateResults
+	for _, result := range destinationResults {
+		// Results are only labelled with their destination when there are several of them
+		label := ""
+		if len(r.destinations) > 1 {
+			label = result.destination
+		}
+
+		if r.parser.duplicatesOnly {
+			duplicateResults = append(duplicateResults, computeDuplicates(label, result.found, result.inputMap, result.parser.unparseableCount(), result.parser.malformedCount(), result.parser.foreignCount()))
+			print_duplicates(duplicateResults[len(duplicateResults)-1], r.outputFormat)
+			continue
+		}
+
+		if path := os.Getenv(envMissingFile); path != "" {
+			if len(destinationResults) > 1 {
+				path += "." + result.destination
+			}
+			if err := writeMissingRecords(path, result.inputMap); err != nil {
+				exitErrorf("[TEST FAILURE] Unable to write the missing records to %s: %v", path, err)
+			}
+		}
+		if path := os.Getenv(envResultMap); path != "" {
+			if len(destinationResults) > 1 {
+				path += "." + result.destination
+			}
+			if err := writeResultMap(path, result.inputMap); err != nil {
+				exitErrorf("[TEST FAILURE] Unable to write the result map to %s: %v", path, err)
+			}
+		}
+		if path := os.Getenv(envTimeSeries); path != "" {
+			if len(destinationResults) > 1 {
+				path += "." + result.destination
+			}
+			if err := writeTimeSeries(path, timeSeries(result.inputMap, result.delays.produced, timeSeriesWindow)); err != nil {
+				exitErrorf("[TEST FAILURE] Unable to write the time series to %s: %v", path, err)
+			}
+		}
+
+		// Get benchmark results based on log loss, log delay and log duplication
+		results = append(results, get_results(resultInputs{
+			destination:      label,
+			totalInputRecord: r.totalInputRecord,
+			totalRecordFound: result.found,
+			recordMap:        result.inputMap,
+			unparseable:      result.parser.unparseableCount(),
+			malformed:        result.parser.malformedCount(),
+			foreign:          result.parser.foreignCount(),
+			logDelay:         r.logDelay,
+			delays:           result.delays,
+			ordering:         result.ordering,
+			objects:          result.objects,
+			logGroups:        result.logGroups,
+			errorRecords:     result.errorRecords,
+			payloads:         result.parser.payloadCounts(),
+			retries:          result.retries,
+			sampleRate:       r.sampleRate,
+			completion:       result.completion,
+			partial:          ctx.Err() != nil,
+			identity:         identities[result.destination],
+		}, r.outputFormat))
+		metricResults = append(metricResults, MetricResults{
+			Destination: result.destination,
+			LogPrefix:   destinationEnv(result.destination, envLogPrefix),
+			Results:     results[len(results)-1],
+		})
+	}
+
+	if reconciliation != nil {
+		print_reconciliation(*reconciliation, r.outputFormat)
+	}
+
+	// Metrics are written before the thresholds are checked, so that failed runs show up as well
+	if path := os.Getenv(envMetricsFile); path != "" {
+		if err := writeMetrics(path, metricResults); err != nil {
+			exitErrorf("[TEST FAILURE] Unable to write the metrics to %s: %v", path, err)
+		}
+	}
+	return results, duplicateResults
+}
+
+// Writes the summary line and exits if the run was partial or any destination is outside of the allowed thresholds
+func (r *runSettings) finish(ctx context.Context, results []Results, duplicateResults []DuplicateResults, interruptedBy os.Signal) {
+	var failures []string
+	for _, result := range duplicateResults {
+		failures = append(failures, r.limits.duplicateFailures(result)...)
+	}
+	for _, result := range results {
+		failures = append(failures, r.limits.failures(result)...)
+	}
+
+	// Partial results never pass, whatever the thresholds say
+	if r.summaryPath != "" {
+		line := summaryLine(len(failures) == 0 && ctx.Err() == nil, strings.Join(r.destinations, ","), results, duplicateResults)
+		if err := writeSummaryLine(r.summaryPath, line); err != nil {
+			exitErrorf("[TEST FAILURE] Unable to write the summary line to %s: %v", r.summaryPath, err)
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		fmt.Fprintf(os.Stderr, "[TEST FAILURE] Validation did not finish within %s, the results are partial\n", r.runTimeout)
+		os.Exit(exitCodeTimeout)
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "[TEST FAILURE] Validation was interrupted by %s, the results are partial\n", interruptedBy)
+		os.Exit(exitCodeInterrupted)
+	}
+
+	if len(failures) > 0 {
+		exitErrorf("[TEST FAILURE] %s", failures[0])
+	}
+}
+
+// Subset of the S3 API used for validation, so that it can be mocked in tests
+type s3API interface {
+	ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error)
+	ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error
+	ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error)
+	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
+	SelectObjectContentWithContext(ctx aws.Context, input *s3.SelectObjectContentInput, opts ...request.Option) (*s3.SelectObjectContentOutput, error)
+	HeadBucketWithContext(ctx aws.Context, input *s3.HeadBucketInput, opts ...request.Option) (*s3.HeadBucketOutput, error)
+}
+
+// Creates a new S3 Client
+func getS3Client(region string) (*s3.S3, error) {
+	sess, err := getSession(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.New(sess), nil
+}
+
+// Validates the log messages. Our log producer is designed to write log records in a specific format.
+// Log format generated by our producer: 8CharUniqueID_13CharTimestamp_RandomString (10029999_1639151827578_RandomString).
+// Both of the Kinesis Streams and Kinesis Firehose try to send each log maintaining the "at least once" policy.
+// To validate, we need to make sure all the log records from input file are stored at least once.
+// Objects are downloaded and parsed concurrently by workerCount workers fed from the listing pages.
+// The objects under all of the given prefixes are validated together against the same inputMap.
+// Only the objects last modified within the window are downloaded.
+// Each GetObject call is retried up to s3MaxRetries times on throttling and server side errors.
+// Each listing page holds up to s3PageSize keys, or as many as S3 returns if it is zero.
+// With useSelect, only the logs are transferred using S3 Select instead of downloading the whole objects.
+// Once ctx is done, the records found so far are returned. The first error stops all the workers.
+// Returns the number of records found and the number and size of the objects validated.
+// With a checkpoint, the listing resumes from the last checkpoint and a new one is saved between listing pages
+// once all the objects listed so far are validated.
+func validate_s3(ctx context.Context, s3Client s3API, bucket string, prefixes []string, inputMap *RecordMap, settings *validatorSettings, progress *Progress) (int, s3Totals, error) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	// Objects listed but not validated yet
+	var pending sync.WaitGroup
+	var firstErr error
+	s3RecordCounter := 0
+	var totals s3Totals
+
+	// Cancelled on the first error, so that the other workers and the listing stop early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fail := func(err error) {
+		mutex.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mutex.Unlock()
+		cancel()
+	}
+
+	// Objects are handed to the workers page by page, so only a bounded number of them are ever buffered.
+	objects := make(chan s3ObjectVersion, settings.workerCount)
+	for i := 0; i < settings.workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range objects {
+				// Drain the remaining objects without downloading them once the run is over
+				if ctx.Err() != nil {
+					pending.Done()
+					continue
+				}
+
+				// Parse outside of the lock and apply the records in batches, so that large objects are never held in memory.
+				// The object's LastModified is the time the records arrived in S3.
+				recordIds := make([]string, 0, s3BatchSize)
+				recordTimings := make([]recordTiming, 0, s3BatchSize)
+				objectRecordCounter := 0
+				// Number of the log within the object, for the audit log
+				objectLogCounter := 0
+				flush := func() {
+					mutex.Lock()
+					s3RecordCounter += len(recordIds)
+					firstFound := 0
+					for _, recordId := range recordIds {
+						// Counting the occurrences of this record in the destination
+						if countRecord(inputMap, recordId, 1, settings.parser) {
+							firstFound++
+						}
+					}
+					settings.failFast.found(firstFound)
+					for _, timing := range recordTimings {
+						settings.delays.addRecord(timing)
+					}
+					settings.checkpoint.add(len(recordIds))
+					mutex.Unlock()
+
+					objectRecordCounter += len(recordIds)
+					progress.add(len(recordIds), 0)
+					recordIds = recordIds[:0]
+					recordTimings = recordTimings[:0]
+				}
+				handleLog := func(log string) {
+					objectLogCounter++
+					recordId, ok := settings.parser.parse(log)
+					if !ok {
+						// Skip logs without a record ID (count them as lost logs) and foreign records
+						return
+					}
+					settings.audit.add(recordId, "%s:%d", object.location(bucket), objectLogCounter)
+					recordIds = append(recordIds, recordId)
+					if timestamp, ok := settings.parser.timestamp(log); ok {
+						recordTimings = append(recordTimings, recordTiming{recordId: recordId, produced: timestamp, arrived: aws.TimeValue(object.LastModified)})
+					}
+					if len(recordIds) >= s3BatchSize {
+						flush()
+					}
+				}
+
+				var contentBytes int64
+				var compressed bool
+				var err error
+				if settings.useSelect {
+					contentBytes, err = selectS3ObjectLogs(ctx, s3Client, bucket, object.Key, settings.parser, settings.s3MaxRetries, handleLog)
+				} else {
+					contentBytes, compressed, err = getS3ObjectLogs(ctx, s3Client, bucket, object.Key, object.versionId, settings.parser, settings.s3MaxRetries, handleLog)
+				}
+				flush()
+				// The records read before the corruption are counted, the rest of the object is lost
+				var corrupt *corruptObjectError
+				corruptObject := err != nil && settings.parser.skipCorrupt && errors.As(err, &corrupt)
+				if corruptObject {
+					logrus.Warnf("Skipped the rest of a corrupt object after %d records, %v", objectRecordCounter, err)
+					err = nil
+				}
+				if err != nil {
+					// The object may have been read partially once the run is over, which is not an error
+					if ctx.Err() == nil {
+						fail(err)
+					}
+					pending.Done()
+					continue
+				}
+
+				logrus.Debugf("Found %d records in S3 object %q", objectRecordCounter, aws.StringValue(object.Key))
+
+				objectTotals := s3Totals{objects: 1, bytes: aws.Int64Value(object.Size), contentBytes: contentBytes}
+				// S3 Select decompresses the objects itself, whether they were compressed is not known
+				if compressed {
+					objectTotals.gzipObjects = 1
+				} else if !settings.useSelect {
+					objectTotals.plainObjects = 1
+				}
+				objectTotals.perObject.add(objectRecordCounter)
+				if corruptObject {
+					objectTotals.corruptObjects = []string{object.location(bucket)}
+				}
+				if object.versionId != nil {
+					objectTotals.versions = []ObjectVersionRecords{{Key: aws.StringValue(object.Key), VersionId: aws.StringValue(object.versionId), Latest: object.latest, Records: objectRecordCounter}}
+				}
+				mutex.Lock()
+				totals.add(objectTotals)
+				if objectRecordCounter > 0 {
+					settings.delays.addArrival(aws.TimeValue(object.LastModified))
+				}
+				settings.checkpoint.addObjects(objectTotals)
+				mutex.Unlock()
+				progress.add(0, 1)
+				pending.Done()
+			}
+		}()
+	}
+
+	send := func(object s3ObjectVersion) bool {
+		pending.Add(1)
+		select {
+		case objects <- object:
+			return true
+		case <-ctx.Done():
+			pending.Done()
+			return false
+		}
 	}
 
-	destination := os.Getenv(envDestination)
-	if destination == "" {
-		exitErrorf("[TEST FAILURE] Log destination for validation required. Set the value for environment variable- %s", envDestination)
+	// The objects of every prefix are fed to the same workers, each key only once since prefixes may overlap.
+	// After resuming, overlapping prefixes may count the objects validated before the checkpoint again.
+	seen := make(map[string]bool)
+	var skips s3ListingSkips
+	// Objects are only sent once every prefix was listed when they are sorted, the listing is not streamed then
+	var listed []s3ObjectVersion
+	list := send
+	sorted := settings.objectOrder != "" && settings.objectOrder != s3OrderListing
+	if sorted {
+		list = func(object s3ObjectVersion) bool {
+			listed = append(listed, object)
+			return ctx.Err() == nil
+		}
 	}
+	startPrefix, startToken := settings.checkpoint.s3Start()
+	for i, prefix := range prefixes {
+		if ctx.Err() != nil {
+			break
+		}
+		if i < startPrefix {
+			continue
+		}
+		var continuationToken *string
+		if i == startPrefix {
+			continuationToken = startToken
+		}
+
+		prefixIndex := i
+		onPage := func(nextToken *string) {
+			// Sorted objects are only validated once every prefix was listed, a page token would claim objects which were not.
+			// Such runs are not checkpointed and start over when resumed.
+			if sorted || !settings.checkpoint.due() {
+				return
+			}
+			pending.Wait()
+			mutex.Lock()
+			defer mutex.Unlock()
+			// Objects may have been validated partially once the run is over
+			if ctx.Err() != nil {
+				return
+			}
+			settings.checkpoint.s3Page(prefixIndex, nextToken)
+			if err := settings.checkpoint.save(inputMap, settings.parser); err != nil {
+				logrus.Warnf("Unable to save the checkpoint: %v", err)
+			}
+		}
 
-	inputRecord := os.Args[1]
-	if inputRecord == "" {
-		exitErrorf("[TEST FAILURE] Total input record number required. Set the value as the first argument")
+		listingStart := time.Now()
+		var err error
+		if settings.useVersions {
+			err = listS3ObjectVersions(ctx, s3Client, bucket, prefix, settings.s3PageSize, settings.window, seen, &skips, list)
+		} else {
+			err = listS3Objects(ctx, s3Client, bucket, prefix, continuationToken, settings.s3PageSize, settings.window, seen, &skips, list, onPage)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				fail(err)
+			}
+			break
+		}
+		logrus.Infof("Listed the objects with prefix %q in %s", prefix, time.Since(listingStart).Round(time.Millisecond))
 	}
-	totalInputRecord, _ := strconv.Atoi((inputRecord))
-	// Map for counting unique records in corresponding destination
-	inputMap := make(map[string]bool)
-	for i := 0; i < totalInputRecord; i++ {
-		recordId := strconv.Itoa(idCounterBase + i)
-		inputMap[recordId] = false
+	if skips.duplicates > 0 {
+		logrus.Infof("Skipped %d S3 objects listed more than once", skips.duplicates)
 	}
-
-	logDelay := os.Args[2]
-	if logDelay == "" {
-		exitErrorf("[TEST FAILURE] Log delay required. Set the value as the second argument")
+	if skips.outsideWindow > 0 {
+		logrus.Infof("Skipped %d S3 objects last modified outside of the time window", skips.outsideWindow)
 	}
-
-	totalRecordFound := 0
-	if destination == "s3" {
-		s3Client, err := getS3Client(region)
-		if err != nil {
-			exitErrorf("[TEST FAILURE] Unable to create new S3 client: %v", err)
+	// The workers take the objects in order, which they validate concurrently unless there is a single worker
+	if listed != nil {
+		sortS3Objects(listed, settings.objectOrder)
+		logrus.Infof("Sorted %d S3 objects by %s", len(listed), settings.objectOrder)
+		for _, object := range listed {
+			if !send(object) {
+				break
+			}
 		}
+	}
 
-		totalRecordFound, inputMap = validate_s3(s3Client, bucket, prefix, inputMap)
-	} else if destination == "cloudwatch" {
-		cwClient, err := getCWClient(region)
-		if err != nil {
-			exitErrorf("[TEST FAILURE] Unable to create new CloudWatch client: %v", err)
-		}
+	close(objects)
+	wg.Wait()
+	// Only the keys with several versions are reported, the records of a single version are those of its object
+	totals.versions = multipleVersions(totals.versions)
 
-		totalRecordFound, inputMap = validate_cloudwatch(cwClient, logGroup, prefix, inputMap)
+	if firstErr != nil {
+		return s3RecordCounter, totals, firstErr
 	}
 
-	// Get benchmark results based on log loss, log delay and log duplication
-	get_results(totalInputRecord, totalRecordFound, inputMap, logDelay)
+	logrus.Infof("Validated %d S3 objects of %d bytes", totals.objects, totals.bytes)
+
+	return s3RecordCounter, totals, nil
 }
 
-// Creates a new S3 Client
-func getS3Client(region string) (*s3.S3, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
+// Number and size of the S3 objects validated
+type s3Totals struct {
+	objects int
+	// Size of the objects as stored in S3
+	bytes int64
+	// Size of the content read from the objects, after decompression, or processed by S3 Select
+	contentBytes int64
+	// Number of objects of each bucket, only set when several buckets are validated
+	buckets []BucketObjects
+	// Records of every version of the keys with several versions, only set when the versions are validated
+	versions []ObjectVersionRecords
+	// Number of objects read compressed with gzip or as plaintext, neither is counted with S3 Select
+	gzipObjects  int
+	plainObjects int
+	// Records found per object, only for the objects validated since the run started or resumed
+	perObject objectRecordStats
+	// Locations of the compressed objects skipped for a corrupt gzip stream, only set when they are skipped
+	corruptObjects []string
+}
 
-	if err != nil {
-		return nil, err
-	}
+// Number of records found out of producer order in a log stream or shard
+type StreamOrder struct {
+	Stream     string `json:"stream"`
+	OutOfOrder int    `json:"out_of_order"`
+}
 
-	return s3.New(sess), nil
+// Number of records found in one of several log groups
+type LogGroupRecords struct {
+	LogGroup string `json:"log_group"`
+	Records  int    `json:"records"`
 }
 
-// Validates the log messages. Our log producer is designed to write log records in a specific format.
-// Log format generated by our producer: 8CharUniqueID_13CharTimestamp_RandomString (10029999_1639151827578_RandomString).
-// Both of the Kinesis Streams and Kinesis Firehose try to send each log maintaining the "at least once" policy.
-// To validate, we need to make sure all the log records from input file are stored at least once.
-func validate_s3(s3Client *s3.S3, bucket string, prefix string, inputMap map[string]bool) (int, map[string]bool) {
-	var continuationToken *string
+// Number of logs delivered with a payload different from the one sent by the producer
+type PayloadCounts struct {
+	// Logs which are a prefix of their payload
+	Truncated int
+	// Logs which differ from their payload otherwise
+	Corrupted int
+}
+
+// Number of objects validated in one of several buckets
+type BucketObjects struct {
+	Bucket  string `json:"bucket"`
+	Objects int    `json:"objects"`
+}
+
+// Adds the totals of other objects
+func (t *s3Totals) add(other s3Totals) {
+	t.objects += other.objects
+	t.bytes += other.bytes
+	t.contentBytes += other.contentBytes
+	t.buckets = append(t.buckets, other.buckets...)
+	t.versions = append(t.versions, other.versions...)
+	t.gzipObjects += other.gzipObjects
+	t.plainObjects += other.plainObjects
+	t.perObject.merge(other.perObject)
+	t.corruptObjects = append(t.corruptObjects, other.corruptObjects...)
+}
+
+// Number of listed objects which were not validated, by reason
+type s3ListingSkips struct {
+	duplicates    int
+	outsideWindow int
+}
+
+// Calls send with all the objects from a S3 bucket with the given prefix, until send returns false.
+// This approach utilizes NextContinuationToken to pull all the objects from the S3 bucket, starting from continuationToken if set.
+// Keys in seen and objects last modified outside of the window are skipped and counted, the keys sent are added to seen.
+// Once the objects of a page are sent, onPage is called with the continuation token of the next one.
+func listS3Objects(ctx context.Context, s3Client s3API, bucket string, prefix string, continuationToken *string, pageSize int64, window TimeWindow, seen map[string]bool, skips *s3ListingSkips, send func(s3ObjectVersion) bool, onPage func(nextToken *string)) error {
 	var input *s3.ListObjectsV2Input
-	s3RecordCounter := 0
-	s3ObjectCounter := 0
 
-	// Returns all the objects from a S3 bucket with the given prefix.
-	// This approach utilizes NextContinuationToken to pull all the objects from the S3 bucket.
 	for {
 		input = &s3.ListObjectsV2Input{
 			Bucket:            aws.String(bucket),
 			ContinuationToken: continuationToken,
 			Prefix:            aws.String(prefix),
 		}
+		if pageSize > 0 {
+			input.MaxKeys = aws.Int64(pageSize)
+		}
 
-		response, err := s3Client.ListObjectsV2(input)
+		var response *s3.ListObjectsV2Output
+		err := retryWithBackoff(ctx, func() error {
+			var err error
+			response, err = s3Client.ListObjectsV2WithContext(ctx, input)
+			return err
+		})
 		if err != nil {
-			exitErrorf("[TEST FAILURE] Error occured to get the objects from bucket: %q., %v", bucket, err)
+			return fmt.Errorf("error occured to get the objects with prefix %q from bucket %q: %w", prefix, bucket, err)
 		}
 
+		logrus.Infof("Listed %d objects with prefix %q", len(response.Contents), prefix)
 		for _, content := range response.Contents {
-			input := &s3.GetObjectInput{
-				Bucket: aws.String(bucket),
-				Key:    content.Key,
+			key := aws.StringValue(content.Key)
+			if seen[key] {
+				skips.duplicates++
+				continue
 			}
-			obj := getS3Object(s3Client, input)
-			s3ObjectCounter++
+			seen[key] = true
 
-			dataByte, err := ioutil.ReadAll(obj.Body)
-			if err != nil {
-				exitErrorf("[TEST FAILURE] Error to parse GetObject response. %v", err)
+			// Objects of other runs sharing the prefix are never downloaded
+			if !window.contains(aws.TimeValue(content.LastModified)) {
+				skips.outsideWindow++
+				continue
 			}
 
-			data := strings.Split(string(dataByte), "\n")
-
-			for _, d := range data {
-				if d == "" {
-					continue
-				}
-
-				var message Message
-
-				decodeError := json.Unmarshal([]byte(d), &message)
-				if decodeError != nil {
-					fmt.Println("[TEST ERROR] Malform log entry. Unmarshal Error:", decodeError)
-					fmt.Println("             Malform entry: %s", d)
-					// Skip malform log entries (count them as lost logs)
-					continue
-				}
-
-				// First 8 char is the unique record ID
-				recordId := message.Log[:8]
-				s3RecordCounter += 1
-				if _, ok := inputMap[recordId]; ok {
-					// Setting true to indicate that this record was found in the destination
-					inputMap[recordId] = true
-				}
+			if !send(s3ObjectVersion{Object: content}) {
+				return nil
 			}
 		}
 
 		if !aws.BoolValue(response.IsTruncated) {
-			break
+			return nil
 		}
 		continuationToken = response.NextContinuationToken
+		onPage(continuationToken)
+	}
+}
+
+// Downloads a single S3 object and calls fn with every log entry in it while the object is read.
+// Objects compressed with gzip, e.g. by Firehose or by the s3 output of Fluent Bit, are decompressed while they are read.
+// Returns the number of bytes read, which are decompressed if the object is stored with a gzip content encoding or compressed,
+// and whether the object was compressed. Objects stored with a gzip content encoding arrive decompressed by the HTTP client,
+// they are reported as not compressed.
+func getS3ObjectLogs(ctx context.Context, s3Client s3API, bucket string, key *string, versionId *string, parser *RecordIdParser, maxRetries int, fn func(log string)) (int64, bool, error) {
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       key,
+		VersionId: versionId,
 	}
+	obj, err := getS3Object(ctx, s3Client, input, maxRetries)
+	if err != nil {
+		return 0, false, err
+	}
+	defer obj.Body.Close()
+
+	decompressed, compressed, err := decompressReader(obj.Body)
+	if err != nil {
+		if isCorruptGzip(err) {
+			return 0, compressed, &corruptObjectError{key: aws.StringValue(key), err: err}
+		}
+		return 0, compressed, fmt.Errorf("error to decompress s3 object %q: %w", aws.StringValue(key), err)
+	}
+	body := &countingReader{reader: decompressed}
+	scan := parser.scanLogs
+	// Parquet objects, e.g. converted by Firehose, are read by row rather than line by line
+	if parser.parquet {
+		scan = parser.readParquetLogs
+	}
+	if err := scan(body, fn); err != nil {
+		if compressed && isCorruptGzip(err) {
+			return body.count, compressed, &corruptObjectError{key: aws.StringValue(key), err: err}
+		}
+		return body.count, compressed, fmt.Errorf("error to read s3 object %q: %w", aws.StringValue(key), err)
+	}
+	return body.count, compressed, nil
+}
+
+// Error of a compressed object or local file whose gzip stream is corrupt, e.g. with a wrong checksum or an invalid header,
+// which is a delivery integrity problem rather than a failure to read the object
+type corruptObjectError struct {
+	key string
+	err error
+}
+
+func (e *corruptObjectError) Error() string {
+	return fmt.Sprintf("corrupt gzip stream in %q: %v", e.key, e.err)
+}
+
+func (e *corruptObjectError) Unwrap() error {
+	return e.err
+}
 
-	fmt.Println("total_s3_obj, ", s3ObjectCounter)
+// Returns true for the errors of a gzip stream which is corrupt. An unexpected EOF is not one of them: a connection
+// dropped while the object is read ends the same way as a stream cut short, and fails the read rather than being skipped.
+func isCorruptGzip(err error) bool {
+	var corruptInput flate.CorruptInputError
+	return errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || errors.As(err, &corruptInput)
+}
+
+// Returns a reader decompressing the data if it starts with the gzip magic number, otherwise the data as is.
+// The content of an object is checked rather than its key, since not every writer adds a ".gz" suffix.
+// Also returns whether the data is compressed.
+func decompressReader(reader io.Reader) (io.Reader, bool, error) {
+	buffered := bufio.NewReader(reader)
+	magic, err := buffered.Peek(2)
+	if err != nil || !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		// Objects shorter than the magic number can not be compressed, they are read as is
+		return buffered, false, nil
+	}
+	decompressed, err := gzip.NewReader(buffered)
+	return decompressed, true, err
+}
 
-	return s3RecordCounter, inputMap
+// Counts the bytes read from a reader
+type countingReader struct {
+	reader io.Reader
+	count  int64
 }
 
-// Retrieves an object from a S3 bucket
-func getS3Object(s3Client *s3.S3, input *s3.GetObjectInput) *s3.GetObjectOutput {
-	obj, err := s3Client.GetObject(input)
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// Retrieves an object from a S3 bucket, retrying throttling and server side errors up to maxRetries times
+func getS3Object(ctx context.Context, s3Client s3API, input *s3.GetObjectInput, maxRetries int) (*s3.GetObjectOutput, error) {
+	var obj *s3.GetObjectOutput
+	err := retryWithMaxRetries(ctx, maxRetries, func() error {
+		var err error
+		obj, err = s3Client.GetObjectWithContext(ctx, input)
+		return err
+	})
 
+	if isKMSAccessDenied(err) {
+		return nil, fmt.Errorf("access denied to s3 object %q encrypted with SSE-KMS, the validator is likely missing the kms:Decrypt permission on the key of the object: %w", aws.StringValue(input.Key), err)
+	}
 	if err != nil {
-		exitErrorf("[TEST FAILURE] Error occured to get s3 object: %v", err)
+		return nil, fmt.Errorf("error occured to get s3 object %q: %w", aws.StringValue(input.Key), err)
+	}
+
+	return obj, nil
+}
+
+// Returns true if S3 denied access to an object because its KMS key can not be used to decrypt it.
+// S3 reports it as AccessDenied, with a message naming KMS or the key instead of the usual "Access Denied".
+func isKMSAccessDenied(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	if strings.HasPrefix(awsErr.Code(), "KMS.") {
+		return true
 	}
+	message := strings.ToLower(awsErr.Message())
+	return awsErr.Code() == "AccessDenied" && (strings.Contains(message, "kms") || strings.Contains(message, "customer master key"))
+}
 
-	return obj
+// Subset of the CloudWatch Logs API used for validation, so that it can be mocked in tests
+type cwAPI interface {
+	GetLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.GetLogEventsInput, opts ...request.Option) (*cloudwatchlogs.GetLogEventsOutput, error)
+	DescribeLogStreamsPagesWithContext(ctx aws.Context, input *cloudwatchlogs.DescribeLogStreamsInput, fn func(*cloudwatchlogs.DescribeLogStreamsOutput, bool) bool, opts ...request.Option) error
+	StartQueryWithContext(ctx aws.Context, input *cloudwatchlogs.StartQueryInput, opts ...request.Option) (*cloudwatchlogs.StartQueryOutput, error)
+	GetQueryResultsWithContext(ctx aws.Context, input *cloudwatchlogs.GetQueryResultsInput, opts ...request.Option) (*cloudwatchlogs.GetQueryResultsOutput, error)
+	FilterLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, opts ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error)
+	DescribeLogGroupsWithContext(ctx aws.Context, input *cloudwatchlogs.DescribeLogGroupsInput, opts ...request.Option) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
 }
 
 // Creates a new CloudWatch Client
 func getCWClient(region string) (*cloudwatchlogs.CloudWatchLogs, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
+	sess, err := getSession(region)
 
 	if err != nil {
 		return nil, err
@@ -205,11 +1961,69 @@ func getCWClient(region string) (*cloudwatchlogs.CloudWatchLogs, error) {
 }
 
 // Validate logs in CloudWatch.
-// Similar logic as S3 validation.
-func validate_cloudwatch(cwClient *cloudwatchlogs.CloudWatchLogs, logGroup string, logStream string, inputMap map[string]bool) (int, map[string]bool) {
-	var forwardToken *string
+// Similar logic as S3 validation, including returning the records found so far once ctx is done.
+// Counts are summed across all the given log streams of the log group, which are paged concurrently by workerCount workers.
+// When ordering is not nil, the records of each stream are also checked for producer order.
+// Only the events with a timestamp within the window are read.
+// Each page holds up to cwLimit events, or as many as CloudWatch returns if it is zero.
+// With a cwLimiter, the GetLogEvents calls of all the log streams together are kept below its rate.
+// With a checkpoint, each log stream resumes from its last checkpoint and a new one is saved between pages.
+func validate_cloudwatch(ctx context.Context, cwClient cwAPI, logGroup string, logStreams []string, inputMap *RecordMap, settings *validatorSettings, progress *Progress) (int, error) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	cwRecoredCounter := 0
+
+	// Cancelled on the first error, so that the other workers stop early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Each worker pages through one log stream at a time
+	streams := make(chan string)
+	for i := 0; i < settings.workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for logStream := range streams {
+				// Drain the remaining streams without paging them once the run is over
+				if ctx.Err() != nil {
+					continue
+				}
+
+				streamRecordCounter, err := validate_cloudwatch_stream(ctx, cwClient, logGroup, logStream, inputMap, &mutex, settings, progress)
+
+				mutex.Lock()
+				cwRecoredCounter += streamRecordCounter
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, logStream := range logStreams {
+		select {
+		case streams <- logStream:
+		case <-ctx.Done():
+		}
+	}
+
+	close(streams)
+	wg.Wait()
+
+	return cwRecoredCounter, firstErr
+}
+
+// Validates the logs of a single log stream and returns the number of records found in it.
+// The mutex guards inputMap, delays, ordering and checkpoint, which are shared with the other streams.
+func validate_cloudwatch_stream(ctx context.Context, cwClient cwAPI, logGroup string, logStream string, inputMap *RecordMap, mutex *sync.Mutex, settings *validatorSettings, progress *Progress) (int, error) {
+	forwardToken := settings.checkpoint.forwardToken(logStream)
 	var input *cloudwatchlogs.GetLogEventsInput
+	var order orderChecker
 	cwRecoredCounter := 0
+	streamStart := time.Now()
 
 	// Returns all log events from a CloudWatch log group with the given log stream.
 	// This approach utilizes NextForwardToken to pull all log events from the CloudWatch log group.
@@ -219,6 +2033,8 @@ func validate_cloudwatch(cwClient *cloudwatchlogs.CloudWatchLogs, logGroup strin
 				LogGroupName:  aws.String(logGroup),
 				LogStreamName: aws.String(logStream),
 				StartFromHead: aws.Bool(true),
+				StartTime:     settings.window.startMillis(),
+				EndTime:       settings.window.endMillis(),
 			}
 		} else {
 			input = &cloudwatchlogs.GetLogEventsInput{
@@ -226,8 +2042,13 @@ func validate_cloudwatch(cwClient *cloudwatchlogs.CloudWatchLogs, logGroup strin
 				LogStreamName: aws.String(logStream),
 				NextToken:     forwardToken,
 				StartFromHead: aws.Bool(true),
+				StartTime:     settings.window.startMillis(),
+				EndTime:       settings.window.endMillis(),
 			}
 		}
+		if settings.cwLimit > 0 {
+			input.Limit = aws.Int64(settings.cwLimit)
+		}
 
 		/*
 		 * In testing we have found that CW GetLogEvents results are highly inconsistent
@@ -235,30 +2056,78 @@ func validate_cloudwatch(cwClient *cloudwatchlogs.CloudWatchLogs, logGroup strin
 		 * first calculated. So we sleep between calls to ensure we never exceed 1 TPS
 		 * load_test.py also has a sleep before validation runs.
 		 */
-		time.Sleep(1 * time.Second)
-
-		response, err := cwClient.GetLogEvents(input)
-		for err != nil {
-			// retry for throttling exception
-			if strings.Contains(err.Error(), "ThrottlingException: Rate exceeded") {
-				time.Sleep(1 * time.Second)
-				response, err = cwClient.GetLogEvents(input)
-			} else {
-				exitErrorf("[TEST FAILURE] Error occured to get the log events from log group: %q., %v", logGroup, err)
+		if !sleepWithContext(ctx, cwRequestPeriod) {
+			break
+		}
+
+		var response *cloudwatchlogs.GetLogEventsOutput
+		// retry for throttling exception and server side errors
+		err := retryWithBackoff(ctx, func() error {
+			// Retries count against the rate limit as well
+			if settings.cwLimiter != nil && !sleepWithContext(ctx, settings.cwLimiter.Reserve().Delay()) {
+				return ctx.Err()
+			}
+			var err error
+			response, err = cwClient.GetLogEventsWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
 			}
+			return cwRecoredCounter, fmt.Errorf("error occured to get the log events of stream %q from log group %q: %w", logStream, logGroup, err)
 		}
 
+		logrus.Infof("Read %d events from log stream %q", len(response.Events), logStream)
+
+		// Parse outside of the lock, the ingestion time is the time the record arrived in CloudWatch
+		recordIds := make([]string, 0, len(response.Events))
+		recordTimings := make([]recordTiming, 0, len(response.Events))
+		var arrivals []time.Time
 		for _, event := range response.Events {
 			log := aws.StringValue(event.Message)
 
-			// First 8 char is the unique record ID
-			recordId := log[:8]
-			cwRecoredCounter += 1
-			if _, ok := inputMap[recordId]; ok {
-				// Setting true to indicate that this record was found in the destination
-				inputMap[recordId] = true
+			recordId, ok := settings.parser.parse(log)
+			if !ok {
+				// Skip logs without a record ID (count them as lost logs) and foreign records
+				continue
+			}
+			settings.audit.add(recordId, "cloudwatch://%s/%s@%d", logGroup, logStream, aws.Int64Value(event.Timestamp))
+			recordIds = append(recordIds, recordId)
+			if timestamp, ok := settings.parser.timestamp(log); ok {
+				recordTimings = append(recordTimings, recordTiming{recordId: recordId, produced: timestamp, arrived: aws.MillisecondsTimeValue(event.IngestionTime)})
+			} else {
+				arrivals = append(arrivals, aws.MillisecondsTimeValue(event.IngestionTime))
+			}
+			order.check(recordId)
+		}
+
+		mutex.Lock()
+		firstFound := 0
+		for _, recordId := range recordIds {
+			// Counting the occurrences of this record in the destination
+			if countRecord(inputMap, recordId, 1, settings.parser) {
+				firstFound++
+			}
+		}
+		settings.failFast.found(firstFound)
+		for _, timing := range recordTimings {
+			settings.delays.addRecord(timing)
+		}
+		for _, arrived := range arrivals {
+			settings.delays.addArrival(arrived)
+		}
+		settings.checkpoint.add(len(recordIds))
+		settings.checkpoint.cwPage(logStream, response.NextForwardToken)
+		if settings.checkpoint.due() {
+			if err := settings.checkpoint.save(inputMap, settings.parser); err != nil {
+				logrus.Warnf("Unable to save the checkpoint: %v", err)
 			}
 		}
+		mutex.Unlock()
+
+		cwRecoredCounter += len(recordIds)
+		progress.add(len(recordIds), len(response.Events))
 
 		// Same NextForwardToken will be returned if we reach the end of the log stream
 		if aws.StringValue(response.NextForwardToken) == aws.StringValue(forwardToken) {
@@ -268,30 +2137,504 @@ func validate_cloudwatch(cwClient *cloudwatchlogs.CloudWatchLogs, logGroup strin
 		forwardToken = response.NextForwardToken
 	}
 
-	return cwRecoredCounter, inputMap
+	logrus.Infof("Found %d records in log stream %q in %s", cwRecoredCounter, logStream, time.Since(streamStart).Round(time.Millisecond))
+
+	if settings.ordering != nil {
+		mutex.Lock()
+		settings.ordering.add(logStream, order.outOfOrder)
+		mutex.Unlock()
+	}
+
+	return cwRecoredCounter, nil
+}
+
+// Returns the names of all log streams in the log group starting with the given prefix
+func getCWLogStreams(ctx context.Context, cwClient cwAPI, logGroup string, streamPrefix string) ([]string, error) {
+	var logStreams []string
+
+	err := cwClient.DescribeLogStreamsPagesWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(logGroup),
+		LogStreamNamePrefix: aws.String(streamPrefix),
+	}, func(page *cloudwatchlogs.DescribeLogStreamsOutput, lastPage bool) bool {
+		for _, logStream := range page.LogStreams {
+			logStreams = append(logStreams, aws.StringValue(logStream.LogStreamName))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error occured to describe the log streams of log group %q: %w", logGroup, err)
+	}
+
+	return logStreams, nil
+}
+
+// Counts and labels of the validation of a destination, which its benchmark results are computed from
+type resultInputs struct {
+	// Only set when there are several destinations
+	destination      string
+	totalInputRecord int
+	totalRecordFound int
+	recordMap        *RecordMap
+	unparseable      int
+	malformed        int
+	foreign          int
+	logDelay         string
+	delays           *DelayStats
+	// nil unless the ordering is checked
+	ordering *OrderStats
+	// nil for destinations without S3 objects
+	objects      *s3Totals
+	logGroups    []LogGroupRecords
+	errorRecords *RecordMap
+	payloads     *PayloadCounts
+	retries      RetryStats
+	// Below 1 when only a sample of the input records was validated
+	sampleRate float64
+	// Time until every input record was found when polling, 0 otherwise
+	completion time.Duration
+	// The validation stopped before reading the whole destination
+	partial bool
+	// Account and region the destination was validated in, nil if unknown
+	identity *AWSIdentity
+}
+
+// Computes the benchmark results and prints them in the output format.
+// Partial results are labelled as such, since the records not read yet are counted as lost.
+func get_results(inputs resultInputs, outputFormat string) Results {
+	results := computeResults(inputs)
+	results.Partial = inputs.partial
+	if inputs.identity != nil {
+		results.Account = inputs.identity.Account
+		results.Region = inputs.identity.Region
+	}
+	if inputs.completion > 0 {
+		completionMs := inputs.completion.Milliseconds()
+		results.CompletionMs = &completionMs
+	}
+	print_results(results, outputFormat)
+	return results
 }
 
-func get_results(totalInputRecord int, totalRecordFound int, recordMap map[string]bool, logDelay string) {
+// Computes the benchmark results from the counts of a validation, without printing them
+func computeResults(inputs resultInputs) Results {
 	uniqueRecordFound := 0
-	// Count how many unique records were found in the destination
-	for _, v := range recordMap {
-		if v {
+	deliveries := make(map[int]int)
+	maxDeliveries := 0
+	// Count how many unique records were found in the destination, and how often each of them was delivered
+	inputs.recordMap.each(func(recordId string, occurrences int) {
+		if occurrences > 0 {
 			uniqueRecordFound++
 		}
+		deliveries[occurrences]++
+		if occurrences > maxDeliveries {
+			maxDeliveries = occurrences
+		}
+	})
+
+	// With a sample, the counts of the sampled records stand for the counts of all the input records
+	if inputs.sampleRate < 1 && inputs.recordMap.len() > 0 {
+		scale := float64(inputs.totalInputRecord) / float64(inputs.recordMap.len())
+		uniqueRecordFound = int(math.Round(float64(uniqueRecordFound) * scale))
+		for occurrences, records := range deliveries {
+			deliveries[occurrences] = int(math.Round(float64(records) * scale))
+		}
 	}
 
-	fmt.Println("total_input, ", totalInputRecord)
-	fmt.Println("total_destination, ", totalRecordFound)
-	fmt.Println("unique, ", uniqueRecordFound)
-	fmt.Println("duplicate, ", (totalRecordFound - uniqueRecordFound))
-	fmt.Println("delay, ", logDelay)
-	fmt.Println("percent_loss, ", (totalInputRecord-uniqueRecordFound)*100/totalInputRecord) // %
+	results := Results{
+		Destination:        inputs.destination,
+		TotalInput:         inputs.totalInputRecord,
+		TotalDestination:   inputs.totalRecordFound,
+		Unique:             uniqueRecordFound,
+		Duplicate:          inputs.totalRecordFound - uniqueRecordFound,
+		Delay:              inputs.logDelay,
+		DelaySamples:       inputs.delays.count,
+		DelayMinMs:         inputs.delays.min.Milliseconds(),
+		DelayAvgMs:         inputs.delays.average().Milliseconds(),
+		DelayP50Ms:         inputs.delays.percentile(50).Milliseconds(),
+		DelayP90Ms:         inputs.delays.percentile(90).Milliseconds(),
+		DelayP99Ms:         inputs.delays.percentile(99).Milliseconds(),
+		DelayMaxMs:         inputs.delays.max.Milliseconds(),
+		DelaySampled:       inputs.delays.sampled(),
+		DelayJitterMs:      math.Round(float64(inputs.delays.jitter())/float64(time.Millisecond)*100) / 100,
+		DelayHistogram:     inputs.delays.histogram(),
+		ClockSkewRecords:   inputs.delays.skewed,
+		ClockSkewAvgMs:     inputs.delays.averageSkew().Milliseconds(),
+		ClockSkewMaxMs:     inputs.delays.skewMax.Milliseconds(),
+		Missing:            inputs.totalInputRecord - uniqueRecordFound,
+		DeliveredOnce:      deliveries[1],
+		DeliveredTwice:     deliveries[2],
+		DeliveredThreePlus: uniqueRecordFound - deliveries[1] - deliveries[2],
+		MaxDeliveries:      maxDeliveries,
+		Unparseable:        inputs.unparseable,
+		Malformed:          inputs.malformed,
+		Foreign:            inputs.foreign,
+		ThroughputSpanMs:   inputs.delays.span().Milliseconds(),
+		Retries:            int(inputs.retries.retries),
+		RetryBackoffMs:     time.Duration(inputs.retries.backoff).Milliseconds(),
+	}
+	if inputs.sampleRate < 1 {
+		results.SampleRate = inputs.sampleRate
+		// The records found outside of the sample may not make up for the extrapolated ones
+		if results.Duplicate < 0 {
+			results.Duplicate = 0
+		}
+	}
 
-	if totalInputRecord != uniqueRecordFound {
-		fmt.Println("missing, ", totalInputRecord-uniqueRecordFound)
-	} else {
-		fmt.Println("missing, ", 0)
+	// Nothing can be lost without input records
+	if inputs.totalInputRecord > 0 {
+		results.PercentLoss = float64(inputs.totalInputRecord-uniqueRecordFound) * 100 / float64(inputs.totalInputRecord) // %
+	}
+
+	// A single record, or records without timestamps, have no span to measure the throughput over
+	if span := inputs.delays.span(); span > 0 {
+		results.ThroughputRecordsSec = math.Round(float64(inputs.totalRecordFound)/span.Seconds()*100) / 100
+	}
+
+	results.CWLogGroups = inputs.logGroups
+
+	// The content read is larger than the stored objects when they are compressed
+	if inputs.objects != nil {
+		results.S3Objects = &inputs.objects.objects
+		results.S3Bytes = &inputs.objects.bytes
+		results.S3Buckets = inputs.objects.buckets
+		results.S3Versions = inputs.objects.versions
+		var averageBytes int64
+		if inputs.objects.objects > 0 {
+			averageBytes = inputs.objects.bytes / int64(inputs.objects.objects)
+		}
+		results.S3AvgObjectBytes = &averageBytes
+		if inputs.objects.gzipObjects+inputs.objects.plainObjects > 0 {
+			results.S3GzipObjects = &inputs.objects.gzipObjects
+			results.S3PlainObjects = &inputs.objects.plainObjects
+		}
+		if len(inputs.objects.corruptObjects) > 0 {
+			corruptObjects := len(inputs.objects.corruptObjects)
+			results.S3CorruptObjects = &corruptObjects
+			results.S3CorruptKeys = inputs.objects.corruptObjects
+		}
+		if perObject := inputs.objects.perObject; perObject.objects > 0 {
+			average := perObject.average()
+			results.S3ObjectRecordsMin = &perObject.min
+			results.S3ObjectRecordsMax = &perObject.max
+			results.S3ObjectRecordsAvg = &average
+			results.S3ObjectRecordsHistogram = perObject.histogram()
+		}
+		if inputs.objects.bytes > 0 && inputs.objects.contentBytes > 0 {
+			ratio := math.Round(float64(inputs.objects.contentBytes)/float64(inputs.objects.bytes)*100) / 100
+			results.S3CompressionRatio = &ratio
+		}
+	}
+
+	// Records found in the error output were rejected by the destination rather than lost on the way
+	if inputs.errorRecords != nil {
+		errorFound := 0
+		inputs.errorRecords.each(func(recordId string, occurrences int) {
+			if occurrences > 0 {
+				errorFound++
+			}
+		})
+		results.ErrorDestination = &errorFound
+	}
+
+	if inputs.payloads != nil {
+		results.PayloadTruncated = &inputs.payloads.Truncated
+		results.PayloadCorrupted = &inputs.payloads.Corrupted
+	}
+
+	// The arrivals are compared against the producer window to spot clock skew or records flushed late
+	if !inputs.delays.firstArrival.IsZero() {
+		results.FirstArrival = inputs.delays.firstArrival.UTC().Format(arrivalLayout)
+		results.LastArrival = inputs.delays.lastArrival.UTC().Format(arrivalLayout)
+	}
+
+	if inputs.ordering != nil {
+		outOfOrder := inputs.ordering.total()
+		results.OutOfOrder = &outOfOrder
+		results.OutOfOrderStreams = inputs.ordering.streams()
+	}
+
+	return results
+}
+
+// Formats a percentage with two decimals, e.g. "0.42".
+// Losses too small for two decimals keep two significant digits instead, so that they never show as zero.
+func formatPercent(percent float64) string {
+	if percent > 0 && percent < 0.005 {
+		decimals := 1 - int(math.Floor(math.Log10(percent)))
+		return strconv.FormatFloat(percent, 'f', decimals, 64)
+	}
+	return strconv.FormatFloat(percent, 'f', 2, 64)
+}
+
+// Prints the results as a JSON object, or as one "key, value" line per result
+func print_results(results Results, outputFormat string) {
+	if outputFormat == "json" {
+		output, err := json.Marshal(results)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to marshal the results: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	if results.Destination != "" {
+		fmt.Println("destination, ", results.Destination)
+	}
+	if results.Account != "" {
+		fmt.Println("account, ", results.Account)
+		fmt.Println("region, ", results.Region)
+	}
+	fmt.Println("total_input, ", results.TotalInput)
+	fmt.Println("total_destination, ", results.TotalDestination)
+	fmt.Println("unique, ", results.Unique)
+	fmt.Println("duplicate, ", results.Duplicate)
+	fmt.Println("delay, ", results.Delay)
+	fmt.Println("delay_samples, ", results.DelaySamples)
+	fmt.Println("delay_min_ms, ", results.DelayMinMs)
+	fmt.Println("delay_avg_ms, ", results.DelayAvgMs)
+	fmt.Println("delay_p50_ms, ", results.DelayP50Ms)
+	fmt.Println("delay_p90_ms, ", results.DelayP90Ms)
+	fmt.Println("delay_p99_ms, ", results.DelayP99Ms)
+	fmt.Println("delay_max_ms, ", results.DelayMaxMs)
+	fmt.Println("delay_jitter_ms, ", results.DelayJitterMs)
+	if results.DelaySampled {
+		fmt.Println("delay_sampled, ", results.DelaySampled)
+	}
+	// A bar per bucket after its count, scaled to the fullest bucket
+	fullest := 0
+	for _, bucket := range results.DelayHistogram {
+		if bucket.Count > fullest {
+			fullest = bucket.Count
+		}
+	}
+	for _, bucket := range results.DelayHistogram {
+		bar := ""
+		if fullest > 0 {
+			bar = " " + strings.Repeat("#", (bucket.Count*histogramWidth+fullest-1)/fullest)
+		}
+		fmt.Printf("delay_histogram_%s,  %d%s\n", bucket.Bucket, bucket.Count, bar)
+	}
+	fmt.Println("clock_skew_records, ", results.ClockSkewRecords)
+	fmt.Println("clock_skew_avg_ms, ", results.ClockSkewAvgMs)
+	fmt.Println("clock_skew_max_ms, ", results.ClockSkewMaxMs)
+	fmt.Println("percent_loss, ", formatPercent(results.PercentLoss))
+	fmt.Println("missing, ", results.Missing)
+	fmt.Println("delivered_once, ", results.DeliveredOnce)
+	fmt.Println("delivered_twice, ", results.DeliveredTwice)
+	fmt.Println("delivered_3_plus, ", results.DeliveredThreePlus)
+	fmt.Println("max_deliveries, ", results.MaxDeliveries)
+	fmt.Println("unparseable, ", results.Unparseable)
+	fmt.Println("malformed, ", results.Malformed)
+	fmt.Println("foreign, ", results.Foreign)
+	fmt.Println("throughput_span_ms, ", results.ThroughputSpanMs)
+	fmt.Println("throughput_records_per_sec, ", results.ThroughputRecordsSec)
+	fmt.Println("retries, ", results.Retries)
+	fmt.Println("retry_backoff_ms, ", results.RetryBackoffMs)
+	if results.FirstArrival != "" {
+		fmt.Println("first_arrival, ", results.FirstArrival)
+		fmt.Println("last_arrival, ", results.LastArrival)
+	}
+	if results.OutOfOrder != nil {
+		fmt.Println("out_of_order, ", *results.OutOfOrder)
+	}
+	for _, stream := range results.OutOfOrderStreams {
+		fmt.Println("out_of_order_"+stream.Stream+", ", stream.OutOfOrder)
+	}
+	if results.S3Objects != nil {
+		fmt.Println("s3_objects, ", *results.S3Objects)
+		fmt.Println("s3_bytes, ", *results.S3Bytes)
+		fmt.Println("s3_avg_object_bytes, ", *results.S3AvgObjectBytes)
+	}
+	if results.S3GzipObjects != nil {
+		fmt.Println("s3_gzip_objects, ", *results.S3GzipObjects)
+		fmt.Println("s3_plain_objects, ", *results.S3PlainObjects)
+	}
+	if results.S3CorruptObjects != nil {
+		fmt.Println("s3_corrupt_objects, ", *results.S3CorruptObjects)
+		for _, location := range results.S3CorruptKeys {
+			fmt.Println("s3_corrupt_object, ", location)
+		}
+	}
+	if results.S3ObjectRecordsAvg != nil {
+		fmt.Println("s3_object_records_min, ", *results.S3ObjectRecordsMin)
+		fmt.Println("s3_object_records_max, ", *results.S3ObjectRecordsMax)
+		fmt.Println("s3_object_records_avg, ", *results.S3ObjectRecordsAvg)
+	}
+	for _, bucket := range results.S3ObjectRecordsHistogram {
+		fmt.Println("s3_object_records_histogram_"+bucket.Bucket+", ", bucket.Count)
+	}
+	for _, bucket := range results.S3Buckets {
+		fmt.Println("s3_objects_"+bucket.Bucket+", ", bucket.Objects)
+	}
+	for _, version := range results.S3Versions {
+		fmt.Println("s3_version_records_"+version.Key+"@"+version.VersionId+", ", version.Records)
+	}
+	for _, logGroup := range results.CWLogGroups {
+		fmt.Println("cw_records_"+logGroup.LogGroup+", ", logGroup.Records)
+	}
+	if results.S3CompressionRatio != nil {
+		fmt.Println("s3_compression_ratio, ", *results.S3CompressionRatio)
+	}
+	if results.SampleRate != 0 {
+		fmt.Println("sample_rate, ", results.SampleRate)
+	}
+	if results.ErrorDestination != nil {
+		fmt.Println("error_destination, ", *results.ErrorDestination)
+	}
+	if results.PayloadTruncated != nil {
+		fmt.Println("payload_truncated, ", *results.PayloadTruncated)
+		fmt.Println("payload_corrupted, ", *results.PayloadCorrupted)
+	}
+	if results.CompletionMs != nil {
+		fmt.Println("completion_ms, ", *results.CompletionMs)
+	}
+	if results.Partial {
+		fmt.Println("partial, ", results.Partial)
+	}
+}
+
+// Writes the ID of every record which was not found in the destination to a file, one per line.
+// IDs are streamed straight from the map so a large loss does not need another copy of them in memory.
+func writeMissingRecords(path string, recordMap *RecordMap) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	recordMap.each(func(recordId string, occurrences int) {
+		if occurrences > 0 || err != nil {
+			return
+		}
+		_, err = writer.WriteString(recordId + "\n")
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Reads the IDs of the records sent by the producer from a file with one ID per line, e.g. as written to MISSING_RECORDS_FILE.
+// Blank lines are skipped, and IDs listed more than once are only returned once.
+func readExpectedIds(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var recordIds []string
+	seen := make(map[string]bool)
+	duplicates := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		recordId := strings.TrimSpace(scanner.Text())
+		if recordId == "" {
+			continue
+		}
+		if seen[recordId] {
+			duplicates++
+			continue
+		}
+		seen[recordId] = true
+		recordIds = append(recordIds, recordId)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if duplicates > 0 {
+		logrus.Warnf("Skipped %d record IDs listed more than once in %s", duplicates, path)
+	}
+	return recordIds, nil
+}
+
+// Returns the record IDs of the expected payloads, each a full log sent by the producer, and the payload of every ID.
+// Payloads whose record ID was already seen are skipped, the first one is verified.
+func expectedPayloads(payloads []string, parser *RecordIdParser) ([]string, map[string]string, error) {
+	recordIds := make([]string, 0, len(payloads))
+	byId := make(map[string]string, len(payloads))
+	duplicates := 0
+	for _, payload := range payloads {
+		recordId, ok := parser.recordId(payload)
+		if !ok {
+			return nil, nil, fmt.Errorf("no record ID in payload %q", payload)
+		}
+		if _, ok := byId[recordId]; ok {
+			duplicates++
+			continue
+		}
+		byId[recordId] = payload
+		recordIds = append(recordIds, recordId)
+	}
+
+	if duplicates > 0 {
+		logrus.Warnf("Skipped %d payloads with a record ID listed more than once", duplicates)
+	}
+	return recordIds, byId, nil
+}
+
+// Returns true if the log delay is a duration, a number or logDelayNotSupported
+func isValidLogDelay(value string) bool {
+	if value == logDelayNotSupported {
+		return true
+	}
+	if _, err := time.ParseDuration(value); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// Returns the wait before the destinations are read, none if the value is empty
+func parseInitialWait(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if wait < 0 {
+		return 0, fmt.Errorf("negative wait %s", wait)
+	}
+	return wait, nil
+}
+
+// Waits for the pipeline to flush the records in flight. Returns false if the context was done before the wait was over.
+func waitInitially(ctx context.Context, wait time.Duration) bool {
+	if wait <= 0 {
+		return true
+	}
+	logrus.Infof("Waiting %s for the pipeline to flush before validating", wait)
+	return sleepWithContext(ctx, wait)
+}
+
+// Returns how far actual deviates from expected, in percent of expected
+func percentDeviation(actual int, expected int) float64 {
+	if expected == 0 {
+		if actual == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(float64(actual-expected)) * 100 / float64(expected)
+}
+
+// Splits a comma separated list, ignoring surrounding spaces and empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
 
 func exitErrorf(msg string, args ...interface{}) {
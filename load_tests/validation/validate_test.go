@@ -0,0 +1,971 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// Returns the log entries written by our producer for the given record IDs, one JSON object per line
+func producerLogs(recordIds ...string) []string {
+	logs := make([]string, 0, len(recordIds))
+	for _, recordId := range recordIds {
+		logs = append(logs, fmt.Sprintf("%s_1639151827578_RandomString", recordId))
+	}
+	return logs
+}
+
+func newInputMap(totalInputRecord int) *RecordMap {
+	return newSequentialRecordMap(idCounterBase, totalInputRecord, nil, 1)
+}
+
+// Stored size of every object listed by mockS3, as if they were compressed
+const mockObjectSize = 20
+
+// Serves objects page by page, failing the first GetObject calls of a key with the given errors
+type mockS3 struct {
+	s3API
+	mutex   sync.Mutex
+	pages   [][]string
+	objects map[string][]string
+	errors  map[string][]error
+	// Objects are served compressed with gzip, without a content encoding
+	gzip bool
+}
+
+func (m *mockS3) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	page := 0
+	if input.ContinuationToken != nil {
+		page, _ = strconv.Atoi(aws.StringValue(input.ContinuationToken))
+	}
+
+	output := &s3.ListObjectsV2Output{
+		IsTruncated: aws.Bool(page+1 < len(m.pages)),
+	}
+	if page+1 < len(m.pages) {
+		output.NextContinuationToken = aws.String(strconv.Itoa(page + 1))
+	}
+	for _, key := range m.pages[page] {
+		output.Contents = append(output.Contents, &s3.Object{
+			Key:          aws.String(key),
+			LastModified: aws.Time(time.Unix(1639151837, 578000000)),
+			Size:         aws.Int64(mockObjectSize),
+		})
+	}
+	return output, nil
+}
+
+func (m *mockS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if errs := m.errors[key]; len(errs) > 0 {
+		m.errors[key] = errs[1:]
+		return nil, errs[0]
+	}
+
+	var body string
+	for _, log := range m.objects[key] {
+		body += fmt.Sprintf("{\"log\":%q}\n", log)
+	}
+	if m.gzip {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		writer.Write([]byte(body))
+		writer.Close()
+		body = compressed.String()
+	}
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func TestValidateS3(t *testing.T) {
+	throttled := awserr.New("SlowDown", "Please reduce your request rate.", nil)
+
+	tests := []struct {
+		name             string
+		prefixes         []string
+		window           TimeWindow
+		pages            [][]string
+		objects          map[string][]string
+		errors           map[string][]error
+		totalInput       int
+		expectedFound    int
+		expectedMissing  int
+		expectedMaxCount int
+		expectedObjects  int
+		expectedError    bool
+	}{
+		{
+			name:             "all records present",
+			pages:            [][]string{{"a", "b"}},
+			objects:          map[string][]string{"a": producerLogs("10000000", "10000001"), "b": producerLogs("10000002")},
+			totalInput:       3,
+			expectedFound:    3,
+			expectedMaxCount: 1,
+			expectedObjects:  2,
+		},
+		{
+			name:             "partial loss",
+			pages:            [][]string{{"a"}},
+			objects:          map[string][]string{"a": producerLogs("10000000", "10000002")},
+			totalInput:       3,
+			expectedFound:    2,
+			expectedMissing:  1,
+			expectedMaxCount: 1,
+			expectedObjects:  1,
+		},
+		{
+			name:             "duplicates",
+			pages:            [][]string{{"a", "b"}},
+			objects:          map[string][]string{"a": producerLogs("10000000", "10000001"), "b": producerLogs("10000001", "10000001")},
+			totalInput:       2,
+			expectedFound:    4,
+			expectedMaxCount: 3,
+			expectedObjects:  2,
+		},
+		{
+			name:             "pagination",
+			pages:            [][]string{{"a"}, {"b"}, {"c"}},
+			objects:          map[string][]string{"a": producerLogs("10000000"), "b": producerLogs("10000001"), "c": producerLogs("10000002")},
+			totalInput:       3,
+			expectedFound:    3,
+			expectedMaxCount: 1,
+			expectedObjects:  3,
+		},
+		{
+			name:             "overlapping prefixes",
+			prefixes:         []string{"prefix", "prefix/nested"},
+			pages:            [][]string{{"a", "b"}},
+			objects:          map[string][]string{"a": producerLogs("10000000"), "b": producerLogs("10000001")},
+			totalInput:       2,
+			expectedFound:    2,
+			expectedMaxCount: 1,
+			expectedObjects:  2,
+		},
+		{
+			name:             "objects outside of the time window",
+			window:           TimeWindow{start: time.Unix(1639151837, 578000000).Add(time.Minute)},
+			pages:            [][]string{{"a"}},
+			objects:          map[string][]string{"a": producerLogs("10000000")},
+			totalInput:       1,
+			expectedFound:    0,
+			expectedMissing:  1,
+			expectedMaxCount: 0,
+			expectedObjects:  0,
+		},
+		{
+			name:             "throttling retry",
+			pages:            [][]string{{"a"}},
+			objects:          map[string][]string{"a": producerLogs("10000000", "10000001")},
+			errors:           map[string][]error{"a": {throttled, throttled}},
+			totalInput:       2,
+			expectedFound:    2,
+			expectedMaxCount: 1,
+			expectedObjects:  1,
+		},
+		{
+			name:          "non retryable error",
+			pages:         [][]string{{"a"}},
+			objects:       map[string][]string{},
+			errors:        map[string][]error{"a": {awserr.New("AccessDenied", "Access Denied", nil)}},
+			totalInput:    1,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &mockS3{
+				pages:   test.pages,
+				objects: test.objects,
+				errors:  test.errors,
+			}
+			if client.errors == nil {
+				client.errors = map[string][]error{}
+			}
+			prefixes := test.prefixes
+			if prefixes == nil {
+				prefixes = []string{"prefix"}
+			}
+			inputMap := newInputMap(test.totalInput)
+			delays := &DelayStats{}
+
+			found, objects, err := validate_s3(context.Background(), client, "bucket", prefixes, inputMap, &validatorSettings{
+				window:       test.window,
+				workerCount:  2,
+				s3MaxRetries: retryMaxRetries,
+				parser:       newRecordIdParser(defaultRecordIdLength),
+				delays:       delays,
+			}, nil)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedFound, found)
+			assert.Equal(t, test.expectedObjects, objects.objects)
+
+			missing, maxCount := 0, 0
+			inputMap.each(func(recordId string, count int) {
+				if count == 0 {
+					missing++
+				}
+				if count > maxCount {
+					maxCount = count
+				}
+			})
+			assert.Equal(t, test.expectedMissing, missing)
+			assert.Equal(t, test.expectedMaxCount, maxCount)
+			assert.Equal(t, found, delays.count)
+			if found > 0 {
+				assert.Equal(t, 10*time.Second, delays.max)
+			}
+		})
+	}
+}
+
+// Serves the events of each log stream page by page, failing the first GetLogEvents calls with the given errors
+type mockCloudWatch struct {
+	cwAPI
+	mutex   sync.Mutex
+	streams map[string][][]string
+	errors  []error
+}
+
+func (m *mockCloudWatch) GetLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.GetLogEventsInput, opts ...request.Option) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.errors) > 0 {
+		err := m.errors[0]
+		m.errors = m.errors[1:]
+		return nil, err
+	}
+
+	pages := m.streams[aws.StringValue(input.LogStreamName)]
+	page := 0
+	if input.NextToken != nil {
+		page, _ = strconv.Atoi(aws.StringValue(input.NextToken))
+	}
+
+	// The same token is returned once the end of the stream is reached
+	if page >= len(pages) {
+		return &cloudwatchlogs.GetLogEventsOutput{
+			NextForwardToken: input.NextToken,
+		}, nil
+	}
+
+	output := &cloudwatchlogs.GetLogEventsOutput{
+		NextForwardToken: aws.String(strconv.Itoa(page + 1)),
+	}
+	for _, log := range pages[page] {
+		output.Events = append(output.Events, &cloudwatchlogs.OutputLogEvent{
+			Message:       aws.String(log),
+			IngestionTime: aws.Int64(1639151837578),
+		})
+	}
+	return output, nil
+}
+
+func TestValidateCloudWatch(t *testing.T) {
+	cwRequestPeriod = 0
+	defer func() { cwRequestPeriod = 1 * time.Second }()
+
+	tests := []struct {
+		name            string
+		streams         map[string][][]string
+		errors          []error
+		totalInput      int
+		expectedFound   int
+		expectedMissing int
+		expectedError   bool
+	}{
+		{
+			name:          "all records present",
+			streams:       map[string][][]string{"stream": {producerLogs("10000000", "10000001", "10000002")}},
+			totalInput:    3,
+			expectedFound: 3,
+		},
+		{
+			name:            "partial loss",
+			streams:         map[string][][]string{"stream": {producerLogs("10000000")}},
+			totalInput:      3,
+			expectedFound:   1,
+			expectedMissing: 2,
+		},
+		{
+			name:          "duplicates",
+			streams:       map[string][][]string{"stream": {producerLogs("10000000", "10000000", "10000001")}},
+			totalInput:    2,
+			expectedFound: 3,
+		},
+		{
+			name:          "pagination",
+			streams:       map[string][][]string{"stream": {producerLogs("10000000"), producerLogs("10000001"), producerLogs("10000002")}},
+			totalInput:    3,
+			expectedFound: 3,
+		},
+		{
+			name: "multiple streams",
+			streams: map[string][][]string{
+				"stream-1": {producerLogs("10000000"), producerLogs("10000001")},
+				"stream-2": {producerLogs("10000002", "10000003")},
+				"stream-3": {producerLogs("10000001")},
+				"stream-4": {},
+			},
+			totalInput:    5,
+			expectedFound: 5,
+			// 10000004 is in none of the streams
+			expectedMissing: 1,
+		},
+		{
+			name:          "throttling retry",
+			streams:       map[string][][]string{"stream": {producerLogs("10000000", "10000001")}},
+			errors:        []error{awserr.New("ThrottlingException", "Rate exceeded", nil)},
+			totalInput:    2,
+			expectedFound: 2,
+		},
+		{
+			name:          "non retryable error",
+			streams:       map[string][][]string{"stream": {producerLogs("10000000")}},
+			errors:        []error{awserr.New("ResourceNotFoundException", "The specified log stream does not exist.", nil)},
+			totalInput:    1,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &mockCloudWatch{
+				streams: test.streams,
+				errors:  test.errors,
+			}
+			var logStreams []string
+			for logStream := range test.streams {
+				logStreams = append(logStreams, logStream)
+			}
+			inputMap := newInputMap(test.totalInput)
+			delays := &DelayStats{}
+
+			found, err := validate_cloudwatch(context.Background(), client, "group", logStreams, inputMap, &validatorSettings{
+				workerCount: 2,
+				parser:      newRecordIdParser(defaultRecordIdLength),
+				delays:      delays,
+			}, nil)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedFound, found)
+
+			missing := 0
+			inputMap.each(func(recordId string, count int) {
+				if count == 0 {
+					missing++
+				}
+			})
+			assert.Equal(t, test.expectedMissing, missing)
+			assert.Equal(t, found, delays.count)
+			assert.Equal(t, 10*time.Second, delays.max)
+		})
+	}
+}
+
+func TestValidateCloudWatchRateLimit(t *testing.T) {
+	cwRequestPeriod = 0
+	defer func() { cwRequestPeriod = 1 * time.Second }()
+
+	// Two calls per stream, the last one returning the same token, shared by both streams
+	client := &mockCloudWatch{
+		streams: map[string][][]string{"a": {producerLogs("10000000")}, "b": {producerLogs("10000001")}},
+	}
+	start := time.Now()
+	found, err := validate_cloudwatch(context.Background(), client, "group", []string{"a", "b"}, newInputMap(2), &validatorSettings{
+		workerCount: 2,
+		cwLimiter:   rate.NewLimiter(20, 1),
+		parser:      newRecordIdParser(defaultRecordIdLength),
+		delays:      &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found)
+	assert.True(t, time.Since(start) >= 140*time.Millisecond, "4 calls at 20 per second took %s", time.Since(start))
+}
+
+func TestGetResults(t *testing.T) {
+	// Test case 1: partial loss with a duplicate
+	inputMap := newInputMap(4)
+	inputMap.set("10000000", 2)
+	inputMap.set("10000001", 1)
+	results := get_results(resultInputs{
+		totalInputRecord: 4,
+		totalRecordFound: 3,
+		recordMap:        inputMap,
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		sampleRate:       1,
+	}, "json")
+	assert.Equal(t, 2, results.Unique)
+	assert.Equal(t, 1, results.Duplicate)
+	assert.Equal(t, 50.0, results.PercentLoss)
+	assert.Equal(t, 2, results.Missing)
+
+	// Test case 2: no input records does not divide by zero
+	results = get_results(resultInputs{
+		recordMap:  recordMapOf(map[string]int{}),
+		logDelay:   "1ms",
+		delays:     &DelayStats{},
+		sampleRate: 1,
+	}, "json")
+	assert.Equal(t, 0.0, results.PercentLoss)
+	assert.Equal(t, 0, results.Missing)
+
+	// Test case 3: counts extrapolated from a sample of a quarter of the records
+	inputMap = recordMapOf(map[string]int{"10000000": 1, "10000001": 0})
+	results = get_results(resultInputs{
+		totalInputRecord: 8,
+		totalRecordFound: 7,
+		recordMap:        inputMap,
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		sampleRate:       0.25,
+	}, "json")
+	assert.Equal(t, 4, results.Unique)
+	assert.Equal(t, 3, results.Duplicate)
+	assert.Equal(t, 50.0, results.PercentLoss)
+	assert.Equal(t, 4, results.Missing)
+	assert.Equal(t, 4, results.DeliveredOnce)
+	assert.Equal(t, 0.25, results.SampleRate)
+	assert.Nil(t, results.ErrorDestination)
+	assert.Nil(t, results.S3Objects)
+	assert.Nil(t, results.S3CompressionRatio)
+
+	// Test case 4: records found in the error output
+	inputMap = recordMapOf(map[string]int{"10000000": 1, "10000001": 0, "10000002": 0})
+	results = get_results(resultInputs{
+		totalInputRecord: 3,
+		totalRecordFound: 1,
+		recordMap:        inputMap,
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		errorRecords:     recordMapOf(map[string]int{"10000000": 0, "10000001": 2, "10000002": 0}),
+		sampleRate:       1,
+	}, "json")
+	assert.Equal(t, 2, results.Missing)
+	assert.Equal(t, 1, *results.ErrorDestination)
+
+	// Test case 5: size of the S3 objects
+	results = get_results(resultInputs{
+		totalInputRecord: 1,
+		totalRecordFound: 1,
+		recordMap:        recordMapOf(map[string]int{"10000000": 1}),
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		objects:          &s3Totals{objects: 3, bytes: 300, contentBytes: 1000},
+		sampleRate:       1,
+	}, "json")
+	assert.Equal(t, 3, *results.S3Objects)
+	assert.Equal(t, int64(300), *results.S3Bytes)
+	assert.Equal(t, int64(100), *results.S3AvgObjectBytes)
+	assert.Equal(t, 3.33, *results.S3CompressionRatio)
+	assert.Nil(t, results.S3Buckets)
+	assert.Nil(t, results.S3GzipObjects)
+	assert.False(t, results.Partial)
+
+	// Test case 6: results of an interrupted run are labelled as partial
+	results = get_results(resultInputs{
+		totalInputRecord: 2,
+		totalRecordFound: 1,
+		recordMap:        recordMapOf(map[string]int{"10000000": 1, "10000001": 0}),
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		sampleRate:       1,
+		partial:          true,
+	}, "json")
+	assert.True(t, results.Partial)
+	assert.Equal(t, 1, results.Missing)
+
+	// Test case 7: objects of several buckets
+	var totals s3Totals
+	totals.add(s3Totals{objects: 2, bytes: 200, buckets: []BucketObjects{{Bucket: "a", Objects: 2}}})
+	totals.add(s3Totals{objects: 1, bytes: 100, buckets: []BucketObjects{{Bucket: "b", Objects: 1}}})
+	results = get_results(resultInputs{
+		totalInputRecord: 1,
+		totalRecordFound: 1,
+		recordMap:        recordMapOf(map[string]int{"10000000": 1}),
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		objects:          &totals,
+		sampleRate:       1,
+	}, "json")
+	assert.Equal(t, 3, *results.S3Objects)
+	assert.Equal(t, []BucketObjects{{Bucket: "a", Objects: 2}, {Bucket: "b", Objects: 1}}, results.S3Buckets)
+
+	// Test case 8: records of several log groups
+	logGroups := []LogGroupRecords{{LogGroup: "a", Records: 1}, {LogGroup: "b", Records: 0}}
+	results = get_results(resultInputs{
+		totalInputRecord: 1,
+		totalRecordFound: 1,
+		recordMap:        recordMapOf(map[string]int{"10000000": 1}),
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		logGroups:        logGroups,
+		sampleRate:       1,
+	}, "json")
+	assert.Equal(t, logGroups, results.CWLogGroups)
+	assert.Nil(t, results.S3Objects)
+	assert.Nil(t, results.PayloadTruncated)
+
+	// Test case 9: verified payloads
+	results = get_results(resultInputs{
+		totalInputRecord: 2,
+		totalRecordFound: 2,
+		recordMap:        recordMapOf(map[string]int{"10000000": 1, "10000001": 1}),
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		payloads:         &PayloadCounts{Truncated: 1},
+		sampleRate:       1,
+	}, "json")
+	assert.Equal(t, 1, *results.PayloadTruncated)
+	assert.Equal(t, 0, *results.PayloadCorrupted)
+
+	// Test case 10: compressed and plaintext objects
+	results = get_results(resultInputs{
+		totalInputRecord: 1,
+		totalRecordFound: 1,
+		recordMap:        recordMapOf(map[string]int{"10000000": 1}),
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		objects:          &s3Totals{objects: 3, gzipObjects: 1, plainObjects: 2},
+		sampleRate:       1,
+	}, "json")
+	assert.Equal(t, 1, *results.S3GzipObjects)
+	assert.Equal(t, 2, *results.S3PlainObjects)
+
+	// Test case 11: retries of the API calls
+	results = get_results(resultInputs{
+		totalInputRecord: 1,
+		totalRecordFound: 1,
+		recordMap:        recordMapOf(map[string]int{"10000000": 1}),
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		retries:          RetryStats{retries: 3, backoff: int64(1500 * time.Millisecond)},
+		sampleRate:       1,
+	}, "json")
+	assert.Equal(t, 3, results.Retries)
+	assert.Equal(t, int64(1500), results.RetryBackoffMs)
+	assert.Empty(t, results.Account)
+
+	// Test case 12: account and region the destination was validated in
+	results = get_results(resultInputs{
+		totalInputRecord: 1,
+		totalRecordFound: 1,
+		recordMap:        recordMapOf(map[string]int{"10000000": 1}),
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		sampleRate:       1,
+		identity:         &AWSIdentity{Account: "123456789012", Region: "us-west-2"},
+	}, "json")
+	assert.Equal(t, "123456789012", results.Account)
+	assert.Equal(t, "us-west-2", results.Region)
+}
+
+func TestComputeResults(t *testing.T) {
+	// Test case 1: every record delivered once
+	inputMap := recordMapOf(map[string]int{"10000000": 1, "10000001": 1})
+	results := computeResults(resultInputs{
+		totalInputRecord: 2,
+		totalRecordFound: 2,
+		recordMap:        inputMap,
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		sampleRate:       1,
+	})
+	assert.Equal(t, 0.0, results.PercentLoss)
+	assert.Equal(t, 0, results.Missing)
+	assert.Equal(t, 0, results.Duplicate)
+	assert.Equal(t, 2, results.DeliveredOnce)
+
+	// Test case 2: no record delivered
+	inputMap = recordMapOf(map[string]int{"10000000": 0, "10000001": 0})
+	results = computeResults(resultInputs{
+		totalInputRecord: 2,
+		recordMap:        inputMap,
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		sampleRate:       1,
+	})
+	assert.Equal(t, 100.0, results.PercentLoss)
+	assert.Equal(t, 2, results.Missing)
+	assert.Equal(t, 0, results.Unique)
+
+	// Test case 3: a loss below one percent is not truncated to zero
+	inputMap = newInputMap(1000)
+	for i := 0; i < 1000; i++ {
+		inputMap.set(strconv.Itoa(idCounterBase+i), 1)
+	}
+	inputMap.set("10000000", 0)
+	inputMap.set("10000001", 0)
+	inputMap.set("10000002", 0)
+	inputMap.set("10000003", 0)
+	results = computeResults(resultInputs{
+		totalInputRecord: 1000,
+		totalRecordFound: 996,
+		recordMap:        inputMap,
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		sampleRate:       1,
+	})
+	assert.Equal(t, 0.4, results.PercentLoss)
+	assert.Equal(t, 4, results.Missing)
+
+	// Test case 4: duplicates do not make up for lost records
+	inputMap = recordMapOf(map[string]int{"10000000": 10, "10000001": 0, "10000002": 0, "10000003": 1})
+	results = computeResults(resultInputs{
+		totalInputRecord: 4,
+		totalRecordFound: 11,
+		recordMap:        inputMap,
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		sampleRate:       1,
+	})
+	assert.Equal(t, 50.0, results.PercentLoss)
+	assert.Equal(t, 2, results.Unique)
+	assert.Equal(t, 9, results.Duplicate)
+	assert.Equal(t, 1, results.DeliveredOnce)
+	assert.Equal(t, 1, results.DeliveredThreePlus)
+	assert.Equal(t, 10, results.MaxDeliveries)
+}
+
+func TestFormatPercent(t *testing.T) {
+	assert.Equal(t, "0.00", formatPercent(0))
+	assert.Equal(t, "100.00", formatPercent(100))
+	assert.Equal(t, "0.42", formatPercent(0.4166))
+	// 10,000 records lost out of 5 million
+	assert.Equal(t, "0.20", formatPercent(0.2))
+	// A single record lost out of 5 million
+	assert.Equal(t, "0.000020", formatPercent(0.00002))
+	assert.Equal(t, "0.0012", formatPercent(0.00123))
+}
+
+func TestDecompressReader(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte("{\"log\":\"a\"}\n"))
+	writer.Close()
+
+	// Test case 1: gzip compressed data
+	reader, gzipped, err := decompressReader(&compressed)
+	assert.NoError(t, err)
+	assert.True(t, gzipped)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"log\":\"a\"}\n", string(data))
+
+	// Test case 2: uncompressed data, and data shorter than the magic number
+	for _, plain := range []string{"{\"log\":\"a\"}\n", "a", ""} {
+		reader, gzipped, err = decompressReader(bytes.NewBufferString(plain))
+		assert.NoError(t, err)
+		assert.False(t, gzipped)
+		data, err = ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, plain, string(data))
+	}
+}
+
+func TestReadExpectedIds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expected")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Test case 1: non sequential IDs with blank lines and a duplicate
+	path := filepath.Join(dir, "ids.txt")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("3f2a9c1e\n\n10000007\r\n3f2a9c1e\nb71d04aa\n"), 0644))
+	recordIds, err := readExpectedIds(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3f2a9c1e", "10000007", "b71d04aa"}, recordIds)
+
+	// Test case 2: missing file
+	_, err = readExpectedIds(filepath.Join(dir, "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestExpectedPayloads(t *testing.T) {
+	parser := newRecordIdParser(8)
+
+	// Test case 1: the first payload of a record ID is kept
+	recordIds, payloads, err := expectedPayloads([]string{"10000000_1639151827578_a", "10000001_1639151827578_b", "10000000_1639151827578_c"}, parser)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000000", "10000001"}, recordIds)
+	assert.Equal(t, map[string]string{"10000000": "10000000_1639151827578_a", "10000001": "10000001_1639151827578_b"}, payloads)
+	assert.Equal(t, 0, parser.unparseableCount())
+
+	// Test case 2: payload without a record ID
+	_, _, err = expectedPayloads([]string{"1000"}, parser)
+	assert.Error(t, err)
+}
+
+func TestValidateS3Totals(t *testing.T) {
+	client := &mockS3{
+		pages:   [][]string{{"a", "b"}},
+		objects: map[string][]string{"a": producerLogs("10000000", "10000001"), "b": producerLogs("10000002")},
+	}
+	// Test case 1: plaintext objects
+	_, totals, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(3), &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, s3Totals{objects: 2, bytes: 2 * mockObjectSize, contentBytes: 3 * int64(len("{\"log\":\"10000000_1639151827578_RandomString\"}\n")), plainObjects: 2,
+		perObject: objectRecordStats{objects: 2, records: 3, min: 1, max: 2, counts: []int{0, 2, 0, 0, 0, 0}}}, totals)
+
+	// Test case 2: objects compressed with gzip
+	client.gzip = true
+	_, totals, err = validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(3), &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, totals.gzipObjects)
+	assert.Equal(t, 0, totals.plainObjects)
+}
+
+// Serves the compressed objects of mockS3, with the checksum of the corrupt ones changed and the truncated ones cut short
+type mockS3Corrupt struct {
+	*mockS3
+	corrupt   map[string]bool
+	truncated map[string]bool
+}
+
+func (m *mockS3Corrupt) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	output, err := m.mockS3.GetObjectWithContext(ctx, input, opts...)
+	key := aws.StringValue(input.Key)
+	if err != nil || (!m.corrupt[key] && !m.truncated[key]) {
+		return output, err
+	}
+	body, _ := ioutil.ReadAll(output.Body)
+	if m.truncated[key] {
+		// Like a connection dropped in the middle of the body
+		body = body[:len(body)/2]
+	} else {
+		// The CRC-32 of the content precedes the size in the last 8 bytes of the stream
+		body[len(body)-8] ^= 0xff
+	}
+	output.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return output, nil
+}
+
+func TestValidateS3CorruptObjects(t *testing.T) {
+	client := &mockS3Corrupt{
+		mockS3: &mockS3{
+			pages:   [][]string{{"a", "b"}},
+			objects: map[string][]string{"a": producerLogs("10000000"), "b": producerLogs("10000001", "10000002")},
+			gzip:    true,
+		},
+		corrupt: map[string]bool{"b": true},
+	}
+
+	// Test case 1: a corrupt object fails the run
+	_, _, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(3), &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	var corrupt *corruptObjectError
+	assert.True(t, errors.As(err, &corrupt))
+	assert.True(t, errors.Is(err, gzip.ErrChecksum))
+
+	// Test case 2: a corrupt object is counted and skipped, the records read before the checksum was checked are counted
+	parser := newRecordIdParser(defaultRecordIdLength)
+	parser.skipCorrupt = true
+	inputMap := newInputMap(3)
+	found, totals, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, inputMap, &validatorSettings{
+		workerCount:  2,
+		s3MaxRetries: retryMaxRetries,
+		parser:       parser,
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found)
+	assert.Equal(t, 2, totals.objects)
+	assert.Equal(t, []string{"s3://bucket/b"}, totals.corruptObjects)
+
+	results := computeResults(resultInputs{
+		totalInputRecord: 3,
+		totalRecordFound: found,
+		recordMap:        inputMap,
+		logDelay:         "1ms",
+		delays:           &DelayStats{},
+		objects:          &totals,
+		sampleRate:       1,
+	})
+	assert.Equal(t, 1, *results.S3CorruptObjects)
+	assert.Equal(t, []string{"s3://bucket/b"}, results.S3CorruptKeys)
+
+	// Test case 3: a body cut short is not taken as corrupt, and fails the run even if corrupt objects are skipped
+	client.corrupt = nil
+	client.truncated = map[string]bool{"b": true}
+	_, _, err = validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(3), &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		parser:       parser,
+		delays:       &DelayStats{},
+	}, nil)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	assert.False(t, errors.As(err, &corrupt))
+}
+
+func TestIsCorruptGzip(t *testing.T) {
+	assert.True(t, isCorruptGzip(fmt.Errorf("read: %w", gzip.ErrChecksum)))
+	assert.True(t, isCorruptGzip(gzip.ErrHeader))
+	assert.True(t, isCorruptGzip(flate.CorruptInputError(10)))
+	assert.False(t, isCorruptGzip(io.ErrUnexpectedEOF))
+	assert.False(t, isCorruptGzip(errors.New("connection reset by peer")))
+}
+
+func TestIsValidLogDelay(t *testing.T) {
+	assert.True(t, isValidLogDelay("01m30s"))
+	assert.True(t, isValidLogDelay("90"))
+	assert.True(t, isValidLogDelay("1.5"))
+	assert.True(t, isValidLogDelay(logDelayNotSupported))
+	assert.False(t, isValidLogDelay("soon"))
+	assert.False(t, isValidLogDelay("1m30"))
+}
+
+func TestParseInitialWait(t *testing.T) {
+	// Test case 1: no wait
+	wait, err := parseInitialWait("")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+
+	// Test case 2: a duration
+	wait, err = parseInitialWait("2m30s")
+	assert.NoError(t, err)
+	assert.Equal(t, 150*time.Second, wait)
+
+	// Test case 3: invalid and negative values fail
+	_, err = parseInitialWait("2")
+	assert.Error(t, err)
+	_, err = parseInitialWait("soon")
+	assert.Error(t, err)
+	_, err = parseInitialWait("-1m")
+	assert.Error(t, err)
+}
+
+func TestWaitInitially(t *testing.T) {
+	// Test case 1: the wait is over
+	assert.True(t, waitInitially(context.Background(), time.Millisecond))
+	assert.True(t, waitInitially(context.Background(), 0))
+
+	// Test case 2: a cancelled context ends the wait early
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	assert.False(t, waitInitially(ctx, time.Hour))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestPercentDeviation(t *testing.T) {
+	assert.Equal(t, 0.0, percentDeviation(10, 10))
+	assert.Equal(t, 50.0, percentDeviation(5, 10))
+	assert.Equal(t, 900.0, percentDeviation(100, 10))
+	assert.Equal(t, 0.0, percentDeviation(0, 0))
+	assert.True(t, math.IsInf(percentDeviation(1, 0), 1))
+}
+
+// Records the page size of every listing and GetLogEvents call
+type pageSizeRecorder struct {
+	mockS3
+	mockCloudWatch
+	pageSizes []int64
+}
+
+func (m *pageSizeRecorder) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	m.pageSizes = append(m.pageSizes, aws.Int64Value(input.MaxKeys))
+	return m.mockS3.ListObjectsV2WithContext(ctx, input, opts...)
+}
+
+func (m *pageSizeRecorder) GetLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.GetLogEventsInput, opts ...request.Option) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	m.pageSizes = append(m.pageSizes, aws.Int64Value(input.Limit))
+	return m.mockCloudWatch.GetLogEventsWithContext(ctx, input, opts...)
+}
+
+func TestPageSize(t *testing.T) {
+	cwRequestPeriod = 0
+	defer func() { cwRequestPeriod = 1 * time.Second }()
+
+	// Test case 1: S3 page size
+	client := &pageSizeRecorder{mockS3: mockS3{pages: [][]string{{"a"}, {"b"}}, objects: map[string][]string{"a": producerLogs("10000000"), "b": producerLogs("10000001")}}}
+	_, _, err := validate_s3(context.Background(), client, "bucket", []string{"prefix"}, newInputMap(2), &validatorSettings{
+		workerCount:  1,
+		s3MaxRetries: retryMaxRetries,
+		s3PageSize:   1,
+		parser:       newRecordIdParser(defaultRecordIdLength),
+		delays:       &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 1}, client.pageSizes)
+
+	// Test case 2: CloudWatch limit, unset when zero
+	client = &pageSizeRecorder{mockCloudWatch: mockCloudWatch{streams: map[string][][]string{"stream": {producerLogs("10000000")}}}}
+	_, err = validate_cloudwatch(context.Background(), client, "group", []string{"stream"}, newInputMap(1), &validatorSettings{
+		workerCount: 1,
+		cwLimit:     500,
+		parser:      newRecordIdParser(defaultRecordIdLength),
+		delays:      &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{500, 500}, client.pageSizes)
+
+	client = &pageSizeRecorder{mockCloudWatch: mockCloudWatch{streams: map[string][][]string{"stream": {producerLogs("10000000")}}}}
+	_, err = validate_cloudwatch(context.Background(), client, "group", []string{"stream"}, newInputMap(1), &validatorSettings{
+		workerCount: 1,
+		parser:      newRecordIdParser(defaultRecordIdLength),
+		delays:      &DelayStats{},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 0}, client.pageSizes)
+}
+
+func TestIsKMSAccessDenied(t *testing.T) {
+	kmsDenied := awserr.NewRequestFailure(awserr.New("AccessDenied", "The ciphertext refers to a customer master key that does not exist, does not exist in this region, or you are not allowed to access.", nil), 403, "")
+	assert.True(t, isKMSAccessDenied(kmsDenied))
+	assert.True(t, isKMSAccessDenied(awserr.New("KMS.DisabledException", "", nil)))
+	assert.True(t, isKMSAccessDenied(fmt.Errorf("wrapped: %w", awserr.New("AccessDenied", "User is not authorized to perform: kms:Decrypt", nil))))
+	assert.False(t, isKMSAccessDenied(awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "")))
+	assert.False(t, isKMSAccessDenied(nil))
+
+	// The error of the object names the missing permission
+	client := &mockS3{errors: map[string][]error{"a": {kmsDenied}}}
+	_, err := getS3Object(context.Background(), client, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("a")}, retryMaxRetries)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "kms:Decrypt")
+}
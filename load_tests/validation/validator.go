@@ -0,0 +1,684 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// Counts the occurrences of the input records in a single destination
+type Validator interface {
+	// Returns the number of records found, including the ones found before an error or ctx being done
+	Validate(ctx context.Context, inputMap *RecordMap) (int, error)
+}
+
+// Adds the counts specific to a destination, e.g. the S3 objects validated, to its results.
+// Only implemented by the validators which have such counts.
+type resultReporter interface {
+	report(result *destinationResult)
+}
+
+// Tells whether a validator only searches the destination for the input records it is given, rather than reading all of it.
+// Polling passes after the first then only search the records still missing. Only implemented by the validators which can.
+type recordSearcher interface {
+	searchesRecords() bool
+}
+
+// Settings of a run and the counters of a destination, which the validators are created with
+type validatorSettings struct {
+	destination string
+	// LOG_PREFIX or the one scoped to the destination
+	prefix           string
+	buckets          []string
+	logGroups        []string
+	region           string
+	s3Region         string
+	cwRegion         string
+	discoverMode     string
+	estimateOnly     bool
+	useVersions      bool
+	objectOrder      string
+	showProgress     bool
+	outputFormat     string
+	totalInputRecord int
+	window           TimeWindow
+	workerCount      int
+	s3MaxRetries     int
+	s3PageSize       int64
+	// S3 Select instead of GetObject, only set by the S3 validator
+	useSelect  bool
+	cwLimit    int64
+	cwLimiter  *rate.Limiter
+	parser     *RecordIdParser
+	delays     *DelayStats
+	ordering   *OrderStats
+	audit      *AuditLog
+	checkpoint *Checkpointer
+	failFast   *FailFast
+}
+
+// Creates the validator of a destination, exits if it is not configured correctly.
+// Returns nil if there is nothing to validate, e.g. only an estimate or the discovered prefixes were printed.
+type validatorFactory func(ctx context.Context, settings *validatorSettings) Validator
+
+// Validators by destination name, DESTINATION only accepts the registered ones
+var validators = map[string]validatorFactory{
+	"s3":         newS3Validator,
+	"cloudwatch": newCloudWatchValidator,
+	"kinesis":    newKinesisValidator,
+	"opensearch": newOpenSearchValidator,
+	"firehose":   newFirehoseValidator,
+	"dynamodb":   newDynamoValidator,
+	"http":       newHTTPValidator,
+	"sqs":        newSQSValidator,
+	"s3tables":   newS3TablesValidator,
+	"localdir":   newLocalDirValidator,
+}
+
+// Returns the registered destinations quoted and sorted for an error message, e.g. "cloudwatch", "s3" or "sqs"
+func validatorNames() string {
+	names := make([]string, 0, len(validators))
+	for name := range validators {
+		names = append(names, strconv.Quote(name))
+	}
+	sort.Strings(names)
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// Validates the objects under the prefixes of one or more S3 buckets
+type s3Validator struct {
+	*validatorSettings
+	client   s3API
+	prefixes []string
+	// Number and size of the objects validated in every bucket
+	totals s3Totals
+}
+
+// Creates a new S3 Validator
+func newS3Validator(ctx context.Context, settings *validatorSettings) Validator {
+	s3Client, err := getS3Client(settings.s3Region)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to create new S3 client: %v", err)
+	}
+	bucket := settings.buckets[0]
+
+	// LOG_PREFIX may be a comma separated list of prefixes within the bucket
+	prefixes := splitList(settings.prefix)
+	switch settings.discoverMode {
+	case "":
+	case discoverList, discoverValidate:
+		prefixes, err = discover_s3_prefixes(ctx, s3Client, bucket, prefixes)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] %v", err)
+		}
+		if settings.discoverMode == discoverList {
+			print_prefixes(DiscoveredPrefixes{Bucket: bucket, Prefixes: prefixes}, settings.outputFormat)
+			return nil
+		}
+		if len(prefixes) == 0 {
+			exitErrorf("[TEST FAILURE] No prefixes found under %q in bucket %q", settings.prefix, bucket)
+		}
+		logrus.Infof("Discovered %d prefixes in bucket %q: %s", len(prefixes), bucket, strings.Join(prefixes, ", "))
+	default:
+		exitErrorf("[TEST FAILURE] Invalid prefix discovery mode %q. Set \"list\" or \"validate\" for environment variable- %s", settings.discoverMode, envDiscover)
+	}
+
+	if settings.estimateOnly {
+		estimate, err := estimate_s3(ctx, s3Client, bucket, prefixes, settings)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] %v", err)
+		}
+		print_estimate(estimate, settings.outputFormat)
+		return nil
+	}
+
+	// GetObject is the default since S3 Select only supports JSON Lines objects
+	parser := settings.parser
+	switch mode := os.Getenv(envS3Mode); mode {
+	case "", "getobject":
+	case "select":
+		if settings.useVersions {
+			exitErrorf("[TEST FAILURE] S3 Select does not support object versions. Unset the environment variable- %s", envS3Versions)
+		}
+		if parser.payloads != nil {
+			exitErrorf("[TEST FAILURE] S3 Select only returns the record IDs, payloads can not be verified. Unset the environment variable- %s", envVerifyPayld)
+		}
+		if parser.expectedLength > 0 {
+			exitErrorf("[TEST FAILURE] S3 Select only returns the record IDs, their length can not be verified. Unset the environment variable- %s", envExpectedLen)
+		}
+		if parser.raw || parser.parquet {
+			exitErrorf("[TEST FAILURE] S3 Select requires JSON log records. Unset the environment variable- %s", envLogFormat)
+		}
+		if parser.delimiter != "" || parser.concatenated {
+			exitErrorf("[TEST FAILURE] S3 Select requires newline delimited records. Unset the environment variable- %s", envDelimiter)
+		}
+		settings.useSelect = true
+	default:
+		exitErrorf("[TEST FAILURE] Invalid S3 validation mode %q. Set \"getobject\" or \"select\" for environment variable- %s", mode, envS3Mode)
+	}
+
+	return &s3Validator{validatorSettings: settings, client: s3Client, prefixes: prefixes}
+}
+
+// Every bucket adds to the same records, the objects are counted per bucket as well
+func (v *s3Validator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	var progress *Progress
+	if v.showProgress {
+		progress = startProgress(v.totalInputRecord, "objects", progressPeriod)
+		defer progress.stop()
+	}
+
+	totalRecordFound := 0
+	var validationErr error
+	for _, bucket := range v.buckets {
+		found, bucketTotals, err := validate_s3(ctx, v.client, bucket, v.prefixes, inputMap, v.validatorSettings, progress)
+		totalRecordFound += found
+		if len(v.buckets) > 1 {
+			bucketTotals.buckets = []BucketObjects{{Bucket: bucket, Objects: bucketTotals.objects}}
+			logrus.Infof("Found %d records in %d objects of bucket %q", found, bucketTotals.objects, bucket)
+		}
+		v.totals.add(bucketTotals)
+		if err != nil {
+			validationErr = err
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	v.totals.add(v.checkpoint.resumedObjects())
+	return totalRecordFound, validationErr
+}
+
+// Reports the objects validated in every bucket
+func (v *s3Validator) report(result *destinationResult) {
+	totals := v.totals
+	result.objects = &totals
+}
+
+// Validates the log streams of one or more CloudWatch log groups
+type cloudwatchValidator struct {
+	*validatorSettings
+	client cwAPI
+	// Queries Logs Insights instead of reading every event
+	insights bool
+	// Searches the input records with FilterLogEvents instead of reading every event
+	filter bool
+	// Records found in every log group, only counted with several log groups
+	logGroupRecords []LogGroupRecords
+}
+
+// Creates a new CloudWatch Validator
+func newCloudWatchValidator(ctx context.Context, settings *validatorSettings) Validator {
+	cwClient, err := getCWClient(settings.cwRegion)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to create new CloudWatch client: %v", err)
+	}
+	v := &cloudwatchValidator{validatorSettings: settings, client: cwClient}
+
+	// GetLogEvents is the default since Logs Insights queries are billed by the amount of data scanned
+	switch mode := os.Getenv(envCWMode); mode {
+	case "", "getevents":
+	case "insights":
+		if settings.parser.payloads != nil {
+			exitErrorf("[TEST FAILURE] Logs Insights only returns the record IDs, payloads can not be verified. Unset the environment variable- %s", envVerifyPayld)
+		}
+		if settings.parser.expectedLength > 0 {
+			exitErrorf("[TEST FAILURE] Logs Insights only returns the record IDs, their length can not be verified. Unset the environment variable- %s", envExpectedLen)
+		}
+		if settings.checkpoint != nil {
+			exitErrorf("[TEST FAILURE] Checkpoints are not supported with Logs Insights. Unset the environment variable- %s", envCheckpoint)
+		}
+		v.insights = true
+	case "filter":
+		// The filter patterns are built from the input records
+		if settings.parser.duplicatesOnly {
+			exitErrorf("[TEST FAILURE] FilterLogEvents searches the input records, which are not tracked when only validating duplicates. Unset the environment variable- %s", envMode)
+		}
+		if settings.checkpoint != nil {
+			exitErrorf("[TEST FAILURE] Checkpoints are not supported with FilterLogEvents. Unset the environment variable- %s", envCheckpoint)
+		}
+		v.filter = true
+	default:
+		exitErrorf("[TEST FAILURE] Invalid CloudWatch validation mode %q. Set \"getevents\", \"insights\" or \"filter\" for environment variable- %s", mode, envCWMode)
+	}
+
+	// Only a single log group is estimated, several of them are rejected up front
+	if settings.estimateOnly {
+		logGroup := settings.logGroups[0]
+		logStreams, err := v.logStreams(ctx, logGroup)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] %v", err)
+		}
+		estimate, err := estimate_cloudwatch(ctx, cwClient, logGroup, logStreams)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] %v", err)
+		}
+		print_estimate(estimate, settings.outputFormat)
+		return nil
+	}
+
+	return v
+}
+
+// The log stream is LOG_PREFIX unless several streams are given by name or by prefix, within each log group
+func (v *cloudwatchValidator) logStreams(ctx context.Context, logGroup string) ([]string, error) {
+	if value := os.Getenv(envCWStreams); value != "" {
+		return splitList(value), nil
+	}
+	if value := os.Getenv(envCWPrefix); value != "" {
+		return getCWLogStreams(ctx, v.client, logGroup, value)
+	}
+	return []string{v.prefix}, nil
+}
+
+// Every log group adds to the same records, the records are counted per log group as well
+func (v *cloudwatchValidator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	var progress *Progress
+	if v.showProgress && !v.insights && !v.filter {
+		progress = startProgress(v.totalInputRecord, "events", progressPeriod)
+		defer progress.stop()
+	}
+
+	totalRecordFound := 0
+	for _, logGroup := range v.logGroups {
+		logStreams, err := v.logStreams(ctx, logGroup)
+		if err != nil {
+			return totalRecordFound, err
+		}
+
+		var found int
+		if v.insights {
+			found, err = validate_cloudwatch_insights(ctx, v.client, logGroup, logStreams, v.window, inputMap, v.parser)
+		} else if v.filter {
+			found, err = validate_cloudwatch_filter(ctx, v.client, logGroup, logStreams, inputMap, v.validatorSettings)
+		} else {
+			found, err = validate_cloudwatch(ctx, v.client, logGroup, logStreams, inputMap, v.validatorSettings, progress)
+		}
+		totalRecordFound += found
+		if len(v.logGroups) > 1 {
+			v.logGroupRecords = append(v.logGroupRecords, LogGroupRecords{LogGroup: logGroup, Records: found})
+			logrus.Infof("Found %d records in log group %q", found, logGroup)
+		}
+		if err != nil || ctx.Err() != nil {
+			return totalRecordFound, err
+		}
+	}
+	return totalRecordFound, nil
+}
+
+// Reports the records found in every log group, only counted with several log groups
+func (v *cloudwatchValidator) report(result *destinationResult) {
+	result.logGroups = v.logGroupRecords
+}
+
+// FilterLogEvents only searches the input records, reading every event or querying Logs Insights does not
+func (v *cloudwatchValidator) searchesRecords() bool {
+	return v.filter
+}
+
+// Validates the data files of an Amazon S3 Tables or other Iceberg table. Experimental.
+type s3TablesValidator struct {
+	*validatorSettings
+	client s3API
+	// S3 location of the metadata file of the table
+	metadataLocation string
+	// Number and size of the data files validated
+	totals s3Totals
+}
+
+// Creates a new S3 Tables Validator
+func newS3TablesValidator(ctx context.Context, settings *validatorSettings) Validator {
+	// The current metadata location of an S3 table is returned by the GetTableMetadataLocation API
+	metadataLocation := os.Getenv(envIcebergMeta)
+	if metadataLocation == "" {
+		exitErrorf("[TEST FAILURE] Table metadata location required. Set the value for environment variable- %s", envIcebergMeta)
+	}
+	if _, _, err := parseS3Location(metadataLocation); err != nil {
+		exitErrorf("[TEST FAILURE] Invalid table metadata location %q. Set an s3:// location for environment variable- %s", metadataLocation, envIcebergMeta)
+	}
+
+	s3Client, err := getS3Client(settings.s3Region)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to create new S3 client: %v", err)
+	}
+	return &s3TablesValidator{validatorSettings: settings, client: s3Client, metadataLocation: metadataLocation}
+}
+
+func (v *s3TablesValidator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	var progress *Progress
+	if v.showProgress {
+		progress = startProgress(v.totalInputRecord, "data files", progressPeriod)
+		defer progress.stop()
+	}
+
+	found, totals, err := validate_s3tables(ctx, v.client, v.metadataLocation, inputMap, v.validatorSettings, progress)
+	v.totals = totals
+	return found, err
+}
+
+// Reports the data files validated as S3 objects
+func (v *s3TablesValidator) report(result *destinationResult) {
+	totals := v.totals
+	result.objects = &totals
+}
+
+// Validates the files of a local directory
+type localDirValidator struct {
+	*validatorSettings
+	dir string
+	// Number and size of the files validated
+	totals s3Totals
+}
+
+// Creates a new Local Directory Validator
+func newLocalDirValidator(ctx context.Context, settings *validatorSettings) Validator {
+	dir := os.Getenv(envLocalDir)
+	if dir == "" {
+		exitErrorf("[TEST FAILURE] Local directory required. Set the value for environment variable- %s", envLocalDir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		exitErrorf("[TEST FAILURE] Invalid local directory %q. Set an existing directory for environment variable- %s", dir, envLocalDir)
+	}
+	return &localDirValidator{validatorSettings: settings, dir: dir}
+}
+
+func (v *localDirValidator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	var progress *Progress
+	if v.showProgress {
+		progress = startProgress(v.totalInputRecord, "files", progressPeriod)
+		defer progress.stop()
+	}
+
+	found, totals, err := validate_localdir(ctx, v.dir, inputMap, v.validatorSettings, progress)
+	v.totals = totals
+	return found, err
+}
+
+// Reports the files validated as S3 objects
+func (v *localDirValidator) report(result *destinationResult) {
+	totals := v.totals
+	result.objects = &totals
+}
+
+// Validates the objects Firehose delivered to S3, partitioned by the hour they arrived in
+type firehoseValidator struct {
+	*validatorSettings
+	client s3API
+	// Time based partitions below the prefix, empty if the prefix is custom
+	layout        string
+	partitionKeys []string
+	// Number and size of the objects validated
+	totals s3Totals
+}
+
+// Creates a new Firehose Validator
+func newFirehoseValidator(ctx context.Context, settings *validatorSettings) Validator {
+	s3Client, err := getS3Client(settings.s3Region)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to create new S3 client: %v", err)
+	}
+
+	// Records are partitioned by the hour they arrived in, e.g. logs/2022/01/31/23/, unless the prefix is custom
+	layout := defaultFirehoseLayout
+	if value := os.Getenv(envFHLayout); value == firehoseLayoutNone {
+		layout = ""
+	} else if value != "" {
+		layout = value
+	}
+
+	// Firehose concatenates the records unless a processor appends a delimiter
+	parser := settings.parser
+	switch encoding := os.Getenv(envFHEncoding); encoding {
+	case "":
+		if !parser.raw && !parser.parquet && os.Getenv(envDelimiter) == "" {
+			parser.concatenated = true
+		}
+	case firehoseEncodingBase64:
+		if parser.parquet {
+			exitErrorf("[TEST FAILURE] Base64 encoded records are not supported with Parquet records. Unset the environment variable- %s", envFHEncoding)
+		}
+		if parser.concatenated {
+			exitErrorf("[TEST FAILURE] Base64 encoded records require a record delimiter. Set a delimiter other than %q for environment variable- %s", recordDelimiterJSON, envDelimiter)
+		}
+		parser.base64 = true
+	default:
+		exitErrorf("[TEST FAILURE] Invalid Firehose record encoding %q. Set %q or leave empty for environment variable- %s", encoding, firehoseEncodingBase64, envFHEncoding)
+	}
+
+	// Dynamic partitioning inserts a "key=value" segment per partition key below the prefix, before the hourly partitions
+	partitionKeys := splitList(os.Getenv(envFHKeys))
+	return &firehoseValidator{validatorSettings: settings, client: s3Client, layout: layout, partitionKeys: partitionKeys}
+}
+
+func (v *firehoseValidator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	var progress *Progress
+	if v.showProgress {
+		progress = startProgress(v.totalInputRecord, "objects", progressPeriod)
+		defer progress.stop()
+	}
+
+	found, totals, err := validate_firehose(ctx, v.client, v.buckets[0], splitList(v.prefix), v.partitionKeys, v.layout, inputMap, v.validatorSettings, progress)
+	totals.add(v.checkpoint.resumedObjects())
+	v.totals = totals
+	return found, err
+}
+
+// Reports the objects validated
+func (v *firehoseValidator) report(result *destinationResult) {
+	totals := v.totals
+	result.objects = &totals
+}
+
+// Validates the records of a Kinesis data stream
+type kinesisValidator struct {
+	*validatorSettings
+	client     kinesisAPI
+	streamName string
+}
+
+// Creates a new Kinesis Validator
+func newKinesisValidator(ctx context.Context, settings *validatorSettings) Validator {
+	streamName := os.Getenv(envKinesisName)
+	if streamName == "" {
+		exitErrorf("[TEST FAILURE] Kinesis stream name required. Set the value for environment variable- %s", envKinesisName)
+	}
+
+	kinesisClient, err := getKinesisClient(settings.region)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to create new Kinesis client: %v", err)
+	}
+	return &kinesisValidator{validatorSettings: settings, client: kinesisClient, streamName: streamName}
+}
+
+func (v *kinesisValidator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	return validate_kinesis(ctx, v.client, v.streamName, inputMap, v.parser, v.delays, v.ordering)
+}
+
+// Validates the documents of an OpenSearch index, and the S3 error output of Firehose if any
+type openSearchValidator struct {
+	*validatorSettings
+	client openSearchAPI
+	index  string
+	// Only set if the records Firehose failed to deliver are validated
+	s3Client    s3API
+	errorBucket string
+	errorPrefix string
+	// Records found in the error output
+	errorRecords *RecordMap
+}
+
+// Creates a new OpenSearch Validator
+func newOpenSearchValidator(ctx context.Context, settings *validatorSettings) Validator {
+	endpoint := os.Getenv(envOSEndpoint)
+	if endpoint == "" {
+		exitErrorf("[TEST FAILURE] OpenSearch endpoint required. Set the value for environment variable- %s", envOSEndpoint)
+	}
+
+	index := os.Getenv(envOSIndex)
+	if index == "" {
+		exitErrorf("[TEST FAILURE] OpenSearch index required. Set the value for environment variable- %s", envOSIndex)
+	}
+
+	osClient, err := getOpenSearchClient(settings.region, endpoint)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to create new OpenSearch client: %v", err)
+	}
+	v := &openSearchValidator{validatorSettings: settings, client: osClient, index: index}
+
+	// Records Firehose failed to deliver to OpenSearch are redirected to its S3 error output, which tells them apart from lost ones
+	if errorPrefix := os.Getenv(envErrorPrefix); errorPrefix != "" {
+		v.errorPrefix = errorPrefix
+		v.errorBucket = os.Getenv(envErrorBucket)
+		if v.errorBucket == "" {
+			v.errorBucket = settings.buckets[0]
+		}
+		v.s3Client, err = getS3Client(settings.s3Region)
+		if err != nil {
+			exitErrorf("[TEST FAILURE] Unable to create new S3 client: %v", err)
+		}
+	}
+	return v
+}
+
+func (v *openSearchValidator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	found, err := validate_opensearch(ctx, v.client, v.index, inputMap, v.parser)
+	if err != nil || v.errorPrefix == "" {
+		return found, err
+	}
+
+	// The error output is neither checkpointed nor counted in the delays of the destination
+	errorSettings := &validatorSettings{
+		window:       v.window,
+		workerCount:  v.workerCount,
+		s3MaxRetries: v.s3MaxRetries,
+		s3PageSize:   v.s3PageSize,
+		parser:       v.parser.clone(),
+		delays:       &DelayStats{},
+		audit:        v.audit,
+	}
+	errorSettings.parser.firehoseErrors = true
+	errorSettings.parser.delimiter = ""
+	errorSettings.parser.concatenated = false
+	errorSettings.parser.base64 = false
+	v.errorRecords = inputMap.reset()
+	errorFound, _, err := validate_s3(ctx, v.s3Client, v.errorBucket, splitList(v.errorPrefix), v.errorRecords, errorSettings, nil)
+	if err != nil {
+		return found, fmt.Errorf("unable to validate the error output: %w", err)
+	}
+	logrus.Infof("Found %d records in the error output %q of bucket %q", errorFound, v.errorPrefix, v.errorBucket)
+	return found, nil
+}
+
+// Reports the records found in the error output
+func (v *openSearchValidator) report(result *destinationResult) {
+	result.errorRecords = v.errorRecords
+}
+
+// Validates the items of a DynamoDB table
+type dynamoValidator struct {
+	*validatorSettings
+	client dynamoAPI
+	table  string
+	// Attribute of the items holding the log record
+	attribute string
+}
+
+// Creates a new DynamoDB Validator
+func newDynamoValidator(ctx context.Context, settings *validatorSettings) Validator {
+	table := os.Getenv(envDynamoTable)
+	if table == "" {
+		exitErrorf("[TEST FAILURE] DynamoDB table name required. Set the value for environment variable- %s", envDynamoTable)
+	}
+
+	attribute := os.Getenv(envDynamoAttr)
+	if attribute == "" {
+		attribute = defaultDynamoAttribute
+	}
+
+	dynamoClient, err := getDynamoClient(settings.region)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to create new DynamoDB client: %v", err)
+	}
+	return &dynamoValidator{validatorSettings: settings, client: dynamoClient, table: table, attribute: attribute}
+}
+
+func (v *dynamoValidator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	return validate_dynamodb(ctx, v.client, v.table, v.attribute, inputMap, v.parser, v.workerCount)
+}
+
+// Validates the records returned by a custom HTTP query endpoint
+type httpValidator struct {
+	*validatorSettings
+	client *http.Client
+	url    string
+	token  string
+}
+
+// Creates a new HTTP Validator
+func newHTTPValidator(ctx context.Context, settings *validatorSettings) Validator {
+	url := os.Getenv(envQueryURL)
+	if url == "" {
+		exitErrorf("[TEST FAILURE] Query URL required. Set the value for environment variable- %s", envQueryURL)
+	}
+
+	httpClient, err := getHTTPClient()
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to create new HTTP client: %v", err)
+	}
+	return &httpValidator{validatorSettings: settings, client: httpClient, url: url, token: os.Getenv(envQueryToken)}
+}
+
+func (v *httpValidator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	return validate_http(ctx, v.client, v.url, v.token, inputMap, v.parser)
+}
+
+// Validates the messages of an SQS queue
+type sqsValidator struct {
+	*validatorSettings
+	client   sqsAPI
+	queueUrl string
+	// The messages are deleted once validated unless set
+	peekTimeout time.Duration
+}
+
+// Creates a new SQS Validator
+func newSQSValidator(ctx context.Context, settings *validatorSettings) Validator {
+	queueUrl := os.Getenv(envSQSQueueUrl)
+	if queueUrl == "" {
+		exitErrorf("[TEST FAILURE] SQS queue URL required. Set the value for environment variable- %s", envSQSQueueUrl)
+	}
+
+	// Receiving the messages removes them from the queue, unless they are only hidden for a while
+	var peekTimeout time.Duration
+	if value := os.Getenv(envSQSPeek); value != "" {
+		var err error
+		peekTimeout, err = time.ParseDuration(value)
+		if err != nil || peekTimeout < time.Second || peekTimeout > 12*time.Hour {
+			exitErrorf("[TEST FAILURE] Invalid SQS peek timeout %q. Set a duration between \"1s\" and \"12h\" for environment variable- %s", value, envSQSPeek)
+		}
+	} else {
+		logrus.Warnf("The messages of queue %q are deleted once validated. Set the environment variable- %s to keep them", queueUrl, envSQSPeek)
+	}
+
+	sqsClient, err := getSQSClient(settings.region)
+	if err != nil {
+		exitErrorf("[TEST FAILURE] Unable to create new SQS client: %v", err)
+	}
+	return &sqsValidator{validatorSettings: settings, client: sqsClient, queueUrl: queueUrl, peekTimeout: peekTimeout}
+}
+
+func (v *sqsValidator) Validate(ctx context.Context, inputMap *RecordMap) (int, error) {
+	return validate_sqs(ctx, v.client, v.queueUrl, v.peekTimeout, inputMap, v.parser, v.delays)
+}
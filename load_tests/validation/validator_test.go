@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidators(t *testing.T) {
+	for _, destination := range []string{"s3", "cloudwatch", "kinesis", "opensearch", "firehose", "dynamodb", "http", "sqs", "s3tables", "localdir"} {
+		assert.Contains(t, validators, destination)
+	}
+	assert.NotContains(t, validators, "stdout")
+	assert.Equal(t, `"cloudwatch", "dynamodb", "firehose", "http", "kinesis", "localdir", "opensearch", "s3", "s3tables" or "sqs"`, validatorNames())
+}
+
+func TestS3Validator(t *testing.T) {
+	client := &mockS3{
+		pages:   [][]string{{"a"}},
+		objects: map[string][]string{"a": producerLogs("10000000", "10000001")},
+	}
+	validator := &s3Validator{
+		validatorSettings: &validatorSettings{
+			buckets:      []string{"bucket-1", "bucket-2"},
+			parser:       newRecordIdParser(defaultRecordIdLength),
+			delays:       &DelayStats{},
+			workerCount:  1,
+			s3MaxRetries: retryMaxRetries,
+		},
+		client:   client,
+		prefixes: []string{"prefix"},
+	}
+	inputMap := newInputMap(3)
+
+	// Test case 1: every bucket adds to the same records
+	found, err := validator.Validate(context.Background(), inputMap)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, found)
+	assert.Equal(t, map[string]int{"10000000": 2, "10000001": 2, "10000002": 0}, inputMap.toMap())
+
+	// Test case 2: the objects are reported per bucket
+	result := &destinationResult{}
+	validator.report(result)
+	assert.Equal(t, 2, result.objects.objects)
+	assert.Equal(t, []BucketObjects{{Bucket: "bucket-1", Objects: 1}, {Bucket: "bucket-2", Objects: 1}}, result.objects.buckets)
+}
+
+func TestCloudWatchValidator(t *testing.T) {
+	cwRequestPeriod = 0
+	defer func() { cwRequestPeriod = 1 * time.Second }()
+
+	client := &mockCloudWatch{
+		streams: map[string][][]string{"stream": {producerLogs("10000000", "10000001")}},
+	}
+	validator := &cloudwatchValidator{
+		validatorSettings: &validatorSettings{
+			prefix:      "stream",
+			logGroups:   []string{"group-1", "group-2"},
+			parser:      newRecordIdParser(defaultRecordIdLength),
+			delays:      &DelayStats{},
+			workerCount: 1,
+		},
+		client: client,
+	}
+	inputMap := newInputMap(2)
+
+	// Test case 1: the stream of LOG_PREFIX is read in every log group
+	found, err := validator.Validate(context.Background(), inputMap)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, found)
+	assert.Equal(t, map[string]int{"10000000": 2, "10000001": 2}, inputMap.toMap())
+
+	// Test case 2: the records are reported per log group
+	result := &destinationResult{}
+	validator.report(result)
+	assert.Equal(t, []LogGroupRecords{{LogGroup: "group-1", Records: 2}, {LogGroup: "group-2", Records: 2}}, result.logGroups)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Time range of the records to validate, either bound may be unset (zero) to leave that side open
+type TimeWindow struct {
+	start time.Time
+	end   time.Time
+}
+
+// Parses a window bound given as RFC3339 or as milliseconds since epoch, an empty value is unset
+func parseWindowTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if milliseconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, milliseconds*int64(time.Millisecond)), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC3339 nor milliseconds since epoch", value)
+	}
+	return t, nil
+}
+
+// Returns true if t is within the window, bounds included
+func (w TimeWindow) contains(t time.Time) bool {
+	if !w.start.IsZero() && t.Before(w.start) {
+		return false
+	}
+	if !w.end.IsZero() && t.After(w.end) {
+		return false
+	}
+	return true
+}
+
+// Returns the start of the window in milliseconds since epoch, or nil if it is unset
+func (w TimeWindow) startMillis() *int64 {
+	if w.start.IsZero() {
+		return nil
+	}
+	return aws.Int64(aws.TimeUnixMilli(w.start))
+}
+
+// Returns the end of the window in milliseconds since epoch, or nil if it is unset
+func (w TimeWindow) endMillis() *int64 {
+	if w.end.IsZero() {
+		return nil
+	}
+	return aws.Int64(aws.TimeUnixMilli(w.end))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWindowTime(t *testing.T) {
+	// Test case 1: unset
+	value, err := parseWindowTime("")
+	assert.NoError(t, err)
+	assert.True(t, value.IsZero())
+
+	// Test case 2: milliseconds since epoch
+	value, err = parseWindowTime("1639151827578")
+	assert.NoError(t, err)
+	assert.True(t, value.Equal(time.Unix(1639151827, 578000000)))
+
+	// Test case 3: RFC3339
+	value, err = parseWindowTime("2021-12-10T15:57:07Z")
+	assert.NoError(t, err)
+	assert.True(t, value.Equal(time.Unix(1639151827, 0)))
+
+	// Test case 4: invalid
+	_, err = parseWindowTime("yesterday")
+	assert.Error(t, err)
+}
+
+func TestTimeWindow(t *testing.T) {
+	start := time.Unix(1639151827, 0)
+	end := start.Add(10 * time.Minute)
+
+	// Test case 1: unbounded
+	window := TimeWindow{}
+	assert.True(t, window.contains(start))
+	assert.Nil(t, window.startMillis())
+	assert.Nil(t, window.endMillis())
+
+	// Test case 2: bounded, bounds included
+	window = TimeWindow{start: start, end: end}
+	assert.True(t, window.contains(start))
+	assert.True(t, window.contains(end))
+	assert.False(t, window.contains(start.Add(-time.Millisecond)))
+	assert.False(t, window.contains(end.Add(time.Millisecond)))
+	assert.Equal(t, int64(1639151827000), *window.startMillis())
+	assert.Equal(t, int64(1639152427000), *window.endMillis())
+
+	// Test case 3: only a start
+	window = TimeWindow{start: start}
+	assert.True(t, window.contains(end.Add(time.Hour)))
+	assert.Nil(t, window.endMillis())
+}
@@ -9,7 +9,7 @@ def bar_raiser(test_results):
     return all(
         # Log loss
         list(
-            map(lambda t: int(t["parsed_validation_output"]["percent_loss"]) < BAR_ACCEPTED_PERCENT_LOSS, test_results))
+            map(lambda t: float(t["parsed_validation_output"]["percent_loss"]) < BAR_ACCEPTED_PERCENT_LOSS, test_results))
 
         # Log duplication
         + list(